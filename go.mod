@@ -3,12 +3,19 @@ module github.com/rickyshrestha/set-intersection-exercise
 go 1.16
 
 require (
+	github.com/klauspost/compress v1.13.1
 	github.com/mattn/go-colorable v0.1.8 // indirect
 	github.com/mgutz/ansi v0.0.0-20200706080929-d51e80ef957d // indirect
 	github.com/pkg/errors v0.9.1
 	github.com/pterm/pterm v0.12.29
 	github.com/stretchr/testify v1.7.0
 	github.com/tav/golly v0.0.0-20180823113506-ad032321f11e
+	github.com/ulikunitz/xz v0.5.10
 	github.com/urfave/cli v1.22.5
+	github.com/xitongsys/parquet-go v1.6.2
+	go.uber.org/goleak v1.1.11
 	golang.org/x/crypto v0.0.0-20210711020723-a769d52b0f97 // indirect
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	golang.org/x/text v0.3.7
+	gopkg.in/yaml.v2 v2.4.0
 )
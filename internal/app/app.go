@@ -1,22 +1,41 @@
 package app
 
 import (
-	"io"
+	"context"
 	"os"
+	"sort"
 
 	"github.com/pkg/errors"
 	"github.com/tav/golly/log"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/rickyshrestha/set-intersection-exercise/internal/counter"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/filter"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/reader"
 )
 
 // ReadKeyFromFileFunc signature of function that can be used to read keys from a file
-type ReadKeyFromFileFunc func(key string, reader io.Reader, keysOuput chan<- string) error
+type ReadKeyFromFileFunc = reader.ReadKeysFunc
 
-// NewApp creates a new app for finding set intersection using the func passed in the parameter to parse keys from the input files
+// ReadKeyBatchesFromFileFunc signature of function that can be used to read batches of keys from a file
+type ReadKeyBatchesFromFileFunc = reader.ReadKeyBatchesFunc
+
+// RejectFunc is called with each malformed row skipped from the file at path
+type RejectFunc func(path string, reject reader.Reject) error
+
+// NewApp creates a new app for finding set intersection using the func passed in the parameter to parse keys from the input files.
+// The keys are batched as they come in by reader.Batched, see NewBatchApp
 func NewApp(readKeysFunc ReadKeyFromFileFunc) App {
+	if readKeysFunc == nil {
+		return App{}
+	}
+	return NewBatchApp(reader.Batched(readKeysFunc))
+}
+
+// NewBatchApp is NewApp using a func that sends batches of keys, which saves a channel send per key
+func NewBatchApp(readKeyBatchesFunc ReadKeyBatchesFromFileFunc) App {
 	return App{
-		readKeyFromFile: readKeysFunc,
+		readKeyBatchesFromFile: readKeyBatchesFunc,
 	}
 }
 
@@ -24,61 +43,242 @@ func NewApp(readKeysFunc ReadKeyFromFileFunc) App {
 type App struct {
 	// This allows the caller to pass in the read function depending on the file
 	// so that other file types can be used (eg. json, xml)
-	readKeyFromFile ReadKeyFromFileFunc
+	readKeyBatchesFromFile ReadKeyBatchesFromFileFunc
+}
+
+// readerOf returns the function to read batches of keys of the source with, the keys sent one at a time
+// by a ReadKeyFromFileFunc are batched by reader.Batched. It is nil when there is none
+func (a *App) readerOf(source Source) ReadKeyBatchesFromFileFunc {
+	switch {
+	case source.ReadKeyBatchesFromFile != nil:
+		return source.ReadKeyBatchesFromFile
+	case source.ReadKeyFromFile != nil:
+		return reader.Batched(source.ReadKeyFromFile)
+	}
+	return a.readKeyBatchesFromFile
+}
+
+// Source is a file to compare
+type Source struct {
+	Path string
+	// Key has the columns that make up the key of this file, RuntimeParam.Key is used when empty
+	Key []string
+	// ReadKeyFromFile reads the keys of this file when it is in a different format, the app's is used when nil
+	ReadKeyFromFile ReadKeyFromFileFunc
+	// ReadKeyBatchesFromFile is ReadKeyFromFile sending batches of keys, it is used over ReadKeyFromFile when both are set
+	ReadKeyBatchesFromFile ReadKeyBatchesFromFileFunc
+	// Compression of the file, found from the file when empty or auto
+	Compression reader.Compression
+	// Sketch, when set, is used in place of reading the file. Path is then the path of the sketch
+	Sketch *counter.StoredSketch
 }
 
 // RuntimeParam are parameters used for running the app
 type RuntimeParam struct {
-	FirstSource, SecondSource, Key string
-	BufferSize                     int
+	// Sources are the files to compare, at least two are needed
+	Sources []Source
+	// Key has the columns that make up the key of the sources that do not have their own
+	Key []string
+	// Normalizers are applied to the key values of every source before they are compared
+	Normalizers []reader.Normalizer
+	// NormalizerNames are the Normalizers as they were given, eg. lower. They are checked along with Nulls and Filter
+	// against those the sketches among the sources were built with
+	NormalizerNames []string
+	// BufferSize is the no. of keys of each source to hold while they wait to be counted
+	BufferSize int
+	// BatchSize is the no. of keys sent from the reader of a source to the counter at a time, reader.DefaultBatchSize when 0
+	BatchSize int
+	// Csv is the dialect of the csv files
+	Csv reader.CsvDialect
+	// NoHeader is set when the csv files have no header, the key columns are then given by index
+	NoHeader bool
+	// ZeroBased counts the key columns given by index from 0 instead of from 1
+	ZeroBased bool
+	// Malformed is what is done with the rows that cannot be parsed or do not have the key, they fail the run when not set
+	Malformed reader.MalformedRows
+	// OnReject, if set, is called with each malformed row that is skipped along with the path of its file
+	OnReject RejectFunc
+	// Nulls is what is done with the keys that are null, they are counted as any other key when not set
+	Nulls reader.NullKeys
+	// Filter, if set, picks the rows of each file that keys are read from
+	Filter *filter.Filter
+	// MemoryLimit is the no. of bytes of key counts to hold in memory before spilling to disk, 0 for no limit
+	MemoryLimit int64
+	// TempDir is where keys are spilled to when over the memory limit, and where compressed parquet files are copied to
+	TempDir string
+	// KeyVisitor is called with every distinct key and its count in each source, if set
+	KeyVisitor counter.KeyVisitor
+	// Approximate, if set, estimates the counts from sketches of the sources instead of counting every key
+	Approximate *counter.Approximation
+	// TopKeys is the no. of most repeated keys of each source, and of keys adding the most to the total overlap, to find.
+	// The histogram of how many times keys are repeated is found along with them, 0 for none
+	TopKeys int
+	// Shards is the no. of shards to count and compare the keys in, in parallel, when they are held in memory. 0 or 1 for none
+	Shards int
 }
 
-// Start starts the read from file and processing the intersections
-func (a *App) Start(param RuntimeParam) (counter.IntersectionResult, error) {
-	if a.readKeyFromFile == nil {
-		return counter.IntersectionResult{}, errors.New("function to parse input files for keys is not set")
+// Start starts the read from file and processing the intersections.
+// It returns on the first error, or with the error of the context once it is done, after every reader has stopped
+func (a *App) Start(ctx context.Context, param RuntimeParam) (counter.IntersectionResult, error) {
+	for _, source := range param.Sources {
+		if a.readerOf(source) == nil && source.Sketch == nil {
+			return counter.IntersectionResult{}, errors.Errorf("function to parse input file for keys is not set: %s", source.Path)
+		}
 	}
 
-	// read first tile
-	firstKeys := make(chan string, param.BufferSize)
-	secondKeys := make(chan string, param.BufferSize)
+	if len(param.Sources) < 2 {
+		return counter.IntersectionResult{}, errors.Errorf("at least two source files are needed, got: %v", len(param.Sources))
+	}
 
-	errorCh := make(chan error)
+	for _, source := range param.Sources {
+		if len(source.Key) == 0 && len(param.Key) == 0 && source.Sketch == nil {
+			return counter.IntersectionResult{}, errors.Errorf("key is not set for source: %s", source.Path)
+		}
+	}
 
-	go func() {
-		if err := a.readFileIntoKeysChannel(param.FirstSource, param.Key, firstKeys); err != nil {
-			errorCh <- err
+	if err := checkSketches(param); err != nil {
+		return counter.IntersectionResult{}, err
+	}
+
+	// the first error cancels the context so that the readers and the counter stop
+	group, ctx := errgroup.WithContext(ctx)
+
+	// read each file
+	inputs := make([]counter.Input, 0, len(param.Sources))
+	// the no. of malformed rows skipped from, and null keys left out of, each file, set by its reader
+	skippedRows := make([]int, len(param.Sources))
+	excludedKeys := make([]nullKeyCounts, len(param.Sources))
+
+	for i, source := range param.Sources {
+		if source.Sketch != nil {
+			inputs = append(inputs, counter.Input{Sketch: source.Sketch})
+			continue
 		}
-	}()
 
-	// read second file
-	go func() {
-		if err := a.readFileIntoKeysChannel(param.SecondSource, param.Key, secondKeys); err != nil {
-			errorCh <- err
+		opts := reader.Options{
+			Key:         source.Key,
+			Normalizers: param.Normalizers,
+			BatchSize:   param.BatchSize,
+			Csv:         param.Csv,
+			NoHeader:    param.NoHeader,
+			ZeroBased:   param.ZeroBased,
+			Malformed:   param.Malformed,
+			OnReject:    countRejects(source.Path, &skippedRows[i], param.OnReject),
+			Nulls:       param.Nulls,
+			Filter:      param.Filter,
+			TempDir:     param.TempDir,
+			OnExclude:   excludedKeys[i].add(param.Nulls.Policy == reader.NullSeparate),
+		}
+		if len(opts.Key) == 0 {
+			opts.Key = param.Key
 		}
-	}()
+
+		sourceBatches := make(chan []string, batchBuffer(param.BufferSize, param.BatchSize))
+		inputs = append(inputs, counter.Input{Batches: sourceBatches})
+
+		readKeyBatches := a.readerOf(source)
+		source := source
+		group.Go(func() error {
+			return readFileIntoBatchesChannel(ctx, readKeyBatches, source, opts, sourceBatches)
+		})
+	}
 
 	// find overlaps
-	resultCh := make(chan counter.IntersectionResult)
-	go func() {
-		result, err := counter.FindSetIntersection(firstKeys, secondKeys)
-		if err != nil {
-			errorCh <- errors.Wrap(err, "while finding intersection")
-		}
-		resultCh <- result
-	}()
+	var result counter.IntersectionResult
+	group.Go(func() error {
+		var err error
+		result, err = counter.FindSetIntersectionOf(ctx, counter.Options{
+			MemoryLimit: param.MemoryLimit,
+			TempDir:     param.TempDir,
+			Visitor:     param.KeyVisitor,
+			Approximate: param.Approximate,
+			TopKeys:     param.TopKeys,
+			Shards:      param.Shards,
+		}, inputs...)
+		return errors.Wrap(err, "while finding intersection")
+	})
 
-	select {
-	case err := <-errorCh:
+	if err := group.Wait(); err != nil {
 		return counter.IntersectionResult{}, err
-	case result := <-resultCh:
-		return result, nil
 	}
+
+	for i := range result.Files {
+		result.Files[i].SkippedRows = skippedRows[i]
+		result.Files[i].ExcludedKeyCount = excludedKeys[i].total
+		result.Files[i].NullKeys = excludedKeys[i].byValue()
+	}
+
+	return result, nil
+}
+
+// nullKeyCounts counts the null keys left out of a file
+type nullKeyCounts struct {
+	total  int
+	values map[string]int
+}
+
+// add returns the func counting each null key, along with its value when byValue is set
+func (n *nullKeyCounts) add(byValue bool) reader.ExcludeFunc {
+	if byValue {
+		n.values = make(map[string]int)
+	}
+
+	return func(key string) error {
+		n.total++
+		if n.values != nil {
+			n.values[key]++
+		}
+		return nil
+	}
+}
+
+// byValue returns the counts of the values of the null keys, the most found first, nil when they were not counted by value
+func (n *nullKeyCounts) byValue() []counter.KeyFrequency {
+	if len(n.values) == 0 {
+		return nil
+	}
+
+	counts := make([]counter.KeyFrequency, 0, len(n.values))
+	for key, count := range n.values {
+		counts = append(counts, counter.KeyFrequency{Key: key, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Key < counts[j].Key
+	})
+	return counts
+}
+
+// countRejects counts the malformed rows skipped from the file at path before passing them on to onReject, if set
+func countRejects(path string, skipped *int, onReject RejectFunc) reader.RejectFunc {
+	return func(reject reader.Reject) error {
+		*skipped++
+		if onReject == nil {
+			return nil
+		}
+		return onReject(path, reject)
+	}
+}
+
+// batchBuffer is the no. of batches of keys to hold for a buffer of bufferSize keys, at least one
+func batchBuffer(bufferSize, batchSize int) int {
+	if batchSize <= 0 {
+		batchSize = reader.DefaultBatchSize
+	}
+
+	if bufferSize <= batchSize {
+		return 1
+	}
+	return (bufferSize + batchSize - 1) / batchSize
 }
 
-func (a *App) readFileIntoKeysChannel(filePath, key string, output chan<- string) error {
+func readFileIntoBatchesChannel(ctx context.Context, readKeyBatches ReadKeyBatchesFromFileFunc, source Source, opts reader.Options, output chan<- []string) error {
 	defer close(output)
 
+	filePath := source.Path
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		return errors.Wrapf(err, "unable to read file: %s", filePath)
@@ -89,7 +289,13 @@ func (a *App) readFileIntoKeysChannel(filePath, key string, output chan<- string
 		}
 	}()
 
-	if err := a.readKeyFromFile(key, file, output); err != nil {
+	input, release, err := reader.Decompress(source.Compression, filePath, file)
+	if err != nil {
+		return errors.Wrapf(err, "unable to decompress file: %s", filePath)
+	}
+	defer release()
+
+	if err := readKeyBatches(ctx, opts, input, output); err != nil {
 		return errors.Wrapf(err, "while processing file: %s", filePath)
 	}
 
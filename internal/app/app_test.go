@@ -2,26 +2,60 @@ package app
 
 import (
 	"bufio"
+	"context"
+	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
 
 	"github.com/rickyshrestha/set-intersection-exercise/internal/counter"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/filter"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/reader"
 )
 
-func mockReadKeyFromFile(key string, reader io.Reader, keysOutput chan<- string) error {
-	if key != "key" {
+func TestMain(m *testing.M) {
+	// dependencies start goroutines of their own on init (eg. the log flusher)
+	goleak.VerifyTestMain(m, goleak.IgnoreCurrent())
+}
+
+// endlessReadKeyFromFile keeps sending keys until the context is done
+func endlessReadKeyFromFile(ctx context.Context, opts reader.Options, r io.Reader, keysOutput chan<- string) error {
+	for i := 0; ; i++ {
+		select {
+		case keysOutput <- strconv.Itoa(i % 100):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func failingReadKeyFromFile(ctx context.Context, opts reader.Options, r io.Reader, keysOutput chan<- string) error {
+	return errors.New("unable to read")
+}
+
+func mockReadKeyFromFile(ctx context.Context, opts reader.Options, r io.Reader, keysOutput chan<- string) error {
+	if len(opts.Key) != 1 || opts.Key[0] != "key" {
 		return errors.New("invalid test key for mock")
 	}
 
-	r := bufio.NewReader(reader)
-	line, _, _ := r.ReadLine()
+	line, _, _ := bufio.NewReader(r).ReadLine()
 
 	for _, l := range strings.Split(string(line), ",") {
-		keysOutput <- l
+		for _, n := range opts.Normalizers {
+			l = n(l)
+		}
+		select {
+		case keysOutput <- l:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 
 	return nil
@@ -29,37 +63,475 @@ func mockReadKeyFromFile(key string, reader io.Reader, keysOutput chan<- string)
 
 func Test_Start_Success(t *testing.T) {
 	a := NewApp(mockReadKeyFromFile)
-	res, err := a.Start(RuntimeParam{
-		FirstSource:  "./testdata/first.txt",
-		SecondSource: "./testdata/second.txt",
-		Key:          "key",
-		BufferSize:   64,
+	res, err := a.Start(context.Background(), RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
 	})
 
 	assert.NoError(t, err)
+
+	same := counter.Similarity{Jaccard: 1, ContainmentOfFirst: 1, ContainmentOfSecond: 1, OverlapCoefficient: 1, Dice: 1}
 	assert.Equal(t, counter.IntersectionResult{
-		First: counter.FileResult{
-			KeyCount:         8,
-			DistinctKeyCount: 6,
+		Files: []counter.FileResult{
+			{
+				KeyCount:                  8,
+				DistinctKeyCount:          6,
+				ExclusiveKeyCount:         2,
+				DistinctExclusiveKeyCount: 2,
+			},
+			{
+				KeyCount:                  9,
+				DistinctKeyCount:          6,
+				ExclusiveKeyCount:         2,
+				DistinctExclusiveKeyCount: 2,
+			},
 		},
-		Second: counter.FileResult{
-			KeyCount:         9,
-			DistinctKeyCount: 6,
+		Pairs: [][]counter.Overlap{
+			{
+				{DistinctOverlap: 6, TotalOverlap: 12, DistinctUnion: 6, MultisetOverlap: 8, DistinctSimilarity: same, WeightedSimilarity: same},
+				{
+					DistinctOverlap: 4, TotalOverlap: 11, DistinctDifference: 2, DistinctUnion: 8, DistinctSymmetricDifference: 4, MultisetOverlap: 5,
+					DistinctSimilarity: counter.Similarity{Jaccard: 0.5, ContainmentOfFirst: 4.0 / 6, ContainmentOfSecond: 4.0 / 6, OverlapCoefficient: 4.0 / 6, Dice: 8.0 / 12},
+					WeightedSimilarity: counter.Similarity{Jaccard: 5.0 / 12, ContainmentOfFirst: 5.0 / 8, ContainmentOfSecond: 5.0 / 9, OverlapCoefficient: 5.0 / 8, Dice: 10.0 / 17},
+				},
+			},
+			{
+				{
+					DistinctOverlap: 4, TotalOverlap: 11, DistinctDifference: 2, DistinctUnion: 8, DistinctSymmetricDifference: 4, MultisetOverlap: 5,
+					DistinctSimilarity: counter.Similarity{Jaccard: 0.5, ContainmentOfFirst: 4.0 / 6, ContainmentOfSecond: 4.0 / 6, OverlapCoefficient: 4.0 / 6, Dice: 8.0 / 12},
+					WeightedSimilarity: counter.Similarity{Jaccard: 5.0 / 12, ContainmentOfFirst: 5.0 / 9, ContainmentOfSecond: 5.0 / 8, OverlapCoefficient: 5.0 / 8, Dice: 10.0 / 17},
+				},
+				{DistinctOverlap: 6, TotalOverlap: 17, DistinctUnion: 6, MultisetOverlap: 9, DistinctSimilarity: same, WeightedSimilarity: same},
+			},
 		},
-		TotalOverlap:    11,
 		DistinctOverlap: 4,
+		TotalOverlap:    11,
+		DistinctUnion:   8,
 	}, res)
 }
 
+func Test_Start_MultipleSources(t *testing.T) {
+	a := NewApp(mockReadKeyFromFile)
+	res, err := a.Start(context.Background(), RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}, {Path: "./testdata/first.txt"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, res.Files, 3)
+	assert.Equal(t, res.Files[0], res.Files[2])
+	assert.Equal(t, 4, res.DistinctOverlap)
+	// A: 1*1*1, C: 1*2*1, D: 2*1*2, F: 2*3*2
+	assert.Equal(t, 19, res.TotalOverlap)
+	assert.Equal(t, res.Pairs[0][1], res.Pairs[2][1])
+}
+
+func Test_Start_KeyPerSource(t *testing.T) {
+	var keys [][]string
+	mu := sync.Mutex{}
+
+	a := NewApp(func(ctx context.Context, opts reader.Options, r io.Reader, keysOutput chan<- string) error {
+		mu.Lock()
+		keys = append(keys, opts.Key)
+		mu.Unlock()
+		return mockReadKeyFromFile(ctx, reader.Options{Key: []string{"key"}}, r, keysOutput)
+	})
+	res, err := a.Start(context.Background(), RuntimeParam{
+		Sources: []Source{
+			{Path: "./testdata/first.txt", Key: []string{"user_id"}},
+			{Path: "./testdata/second.txt", Key: []string{"uid"}},
+			{Path: "./testdata/second.txt"},
+		},
+		Key:        []string{"id"},
+		BufferSize: 64,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, res.DistinctOverlap)
+	assert.ElementsMatch(t, [][]string{{"user_id"}, {"uid"}, {"id"}}, keys)
+}
+
+func Test_Start_Normalizers(t *testing.T) {
+	a := NewApp(mockReadKeyFromFile)
+	res, err := a.Start(context.Background(), RuntimeParam{
+		Sources:     []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}},
+		Key:         []string{"key"},
+		Normalizers: []reader.Normalizer{strings.ToLower, strings.NewReplacer("x", "a", "y", "b").Replace},
+		BufferSize:  64,
+	})
+
+	assert.NoError(t, err)
+	// x and y become a and b
+	assert.Equal(t, 5, res.DistinctOverlap)
+	assert.Equal(t, 6, res.DistinctUnion)
+}
+
+func Test_Start_TopKeys(t *testing.T) {
+	a := NewApp(mockReadKeyFromFile)
+	res, err := a.Start(context.Background(), RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+		TopKeys:    1,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []counter.KeyFrequency{{Key: "D", Count: 2}}, res.Files[0].TopKeys)
+	assert.Equal(t, []counter.KeyFrequency{{Key: "F", Count: 3}}, res.Files[1].TopKeys)
+	assert.Equal(t, []counter.OverlapKey{{Key: "F", Counts: []int{2, 3}, Overlap: 6}}, res.TopOverlapKeys)
+}
+
+func Test_Start_Shards(t *testing.T) {
+	a := NewApp(mockReadKeyFromFile)
+	param := RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	}
+
+	expected, err := a.Start(context.Background(), param)
+	assert.NoError(t, err)
+
+	param.Shards = 4
+	res, err := a.Start(context.Background(), param)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, res)
+}
+
+func Test_Start_NoHeader(t *testing.T) {
+	a := NewApp(reader.ReadKeysFromCsvIntoChannel)
+	param := RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}},
+		Key:        []string{"2"},
+		NoHeader:   true,
+		BufferSize: 64,
+	}
+
+	// the only row of each file is read as keys, B and C
+	res, err := a.Start(context.Background(), param)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, res.DistinctOverlap)
+
+	// C and C
+	param.ZeroBased = true
+	res, err = a.Start(context.Background(), param)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res.DistinctOverlap)
+
+	param.NoHeader = false
+	_, err = a.Start(context.Background(), param)
+	assert.Error(t, err)
+}
+
+func Test_Start_MalformedRows(t *testing.T) {
+	a := NewApp(reader.ReadKeysFromCsvIntoChannel)
+	param := RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/malformed.csv"}, {Path: "./testdata/keys.csv"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	}
+
+	_, err := a.Start(context.Background(), param)
+	assert.Error(t, err)
+
+	var rejected []string
+	mu := sync.Mutex{}
+	param.Malformed = reader.MalformedRows{Skip: true}
+	param.OnReject = func(path string, reject reader.Reject) error {
+		mu.Lock()
+		defer mu.Unlock()
+		rejected = append(rejected, fmt.Sprintf("%s:%v:%s", path, reject.Line, reject.Raw))
+		return nil
+	}
+
+	res, err := a.Start(context.Background(), param)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, res.DistinctOverlap)
+	assert.Equal(t, []int{1, 0}, []int{res.Files[0].SkippedRows, res.Files[1].SkippedRows})
+	assert.Equal(t, []string{`./testdata/malformed.csv:3:b"c`}, rejected)
+}
+
+func Test_Start_NullKeys(t *testing.T) {
+	a := NewApp(reader.ReadKeysFromCsvIntoChannel)
+	param := RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/nulls.csv"}, {Path: "./testdata/keys.csv"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	}
+
+	res, err := a.Start(context.Background(), param)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, res.Files[0].KeyCount)
+	assert.Equal(t, 0, res.Files[0].ExcludedKeyCount)
+
+	param.Nulls = reader.NullKeys{Policy: reader.NullExclude}
+	res, err = a.Start(context.Background(), param)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, res.Files[0].KeyCount)
+	assert.Equal(t, 3, res.Files[0].ExcludedKeyCount)
+	assert.Nil(t, res.Files[0].NullKeys)
+	assert.Equal(t, 2, res.DistinctOverlap)
+
+	param.Nulls = reader.NullKeys{Policy: reader.NullSeparate}
+	res, err = a.Start(context.Background(), param)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, res.Files[0].KeyCount)
+	assert.Equal(t, 3, res.Files[0].ExcludedKeyCount)
+	assert.Equal(t, []counter.KeyFrequency{{Key: "NULL", Count: 2}, {Key: "", Count: 1}}, res.Files[0].NullKeys)
+	assert.Equal(t, 0, res.Files[1].ExcludedKeyCount)
+	assert.Nil(t, res.Files[1].NullKeys)
+}
+
+func Test_Start_Filter(t *testing.T) {
+	a := NewApp(reader.ReadKeysFromCsvIntoChannel)
+	param := RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/nulls.csv"}, {Path: "./testdata/keys.csv"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	}
+
+	var err error
+	param.Filter, err = filter.Parse("key != d")
+	assert.NoError(t, err)
+
+	res, err := a.Start(context.Background(), param)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4, 2}, []int{res.Files[0].KeyCount, res.Files[1].KeyCount})
+	assert.Equal(t, 1, res.DistinctOverlap)
+
+	param.Filter, err = filter.Parse("status = active")
+	assert.NoError(t, err)
+
+	_, err = a.Start(context.Background(), param)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "filter field (status) does not exist in header")
+	}
+}
+
+func Test_Start_ReadKeyFromFilePerSource(t *testing.T) {
+	otherFormat := func(ctx context.Context, opts reader.Options, r io.Reader, keysOutput chan<- string) error {
+		return mockReadKeyFromFile(ctx, opts, r, keysOutput)
+	}
+
+	a := NewApp(nil)
+	res, err := a.Start(context.Background(), RuntimeParam{
+		Sources: []Source{
+			{Path: "./testdata/first.txt", ReadKeyFromFile: mockReadKeyFromFile},
+			{Path: "./testdata/second.txt", ReadKeyFromFile: otherFormat},
+		},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, res.DistinctOverlap)
+
+	_, err = a.Start(context.Background(), RuntimeParam{
+		Sources: []Source{
+			{Path: "./testdata/first.txt", ReadKeyFromFile: mockReadKeyFromFile},
+			{Path: "./testdata/second.txt"},
+		},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	})
+	assert.Error(t, err)
+}
+
+func Test_Start_ReadKeyBatchesFromFile(t *testing.T) {
+	param := RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	}
+
+	a := NewApp(mockReadKeyFromFile)
+	expected, err := a.Start(context.Background(), param)
+	assert.NoError(t, err)
+
+	param.BatchSize = 2
+	batchApp := NewBatchApp(reader.Batched(mockReadKeyFromFile))
+	res, err := batchApp.Start(context.Background(), param)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, res)
+
+	// the batches of a source are used over the keys of the app
+	param.Sources[1].ReadKeyBatchesFromFile = reader.Batched(failingReadKeyFromFile)
+	_, err = a.Start(context.Background(), param)
+	assert.Error(t, err)
+}
+
+func Test_batchBuffer(t *testing.T) {
+	assert.Equal(t, 1, batchBuffer(0, 0))
+	assert.Equal(t, 1, batchBuffer(64, 0))
+	assert.Equal(t, 4, batchBuffer(4*reader.DefaultBatchSize, 0))
+	assert.Equal(t, 3, batchBuffer(5, 2))
+}
+
+func Test_Start_Compressed(t *testing.T) {
+	a := NewApp(mockReadKeyFromFile)
+	res, err := a.Start(context.Background(), RuntimeParam{
+		// first_xz.txt is found to be xz from its magic bytes, second.txt.gz from them or its extension
+		Sources:    []Source{{Path: "./testdata/first_xz.txt"}, {Path: "./testdata/second.txt.gz"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, res.DistinctOverlap)
+	assert.Equal(t, 11, res.TotalOverlap)
+
+	_, err = a.Start(context.Background(), RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt", Compression: reader.CompressionGzip}, {Path: "./testdata/second.txt.gz"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	})
+	assert.Error(t, err)
+}
+
+func Test_Start_NoKey(t *testing.T) {
+	a := NewApp(mockReadKeyFromFile)
+	_, err := a.Start(context.Background(), RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt", Key: []string{"key"}}, {Path: "./testdata/second.txt"}},
+		BufferSize: 64,
+	})
+
+	assert.Error(t, err)
+}
+
+func Test_Start_KeyVisitor(t *testing.T) {
+	visited := map[string][]int{}
+
+	a := NewApp(mockReadKeyFromFile)
+	_, err := a.Start(context.Background(), RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+		KeyVisitor: func(key string, counts []int) error {
+			visited[key] = append([]int{}, counts...)
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, visited, 8)
+	assert.Equal(t, []int{2, 3}, visited["F"])
+	assert.Equal(t, []int{0, 1}, visited["Y"])
+}
+
+func Test_Start_SingleSource(t *testing.T) {
+	a := NewApp(mockReadKeyFromFile)
+	_, err := a.Start(context.Background(), RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	})
+
+	assert.Error(t, err)
+}
+
 func Benchmark_AppStart(b *testing.B) {
 	a := NewApp(mockReadKeyFromFile)
 
 	for i := 0; i < b.N; i++ {
-		_, _ = a.Start(RuntimeParam{
-			FirstSource:  "./testdata/first.txt",
-			SecondSource: "./testdata/second.txt",
-			Key:          "key",
-			BufferSize:   64,
+		_, _ = a.Start(context.Background(), RuntimeParam{
+			Sources:    []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}},
+			Key:        []string{"key"},
+			BufferSize: 64,
+		})
+	}
+}
+
+func Test_Start_ReaderError(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	for _, limit := range []int64{0, 1 << 20} {
+		a := NewApp(endlessReadKeyFromFile)
+		_, err := a.Start(context.Background(), RuntimeParam{
+			Sources: []Source{
+				{Path: "./testdata/first.txt"},
+				{Path: "./testdata/second.txt", ReadKeyFromFile: failingReadKeyFromFile},
+				{Path: "./testdata/first.txt"},
+			},
+			Key:         []string{"key"},
+			BufferSize:  1,
+			MemoryLimit: limit,
 		})
+
+		// the other readers and the counter are stopped instead of being left blocked
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "unable to read")
+		}
+	}
+}
+
+func Test_Start_MissingFile(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	a := NewApp(endlessReadKeyFromFile)
+	_, err := a.Start(context.Background(), RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/missing.txt"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	})
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "missing.txt")
 	}
 }
+
+func Test_Start_VisitorError(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	a := NewApp(mockReadKeyFromFile)
+	_, err := a.Start(context.Background(), RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+		KeyVisitor: func(key string, counts []int) error {
+			return errors.New("unable to visit")
+		},
+	})
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unable to visit")
+	}
+}
+
+func Test_Start_Canceled(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	a := NewApp(endlessReadKeyFromFile)
+	_, err := a.Start(ctx, RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	})
+
+	assert.True(t, errors.Is(err, context.Canceled), err)
+}
+
+func Test_Start_Timeout(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	a := NewApp(endlessReadKeyFromFile)
+	_, err := a.Start(ctx, RuntimeParam{
+		Sources:     []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}},
+		Key:         []string{"key"},
+		BufferSize:  64,
+		MemoryLimit: 1 << 20,
+		TempDir:     t.TempDir(),
+	})
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+}
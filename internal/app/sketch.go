@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rickyshrestha/set-intersection-exercise/internal/counter"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/filter"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/reader"
+)
+
+// SketchParam are parameters used for building the sketch of a file
+type SketchParam struct {
+	Source Source
+	// Key has the columns that make up the key of the source when it does not have its own
+	Key []string
+	// Normalizers are applied to the key values before they are counted, the sketch should be compared with files read the same way
+	Normalizers []reader.Normalizer
+	// NormalizerNames are the Normalizers as they were given, eg. lower. They are kept in the sketch along with Nulls and Filter,
+	// to be checked against the files it is compared with
+	NormalizerNames []string
+	// BufferSize is the no. of keys to hold while they wait to be counted
+	BufferSize int
+	// BatchSize is the no. of keys sent from the reader to the counter at a time, reader.DefaultBatchSize when 0
+	BatchSize int
+	// Csv is the dialect of the csv files
+	Csv reader.CsvDialect
+	// NoHeader is set when the csv files have no header, the key columns are then given by index
+	NoHeader bool
+	// ZeroBased counts the key columns given by index from 0 instead of from 1
+	ZeroBased bool
+	// Malformed is what is done with the rows that cannot be parsed or do not have the key, they fail the run when not set
+	Malformed reader.MalformedRows
+	// OnReject, if set, is called with each malformed row that is skipped along with the path of its file
+	OnReject RejectFunc
+	// Nulls is what is done with the keys that are null, they are counted as any other key when not set
+	Nulls reader.NullKeys
+	// Filter, if set, picks the rows of each file that keys are read from
+	Filter *filter.Filter
+	// MemoryLimit is the no. of bytes of key counts to hold in memory before spilling to disk, 0 for no limit
+	MemoryLimit int64
+	// TempDir is where keys are spilled to when over the memory limit, and where compressed parquet files are copied to
+	TempDir string
+	// Approximate, if set, writes a sketch of a fixed size from which the counts are estimated, instead of the count of every key
+	Approximate *counter.Approximation
+	// Output is where the sketch is written
+	Output io.Writer
+}
+
+// BuildSketch reads the keys of the source and writes their sketch to the output, see counter.WriteSketch.
+// It returns on the first error, or with the error of the context once it is done, after the reader has stopped
+func (a *App) BuildSketch(ctx context.Context, param SketchParam) error {
+	readKeyBatches := a.readerOf(param.Source)
+	if readKeyBatches == nil {
+		return errors.Errorf("function to parse input file for keys is not set: %s", param.Source.Path)
+	}
+
+	key := param.Source.Key
+	if len(key) == 0 {
+		key = param.Key
+	}
+	if len(key) == 0 {
+		return errors.Errorf("key is not set for source: %s", param.Source.Path)
+	}
+
+	if param.Output == nil {
+		return errors.New("output of the sketch is not set")
+	}
+
+	group, ctx := errgroup.WithContext(ctx)
+	batches := make(chan []string, batchBuffer(param.BufferSize, param.BatchSize))
+
+	group.Go(func() error {
+		opts := reader.Options{
+			Key:         key,
+			Normalizers: param.Normalizers,
+			BatchSize:   param.BatchSize,
+			Csv:         param.Csv,
+			NoHeader:    param.NoHeader,
+			ZeroBased:   param.ZeroBased,
+			Malformed:   param.Malformed,
+			Nulls:       param.Nulls,
+			Filter:      param.Filter,
+			TempDir:     param.TempDir,
+		}
+		if param.OnReject != nil {
+			opts.OnReject = func(reject reader.Reject) error {
+				return param.OnReject(param.Source.Path, reject)
+			}
+		}
+		return readFileIntoBatchesChannel(ctx, readKeyBatches, param.Source, opts, batches)
+	})
+
+	group.Go(func() error {
+		err := counter.WriteSketch(ctx, counter.Options{
+			MemoryLimit: param.MemoryLimit,
+			TempDir:     param.TempDir,
+			Approximate: param.Approximate,
+		}, key, readSettings(param.NormalizerNames, param.Nulls, param.Filter), counter.Input{Batches: batches}, param.Output)
+		return errors.Wrap(err, "while writing sketch")
+	})
+
+	return group.Wait()
+}
+
+// readSettings are the settings that keys are read with, as they are kept in a sketch. The null values are only kept when
+// null keys are not counted, as they do not change the keys otherwise
+func readSettings(normalizerNames []string, nulls reader.NullKeys, filter *filter.Filter) counter.ReadSettings {
+	settings := counter.ReadSettings{Normalizers: normalizerNames, NullPolicy: nulls.Policy}
+	if settings.NullPolicy == "" {
+		settings.NullPolicy = reader.NullCount
+	}
+	if settings.NullPolicy != reader.NullCount {
+		settings.NullValues = nulls.Values
+		if settings.NullValues == nil {
+			settings.NullValues = reader.DefaultNullValues
+		}
+	}
+	if filter != nil {
+		settings.Filter = filter.String()
+	}
+	return settings
+}
+
+// checkSketches checks that the sketches among the sources were built with the same settings, and no. of key columns,
+// as the other sources are read with. Their keys would not match otherwise
+func checkSketches(param RuntimeParam) error {
+	hasSketch := false
+	for _, source := range param.Sources {
+		hasSketch = hasSketch || source.Sketch != nil
+	}
+	if !hasSketch {
+		return nil
+	}
+
+	settings := readSettings(param.NormalizerNames, param.Nulls, param.Filter)
+	sourceSettings := func(source Source) (counter.ReadSettings, []string, string) {
+		if source.Sketch != nil {
+			return source.Sketch.Settings, source.Sketch.Key, "sketch " + source.Path
+		}
+		if len(source.Key) == 0 {
+			return settings, param.Key, source.Path
+		}
+		return settings, source.Key, source.Path
+	}
+
+	firstSettings, firstKey, firstName := sourceSettings(param.Sources[0])
+	for _, source := range param.Sources[1:] {
+		settings, key, name := sourceSettings(source)
+		if len(key) != len(firstKey) {
+			return errors.Errorf("%s has a key of %v columns, but %s has %v", name, len(key), firstName, len(firstKey))
+		}
+		if !settings.Equal(firstSettings) {
+			return errors.Errorf("%s is read with %s, but %s with %s", name, settings, firstName, firstSettings)
+		}
+	}
+	return nil
+}
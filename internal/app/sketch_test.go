@@ -0,0 +1,139 @@
+package app
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickyshrestha/set-intersection-exercise/internal/counter"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/filter"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/reader"
+)
+
+func buildSketch(t *testing.T, a App, approximate *counter.Approximation) *counter.StoredSketch {
+	t.Helper()
+	return buildSketchWith(t, a, SketchParam{Approximate: approximate})
+}
+
+// buildSketchWith builds the sketch of the first file with the settings of param
+func buildSketchWith(t *testing.T, a App, param SketchParam) *counter.StoredSketch {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "first.sketch")
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+
+	param.Source = Source{Path: "./testdata/first.txt"}
+	param.Key = []string{"key"}
+	param.BufferSize = 64
+	param.Output = file
+	err = a.BuildSketch(context.Background(), param)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	sketch, err := counter.OpenSketch(path)
+	assert.NoError(t, err)
+	return sketch
+}
+
+func Test_BuildSketch_InPlaceOfSource(t *testing.T) {
+	a := NewApp(mockReadKeyFromFile)
+	param := RuntimeParam{
+		Sources:    []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}},
+		Key:        []string{"key"},
+		BufferSize: 64,
+	}
+
+	expected, err := a.Start(context.Background(), param)
+	assert.NoError(t, err)
+
+	sketch := buildSketch(t, a, nil)
+	assert.Equal(t, []string{"key"}, sketch.Key)
+
+	param.Sources[0] = Source{Path: sketch.Path, Sketch: sketch}
+	res, err := a.Start(context.Background(), param)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, res)
+
+	param.Approximate = &counter.Approximation{Precision: counter.DefaultPrecision, SampleSize: counter.DefaultSampleSize}
+	expected, err = a.Start(context.Background(), RuntimeParam{
+		Sources:     []Source{{Path: "./testdata/first.txt"}, {Path: "./testdata/second.txt"}},
+		Key:         []string{"key"},
+		BufferSize:  64,
+		Approximate: param.Approximate,
+	})
+	assert.NoError(t, err)
+
+	param.Sources[0] = Source{Path: sketch.Path, Sketch: buildSketch(t, a, param.Approximate)}
+	res, err = a.Start(context.Background(), param)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, res)
+}
+
+func Test_Start_SketchSettingsMismatch(t *testing.T) {
+	a := NewApp(mockReadKeyFromFile)
+	sketch := buildSketchWith(t, a, SketchParam{
+		Normalizers:     []reader.Normalizer{strings.ToLower},
+		NormalizerNames: []string{"lower"},
+		Nulls:           reader.NullKeys{Policy: reader.NullExclude},
+	})
+	assert.Equal(t, counter.ReadSettings{Normalizers: []string{"lower"}, NullPolicy: reader.NullExclude, NullValues: reader.DefaultNullValues}, sketch.Settings)
+
+	param := RuntimeParam{
+		Sources:         []Source{{Path: sketch.Path, Sketch: sketch}, {Path: "./testdata/second.txt"}},
+		Key:             []string{"key"},
+		BufferSize:      64,
+		Normalizers:     []reader.Normalizer{strings.ToLower},
+		NormalizerNames: []string{"lower"},
+		Nulls:           reader.NullKeys{Policy: reader.NullExclude},
+	}
+	_, err := a.Start(context.Background(), param)
+	assert.NoError(t, err)
+
+	mismatches := map[string]func(p *RuntimeParam){
+		"normalizers": func(p *RuntimeParam) { p.Normalizers, p.NormalizerNames = nil, nil },
+		"nulls":       func(p *RuntimeParam) { p.Nulls = reader.NullKeys{} },
+		"null values": func(p *RuntimeParam) { p.Nulls.Values = []string{"-"} },
+		"filter":      func(p *RuntimeParam) { p.Filter, _ = filter.Parse("key != x") },
+		"key":         func(p *RuntimeParam) { p.Key = []string{"key", "other"} },
+	}
+	for name, mismatch := range mismatches {
+		param := param
+		mismatch(&param)
+		_, err := a.Start(context.Background(), param)
+		assert.Error(t, err, name)
+	}
+
+	param.Normalizers, param.NormalizerNames = nil, nil
+	_, err = a.Start(context.Background(), param)
+	assert.EqualError(t, err, "./testdata/second.txt is read with no normalizers, null keys (exclude of NULL, \\N, NA), no filter, "+
+		"but sketch "+sketch.Path+" with normalizers (lower), null keys (exclude of NULL, \\N, NA), no filter")
+
+	// sketches are checked against each other when there are no files
+	param.Sources[1] = Source{Path: sketch.Path, Sketch: buildSketch(t, a, nil)}
+	_, err = a.Start(context.Background(), param)
+	assert.Error(t, err)
+}
+
+func Test_BuildSketch_ReaderError(t *testing.T) {
+	a := NewApp(failingReadKeyFromFile)
+	err := a.BuildSketch(context.Background(), SketchParam{
+		Source:     Source{Path: "./testdata/first.txt"},
+		Key:        []string{"key"},
+		BufferSize: 64,
+		Output:     ioutil.Discard,
+	})
+	assert.Error(t, err)
+
+	err = a.BuildSketch(context.Background(), SketchParam{
+		Source:     Source{Path: "./testdata/first.txt"},
+		BufferSize: 64,
+		Output:     ioutil.Discard,
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,287 @@
+package counter
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// defaults of Approximation
+const (
+	DefaultPrecision  = 14
+	DefaultSampleSize = 8192
+)
+
+// Approximation configures estimating the counts from sketches of the inputs instead of counting every distinct key.
+// The sketches take a fixed amount of memory however many keys there are
+type Approximation struct {
+	// Precision of the HyperLogLog the distinct keys of each input are counted with, from MinPrecision to MaxPrecision.
+	// Each takes 2^Precision bytes and has a standard error of 1.04/sqrt(2^Precision)
+	Precision int
+	// SampleSize is the no. of smallest key hashes the MinHash of each input keeps, the overlaps are estimated from them.
+	// The standard error of a share p of the keys is about sqrt(p(1-p)/SampleSize)
+	SampleSize int
+}
+
+func (a Approximation) validate() error {
+	if a.Precision < MinPrecision || a.Precision > MaxPrecision {
+		return errors.Errorf("precision must be between %v and %v, got: %v", MinPrecision, MaxPrecision, a.Precision)
+	}
+
+	if a.SampleSize <= 0 {
+		return errors.Errorf("sample size must be more than 0, got: %v", a.SampleSize)
+	}
+
+	return nil
+}
+
+// Sketch summarizes the keys of an input in a fixed amount of memory
+type Sketch struct {
+	// KeyCount is the exact no. of keys
+	KeyCount int
+	Distinct *HyperLogLog
+	Sample   *MinHash
+}
+
+// NewSketch creates an empty sketch
+func NewSketch(a Approximation) (*Sketch, error) {
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+
+	distinct, err := NewHyperLogLog(a.Precision)
+	if err != nil {
+		return nil, err
+	}
+
+	sample, err := NewMinHash(a.SampleSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sketch{Distinct: distinct, Sample: sample}, nil
+}
+
+// Add adds a key
+func (s *Sketch) Add(key string) {
+	s.add(key, 1)
+}
+
+// add adds a key count times
+func (s *Sketch) add(key string, count int) {
+	hash := hashKey(key)
+	s.KeyCount += count
+	s.Distinct.Add(hash)
+	s.Sample.add(hash, count)
+}
+
+// Approximation is what the sketch was created with
+func (s *Sketch) Approximation() Approximation {
+	return Approximation{Precision: s.Distinct.Precision(), SampleSize: s.Sample.Size()}
+}
+
+// DistinctKeyCount estimates the no. of distinct keys, along with its error.
+// It is exact, with no error, while the sample has every key
+func (s *Sketch) DistinctKeyCount() (int, int) {
+	if !s.Sample.Dropped() {
+		return s.Sample.Len(), 0
+	}
+
+	count := s.Distinct.Count()
+	return count, errorBound(float64(count) * s.Distinct.RelativeError())
+}
+
+// sketchKeys adds the keys of the input to a new sketch until the input is closed
+func sketchKeys(ctx context.Context, input Input, a Approximation) (*Sketch, error) {
+	sketch, err := NewSketch(a)
+	if err != nil {
+		return nil, err
+	}
+
+	err = input.receive(ctx, func(item string) error {
+		sketch.Add(item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sketch, nil
+}
+
+func findSetIntersectionApproximate(ctx context.Context, opts Options, inputs []Input) (IntersectionResult, error) {
+	if opts.Visitor != nil {
+		return IntersectionResult{}, errors.New("keys cannot be visited when approximating")
+	}
+
+	if opts.TopKeys > 0 {
+		return IntersectionResult{}, errors.New("top keys cannot be found when approximating")
+	}
+
+	// the sketches must match that of an approximate sketch file
+	a := *opts.Approximate
+	for _, input := range inputs {
+		if input.Sketch != nil && input.Sketch.Approximate != nil {
+			a = input.Sketch.Approximate.Approximation()
+			break
+		}
+	}
+
+	if err := a.validate(); err != nil {
+		return IntersectionResult{}, err
+	}
+
+	sketches := make([]*Sketch, len(inputs))
+	errs := make([]error, len(inputs))
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(inputs))
+	for i, input := range inputs {
+		go func(i int, input Input) {
+			if input.Sketch != nil {
+				sketches[i], errs[i] = input.Sketch.sketch(ctx, a)
+			} else {
+				sketches[i], errs[i] = sketchKeys(ctx, input, a)
+			}
+			wg.Done()
+		}(i, input)
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return IntersectionResult{}, errors.Wrapf(err, "while sketching keys of input %v", i+1)
+		}
+	}
+
+	return EstimateIntersection(sketches...)
+}
+
+// EstimateIntersection estimates the result from the sketches of two or more inputs, which must have been created with the same Approximation.
+// Every estimated count comes with an error bound: the exact count is within the bound of the estimate about 95% of the time
+func EstimateIntersection(sketches ...*Sketch) (IntersectionResult, error) {
+	if len(sketches) < 2 {
+		return IntersectionResult{}, errors.Errorf("at least two sketches are needed, got: %v", len(sketches))
+	}
+
+	samples := make([]*MinHash, len(sketches))
+	union, err := NewHyperLogLog(sketches[0].Distinct.Precision())
+	if err != nil {
+		return IntersectionResult{}, err
+	}
+
+	exact := true
+	for i, s := range sketches {
+		if s.Sample.Size() != sketches[0].Sample.Size() {
+			return IntersectionResult{}, errors.Errorf("sketch %v has a sample size of %v instead of %v", i+1, s.Sample.Size(), sketches[0].Sample.Size())
+		}
+		if err := union.Merge(s.Distinct); err != nil {
+			return IntersectionResult{}, errors.Wrapf(err, "sketch %v", i+1)
+		}
+
+		samples[i] = s.Sample
+		exact = exact && !s.Sample.Dropped()
+	}
+
+	// tally the sample of the union, once with the counts and once with their squares for the variance.
+	// A square too large for an int is kept at maxInt, which only makes the error smaller than it is
+	sample, dropped := unionSample(samples)
+	exact = exact && !dropped
+	sums, squares := newTally(len(sketches)), newTally(len(sketches))
+	counts, squaredCounts := make([]int, len(sketches)), make([]int, len(sketches))
+
+	for _, hash := range sample {
+		for i, s := range samples {
+			counts[i] = s.count(hash)
+			squaredCounts[i] = squareCount(counts[i])
+		}
+		_ = sums.add("", counts)
+		_ = squares.add("", squaredCounts)
+	}
+
+	e := estimator{sampleSize: float64(len(sample)), union: float64(len(sample))}
+	if !exact {
+		e.union = math.Max(float64(union.Count()), e.sampleSize)
+		e.unionError = e.union * union.RelativeError()
+	}
+
+	exactSums, exactSquares := sums.result(), squares.result()
+
+	result := IntersectionResult{
+		Approximate: true,
+		Files:       make([]FileResult, len(sketches)),
+		Pairs:       make([][]Overlap, len(sketches)),
+	}
+	result.TotalOverlap, result.TotalOverlapError = e.estimate(exactSums.TotalOverlap, exactSquares.TotalOverlap)
+	result.DistinctOverlap, result.DistinctOverlapError = e.estimate(exactSums.DistinctOverlap, exactSquares.DistinctOverlap)
+	result.DistinctUnion, result.DistinctUnionError = int(math.Round(e.union)), errorBound(e.unionError)
+
+	for i, s := range sketches {
+		file := &result.Files[i]
+		sumFile, squareFile := exactSums.Files[i], exactSquares.Files[i]
+
+		file.KeyCount = s.KeyCount
+		file.DistinctKeyCount, file.DistinctKeyCountError = s.DistinctKeyCount()
+		file.ExclusiveKeyCount, file.ExclusiveKeyCountError = e.estimate(sumFile.ExclusiveKeyCount, squareFile.ExclusiveKeyCount)
+		file.ExclusiveKeyCountSaturated = sumFile.ExclusiveKeyCountSaturated || squareFile.ExclusiveKeyCountSaturated
+		file.DistinctExclusiveKeyCount, file.DistinctExclusiveKeyCountError = e.estimate(sumFile.DistinctExclusiveKeyCount, squareFile.DistinctExclusiveKeyCount)
+
+		result.Pairs[i] = make([]Overlap, len(sketches))
+		for j := range sketches {
+			pair := &result.Pairs[i][j]
+			sumPair, squarePair := exactSums.Pairs[i][j], exactSquares.Pairs[i][j]
+
+			pair.TotalOverlap, pair.TotalOverlapError = e.estimate(sumPair.TotalOverlap, squarePair.TotalOverlap)
+			pair.DistinctOverlap, pair.DistinctOverlapError = e.estimate(sumPair.DistinctOverlap, squarePair.DistinctOverlap)
+			pair.DistinctDifference, pair.DistinctDifferenceError = e.estimate(sumPair.DistinctDifference, squarePair.DistinctDifference)
+			pair.DistinctUnion, pair.DistinctUnionError = e.estimate(sumPair.DistinctUnion, squarePair.DistinctUnion)
+			pair.DistinctSymmetricDifference, pair.DistinctSymmetricDifferenceError = e.estimate(sumPair.DistinctSymmetricDifference, squarePair.DistinctSymmetricDifference)
+			pair.MultisetOverlap, pair.MultisetOverlapError = e.estimate(sumPair.MultisetOverlap, squarePair.MultisetOverlap)
+			pair.MultisetOverlapSaturated = sumPair.MultisetOverlapSaturated || squarePair.MultisetOverlapSaturated
+		}
+		// every key of an input overlaps with itself
+		result.Pairs[i][i].MultisetOverlap, result.Pairs[i][i].MultisetOverlapError = s.KeyCount, 0
+		result.Pairs[i][i].MultisetOverlapSaturated = false
+	}
+	result.setSimilarity()
+
+	return result, nil
+}
+
+// estimator scales what is tallied from the sample of the union up to the whole union
+type estimator struct {
+	sampleSize float64
+	// union is the estimated no. of distinct keys across the inputs, with unionError as its standard error
+	union      float64
+	unionError float64
+}
+
+// estimate estimates a count given the sum of the value of each key in the sample and the sum of the squares of the values,
+// where the value is 1 or 0 for a distinct count (whether the key counts towards it) or the no. of keys it adds to a total count
+func (e estimator) estimate(sum, sumOfSquares int) (int, int) {
+	if e.sampleSize == 0 {
+		return 0, 0
+	}
+
+	mean := float64(sum) / e.sampleSize
+	variance := math.Max(float64(sumOfSquares)/e.sampleSize-mean*mean, 0)
+
+	// the sample is drawn without replacement, so it has no error once it is the whole union
+	correction := 0.0
+	if e.union > 1 {
+		correction = math.Max((e.union-e.sampleSize)/(e.union-1), 0)
+	}
+
+	sampleError := e.union * math.Sqrt(variance/e.sampleSize*correction)
+	unionError := mean * e.unionError
+
+	return int(math.Round(e.union * mean)), errorBound(math.Sqrt(sampleError*sampleError + unionError*unionError))
+}
+
+// errorBound is the bound the exact value is within about 95% of the time, given the standard error of an estimate
+func errorBound(standardError float64) int {
+	return int(math.Ceil(2 * standardError))
+}
@@ -0,0 +1,147 @@
+package counter
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// generateInputs generates three inputs that overlap in part, with some keys repeated
+func generateInputs(n int) [][]string {
+	var first, second, third []string
+	for i := 0; i < n; i++ {
+		key := strconv.Itoa(i)
+		first = append(first, key)
+		if i%3 == 0 {
+			first = append(first, key)
+		}
+		second = append(second, strconv.Itoa(i+n/2))
+		if i%2 == 0 {
+			third = append(third, strconv.Itoa(i*2), strconv.Itoa(i*2), strconv.Itoa(i*2))
+		}
+	}
+	return [][]string{first, second, third}
+}
+
+func findApproximate(t *testing.T, approximation Approximation, inputs [][]string) (IntersectionResult, IntersectionResult) {
+	t.Helper()
+
+	expected, err := FindSetIntersection(context.Background(), feed(inputs[0]), feed(inputs[1]), feed(inputs[2]))
+	assert.NoError(t, err)
+
+	res, err := FindSetIntersectionWithOptions(context.Background(), Options{Approximate: &approximation},
+		feed(inputs[0]), feed(inputs[1]), feed(inputs[2]))
+	assert.NoError(t, err)
+
+	return expected, res
+}
+
+// assertWithin checks that the estimate is within twice its error bound, allowing for the odd number outside of the bound
+func assertWithin(t *testing.T, expected, estimate, bound int, name string) {
+	t.Helper()
+	assert.InDelta(t, expected, estimate, float64(2*bound), "%s: expected %v, estimated %v ± %v", name, expected, estimate, bound)
+}
+
+func Test_FindSetIntersectionWithOptions_Approximate(t *testing.T) {
+	expected, res := findApproximate(t, Approximation{Precision: DefaultPrecision, SampleSize: DefaultSampleSize}, generateInputs(100000))
+
+	assert.True(t, res.Approximate)
+	assertWithin(t, expected.TotalOverlap, res.TotalOverlap, res.TotalOverlapError, "total overlap")
+	assertWithin(t, expected.DistinctOverlap, res.DistinctOverlap, res.DistinctOverlapError, "distinct overlap")
+	assertWithin(t, expected.DistinctUnion, res.DistinctUnion, res.DistinctUnionError, "distinct union")
+	// the errors are a small share of the counts
+	assert.Less(t, res.DistinctUnionError, expected.DistinctUnion/20)
+	assert.Less(t, res.DistinctOverlapError, expected.DistinctOverlap/5)
+
+	for i, file := range expected.Files {
+		estimate := res.Files[i]
+		assert.Equal(t, file.KeyCount, estimate.KeyCount)
+		assertWithin(t, file.DistinctKeyCount, estimate.DistinctKeyCount, estimate.DistinctKeyCountError, "distinct keys")
+		assertWithin(t, file.ExclusiveKeyCount, estimate.ExclusiveKeyCount, estimate.ExclusiveKeyCountError, "exclusive keys")
+		assertWithin(t, file.DistinctExclusiveKeyCount, estimate.DistinctExclusiveKeyCount, estimate.DistinctExclusiveKeyCountError, "distinct exclusive keys")
+
+		for j, pair := range expected.Pairs[i] {
+			estimate := res.Pairs[i][j]
+			assertWithin(t, pair.TotalOverlap, estimate.TotalOverlap, estimate.TotalOverlapError, "pair total overlap")
+			assertWithin(t, pair.DistinctOverlap, estimate.DistinctOverlap, estimate.DistinctOverlapError, "pair distinct overlap")
+			assertWithin(t, pair.DistinctDifference, estimate.DistinctDifference, estimate.DistinctDifferenceError, "pair difference")
+			assertWithin(t, pair.DistinctUnion, estimate.DistinctUnion, estimate.DistinctUnionError, "pair union")
+			assertWithin(t, pair.DistinctSymmetricDifference, estimate.DistinctSymmetricDifference, estimate.DistinctSymmetricDifferenceError, "pair symmetric difference")
+			assertWithin(t, pair.MultisetOverlap, estimate.MultisetOverlap, estimate.MultisetOverlapError, "pair multiset overlap")
+			assert.InDelta(t, pair.WeightedSimilarity.Jaccard, estimate.WeightedSimilarity.Jaccard, 0.05, "pair weighted jaccard")
+		}
+	}
+}
+
+func Test_FindSetIntersectionWithOptions_ApproximateLowPrecision(t *testing.T) {
+	expected, res := findApproximate(t, Approximation{Precision: 8, SampleSize: 256}, generateInputs(20000))
+
+	// the errors are larger but still hold
+	assertWithin(t, expected.DistinctOverlap, res.DistinctOverlap, res.DistinctOverlapError, "distinct overlap")
+	assertWithin(t, expected.DistinctUnion, res.DistinctUnion, res.DistinctUnionError, "distinct union")
+	assert.Greater(t, res.DistinctUnionError, expected.DistinctUnion/50)
+}
+
+func Test_FindSetIntersectionWithOptions_ApproximateSmallInputs(t *testing.T) {
+	// when the sample has every key the counts are exact
+	expected, res := findApproximate(t, Approximation{Precision: DefaultPrecision, SampleSize: DefaultSampleSize}, generateInputs(1000))
+
+	expected.Approximate = true
+	assert.Equal(t, expected, res)
+}
+
+func Test_FindSetIntersectionWithOptions_ApproximateInvalid(t *testing.T) {
+	for _, opts := range []Options{
+		{Approximate: &Approximation{Precision: 2, SampleSize: 16}},
+		{Approximate: &Approximation{Precision: DefaultPrecision}},
+		{Approximate: &Approximation{Precision: DefaultPrecision, SampleSize: 16}, Visitor: func(string, []int) error { return nil }},
+	} {
+		_, err := FindSetIntersectionWithOptions(context.Background(), opts, feed(nil), feed(nil))
+		assert.Error(t, err)
+	}
+}
+
+func Test_EstimateIntersection_SampleSizeKeys(t *testing.T) {
+	approximation := Approximation{Precision: 10, SampleSize: 16}
+	first, _ := NewSketch(approximation)
+	second, _ := NewSketch(approximation)
+	for i := 0; i < 16; i++ {
+		first.Add(strconv.Itoa(i))
+		second.Add(strconv.Itoa(i + 8))
+	}
+
+	// each sample has as many keys as its size without leaving any out, so each file is counted exactly
+	count, bound := first.DistinctKeyCount()
+	assert.Equal(t, 16, count)
+	assert.Equal(t, 0, bound)
+
+	// but the sample of their union cannot have all of its 24 keys
+	res, err := EstimateIntersection(first, second)
+	assert.NoError(t, err)
+	assert.Equal(t, 16, res.Files[0].DistinctKeyCount)
+	assert.Equal(t, 0, res.Files[0].DistinctKeyCountError)
+	assert.NotZero(t, res.DistinctUnionError)
+
+	res, err = EstimateIntersection(first, first)
+	assert.NoError(t, err)
+	assert.Equal(t, 16, res.DistinctUnion)
+	assert.Equal(t, 0, res.DistinctUnionError)
+	assert.Equal(t, 16, res.DistinctOverlap)
+	assert.Equal(t, 0, res.DistinctOverlapError)
+}
+
+func Test_EstimateIntersection_Mismatch(t *testing.T) {
+	first, _ := NewSketch(Approximation{Precision: 10, SampleSize: 16})
+	second, _ := NewSketch(Approximation{Precision: 12, SampleSize: 16})
+	_, err := EstimateIntersection(first, second)
+	assert.Error(t, err)
+
+	second, _ = NewSketch(Approximation{Precision: 10, SampleSize: 32})
+	_, err = EstimateIntersection(first, second)
+	assert.Error(t, err)
+
+	_, err = EstimateIntersection(first)
+	assert.Error(t, err)
+}
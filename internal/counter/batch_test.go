@@ -0,0 +1,105 @@
+package counter
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// feedBatches sends the keys in batches of size
+func feedBatches(keys []string, size int) <-chan []string {
+	ch := make(chan []string, 1)
+	go func() {
+		defer close(ch)
+		for len(keys) > size {
+			ch <- keys[:size]
+			keys = keys[size:]
+		}
+		if len(keys) > 0 {
+			ch <- keys
+		}
+	}()
+	return ch
+}
+
+func Test_FindSetIntersectionOf_Batches(t *testing.T) {
+	inputs := generateInputs(3000)
+	expected, err := FindSetIntersectionWithOptions(context.Background(), Options{TopKeys: 3},
+		feed(inputs[0]), feed(inputs[1]), feed(inputs[2]))
+	assert.NoError(t, err)
+
+	for _, opts := range []Options{
+		{TopKeys: 3},
+		{TopKeys: 3, Shards: 4},
+		{TopKeys: 3, MemoryLimit: 1024, TempDir: t.TempDir()},
+	} {
+		// batches and keys can be mixed
+		res, err := FindSetIntersectionOf(context.Background(), opts,
+			Input{Batches: feedBatches(inputs[0], 7)}, Input{Keys: feed(inputs[1])}, Input{Batches: feedBatches(inputs[2], 1000)})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, res, "%+v", opts)
+	}
+
+	approximate := Options{Approximate: &Approximation{Precision: DefaultPrecision, SampleSize: DefaultSampleSize}}
+	expected, err = FindSetIntersectionWithOptions(context.Background(), approximate, feed(inputs[0]), feed(inputs[1]))
+	assert.NoError(t, err)
+
+	res, err := FindSetIntersectionOf(context.Background(), approximate, Input{Batches: feedBatches(inputs[0], 7)}, Input{Batches: feedBatches(inputs[1], 7)})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, res)
+}
+
+func Test_FindSetIntersectionOf_InvalidInput(t *testing.T) {
+	_, err := FindSetIntersectionOf(context.Background(), Options{}, Input{Keys: feed(nil)}, Input{})
+	assert.Error(t, err)
+
+	_, err = FindSetIntersectionOf(context.Background(), Options{}, Input{Keys: feed(nil)}, Input{Keys: feed(nil), Batches: feedBatches(nil, 1)})
+	assert.Error(t, err)
+}
+
+func Test_FindSetIntersectionOf_BatchesCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the batches are never closed
+	_, err := FindSetIntersectionOf(ctx, Options{}, Input{Batches: make(chan []string)}, Input{Keys: feed(nil)})
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+}
+
+// Benchmark_FindSetIntersectionOf_Batches compares sending short keys one at a time with sending them in batches
+func Benchmark_FindSetIntersectionOf_Batches(b *testing.B) {
+	inputs := make([][]string, 2)
+	for i := range inputs {
+		inputs[i] = make([]string, rowCount*4)
+		for j := range inputs[i] {
+			inputs[i][j] = strconv.Itoa((i*rowCount + j) % (rowCount * 2))
+		}
+	}
+
+	for _, size := range []int{0, 16, 256, 1024} {
+		name := "keys"
+		if size > 0 {
+			name = "batches=" + strconv.Itoa(size)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				keyInputs := make([]Input, len(inputs))
+				for j, keys := range inputs {
+					if size == 0 {
+						keyInputs[j] = Input{Keys: feed(keys)}
+					} else {
+						keyInputs[j] = Input{Batches: feedBatches(keys, size)}
+					}
+				}
+
+				if _, err := FindSetIntersectionOf(context.Background(), Options{}, keyInputs...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package counter
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// KeyFrequency is a key along with the no. of times it is found in an input
+type KeyFrequency struct {
+	Key   string `json:"key" yaml:"key"`
+	Count int    `json:"count" yaml:"count"`
+}
+
+// OverlapKey is a key found in every input along with what it adds to TotalOverlap
+type OverlapKey struct {
+	Key string `json:"key" yaml:"key"`
+	// Counts has the no. of times the key is found in each input, in the order of the inputs
+	Counts []int `json:"counts" yaml:"counts"`
+	// Overlap is the product of the counts, ie. what the key adds to TotalOverlap. It is kept at the largest int when too large for one
+	Overlap int `json:"overlap" yaml:"overlap"`
+}
+
+// HistogramBucket counts the distinct keys that are found from Min to Max times in an input
+type HistogramBucket struct {
+	Min int `json:"min" yaml:"min"`
+	Max int `json:"max" yaml:"max"`
+	// DistinctKeys is the no. of distinct keys found from Min to Max times, Keys is the no. of times they are found in all
+	DistinctKeys int `json:"distinct_keys" yaml:"distinct_keys"`
+	Keys         int `json:"keys" yaml:"keys"`
+}
+
+// bucketOf returns the index of the histogram bucket of a count.
+// The buckets are 1, 2, 3-10, 11-100, 101-1000 and so on
+func bucketOf(count int) int {
+	if count <= 2 {
+		return count - 1
+	}
+
+	bucket := 2
+	for max := 10; count > max; max *= 10 {
+		bucket++
+		if max > maxInt/10 {
+			// the last bucket goes up to the largest int
+			break
+		}
+	}
+	return bucket
+}
+
+// bucketRange returns the lowest and highest count of a histogram bucket
+func bucketRange(bucket int) (int, int) {
+	if bucket < 2 {
+		return bucket + 1, bucket + 1
+	}
+	if bucket == 2 {
+		return 3, 10
+	}
+
+	max := 10
+	for i := 2; i < bucket; i++ {
+		if max > maxInt/10 {
+			// the last bucket goes up to the largest int
+			return max + 1, maxInt
+		}
+		max *= 10
+	}
+	return max/10 + 1, max
+}
+
+// frequencies finds the histogram and most repeated keys of each input, and the keys adding most to the total overlap,
+// as the keys are visited
+type frequencies struct {
+	top        int
+	histograms [][]HistogramBucket
+	topKeys    []*topHeap
+	topOverlap *topHeap
+}
+
+func newFrequencies(n, top int) *frequencies {
+	f := &frequencies{
+		top:        top,
+		histograms: make([][]HistogramBucket, n),
+		topKeys:    make([]*topHeap, n),
+		topOverlap: &topHeap{},
+	}
+	for i := range f.topKeys {
+		f.topKeys[i] = &topHeap{}
+	}
+	return f
+}
+
+func (f *frequencies) add(key string, counts []int) error {
+	product, ok := productOf(counts)
+	if !ok {
+		product = maxInt
+	}
+
+	for i, c := range counts {
+		if c == 0 {
+			continue
+		}
+
+		bucket := bucketOf(c)
+		for len(f.histograms[i]) <= bucket {
+			min, max := bucketRange(len(f.histograms[i]))
+			f.histograms[i] = append(f.histograms[i], HistogramBucket{Min: min, Max: max})
+		}
+		f.histograms[i][bucket].DistinctKeys++
+		f.histograms[i][bucket].Keys += c
+
+		// only keys that are repeated
+		if c > 1 {
+			f.topKeys[i].offer(f.top, key, c, nil)
+		}
+	}
+
+	if product > 0 {
+		f.topOverlap.offer(f.top, key, product, counts)
+	}
+
+	return nil
+}
+
+// merge adds the frequencies of other, found from keys apart from those of f, eg. the keys of another shard
+func (f *frequencies) merge(other *frequencies) {
+	for i, histogram := range other.histograms {
+		for len(f.histograms[i]) < len(histogram) {
+			min, max := bucketRange(len(f.histograms[i]))
+			f.histograms[i] = append(f.histograms[i], HistogramBucket{Min: min, Max: max})
+		}
+		for bucket := range histogram {
+			f.histograms[i][bucket].DistinctKeys += histogram[bucket].DistinctKeys
+			f.histograms[i][bucket].Keys += histogram[bucket].Keys
+		}
+
+		for _, entry := range *other.topKeys[i] {
+			f.topKeys[i].offer(f.top, entry.key, entry.weight, nil)
+		}
+	}
+
+	for _, entry := range *other.topOverlap {
+		f.topOverlap.offer(f.top, entry.key, entry.weight, entry.counts)
+	}
+}
+
+// set sets the frequencies on the result, most frequent first
+func (f *frequencies) set(result *IntersectionResult) {
+	for i := range result.Files {
+		result.Files[i].Histogram = f.histograms[i]
+
+		for _, entry := range f.topKeys[i].sorted() {
+			result.Files[i].TopKeys = append(result.Files[i].TopKeys, KeyFrequency{Key: entry.key, Count: entry.weight})
+		}
+	}
+
+	for _, entry := range f.topOverlap.sorted() {
+		result.TopOverlapKeys = append(result.TopOverlapKeys, OverlapKey{Key: entry.key, Counts: entry.counts, Overlap: entry.weight})
+	}
+}
+
+// topEntry is a key kept by a topHeap, counts is only kept when given
+type topEntry struct {
+	key    string
+	weight int
+	counts []int
+}
+
+// less orders the entries from the least to the most frequent, keys found as often are ordered by key
+// so that the same keys are kept whatever the order they are visited in
+func (e topEntry) less(other topEntry) bool {
+	if e.weight != other.weight {
+		return e.weight < other.weight
+	}
+	return e.key > other.key
+}
+
+// topHeap keeps the entries with the highest weight, the least of them at the top to be dropped first
+type topHeap []topEntry
+
+func (h topHeap) Len() int            { return len(h) }
+func (h topHeap) Less(i, j int) bool  { return h[i].less(h[j]) }
+func (h topHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *topHeap) Push(x interface{}) { *h = append(*h, x.(topEntry)) }
+func (h *topHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// offer keeps the key if it is among the size most frequent so far. counts is copied when kept as it is reused
+func (h *topHeap) offer(size int, key string, weight int, counts []int) {
+	entry := topEntry{key: key, weight: weight}
+
+	if h.Len() >= size {
+		if !(*h)[0].less(entry) {
+			return
+		}
+		heap.Pop(h)
+	}
+
+	if counts != nil {
+		entry.counts = append([]int{}, counts...)
+	}
+	heap.Push(h, entry)
+}
+
+// sorted returns the entries from the most to the least frequent
+func (h *topHeap) sorted() []topEntry {
+	entries := append([]topEntry{}, *h...)
+	sort.Slice(entries, func(i, j int) bool { return entries[j].less(entries[i]) })
+	return entries
+}
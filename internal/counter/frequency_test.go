@@ -0,0 +1,65 @@
+package counter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_bucketOf(t *testing.T) {
+	for count, bucket := range map[int]int{1: 0, 2: 1, 3: 2, 10: 2, 11: 3, 100: 3, 101: 4, 1000: 4, 1001: 5} {
+		assert.Equal(t, bucket, bucketOf(count), count)
+
+		min, max := bucketRange(bucket)
+		assert.True(t, min <= count && count <= max, "%v not in %v-%v", count, min, max)
+	}
+}
+
+func Test_FindSetIntersectionWithOptions_TopKeys(t *testing.T) {
+	first := []string{"a", "b", "b", "c", "c", "c", "d", "d", "d"}
+	for i := 0; i < 12; i++ {
+		first = append(first, "e")
+	}
+	second := []string{"a", "b", "b", "b", "d", "d", "e", "x", "x"}
+
+	for _, limit := range []int64{0, 2 * entryOverhead} {
+		res, err := FindSetIntersectionWithOptions(context.Background(), Options{
+			MemoryLimit: limit,
+			TempDir:     t.TempDir(),
+			TopKeys:     2,
+		}, feed(first), feed(second))
+		assert.NoError(t, err)
+
+		assert.Equal(t, []HistogramBucket{
+			{Min: 1, Max: 1, DistinctKeys: 1, Keys: 1},
+			{Min: 2, Max: 2, DistinctKeys: 1, Keys: 2},
+			{Min: 3, Max: 10, DistinctKeys: 2, Keys: 6},
+			{Min: 11, Max: 100, DistinctKeys: 1, Keys: 12},
+		}, res.Files[0].Histogram, "memory limit: %v", limit)
+		// c and d are found as often, the first by key is kept
+		assert.Equal(t, []KeyFrequency{{Key: "e", Count: 12}, {Key: "c", Count: 3}}, res.Files[0].TopKeys, "memory limit: %v", limit)
+		assert.Equal(t, []KeyFrequency{{Key: "b", Count: 3}, {Key: "d", Count: 2}}, res.Files[1].TopKeys, "memory limit: %v", limit)
+
+		assert.Equal(t, []OverlapKey{
+			{Key: "e", Counts: []int{12, 1}, Overlap: 12},
+			{Key: "b", Counts: []int{2, 3}, Overlap: 6},
+		}, res.TopOverlapKeys, "memory limit: %v", limit)
+	}
+}
+
+func Test_FindSetIntersectionWithOptions_TopKeysNone(t *testing.T) {
+	res, err := FindSetIntersection(context.Background(), feed([]string{"a", "a"}), feed([]string{"a"}))
+	assert.NoError(t, err)
+	assert.Nil(t, res.Files[0].Histogram)
+	assert.Nil(t, res.Files[0].TopKeys)
+	assert.Nil(t, res.TopOverlapKeys)
+
+	for _, opts := range []Options{
+		{TopKeys: -1},
+		{TopKeys: 1, Approximate: &Approximation{Precision: DefaultPrecision, SampleSize: DefaultSampleSize}},
+	} {
+		_, err := FindSetIntersectionWithOptions(context.Background(), opts, feed(nil), feed(nil))
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,130 @@
+package counter
+
+import (
+	"math"
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
+
+// limits of the precision of a HyperLogLog
+const (
+	MinPrecision = 4
+	MaxPrecision = 18
+)
+
+// HyperLogLog estimates the no. of distinct keys added to it using 2^precision registers of a byte each
+type HyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+// NewHyperLogLog creates an empty HyperLogLog, the standard error of its estimate is 1.04/sqrt(2^precision)
+func NewHyperLogLog(precision int) (*HyperLogLog, error) {
+	if precision < MinPrecision || precision > MaxPrecision {
+		return nil, errors.Errorf("precision must be between %v and %v, got: %v", MinPrecision, MaxPrecision, precision)
+	}
+
+	return &HyperLogLog{
+		precision: uint8(precision),
+		registers: make([]uint8, 1<<uint(precision)),
+	}, nil
+}
+
+// Add adds the hash of a key, see hashKey
+func (h *HyperLogLog) Add(hash uint64) {
+	index := hash >> (64 - h.precision)
+	// the index bits are shifted out, the rest is padded with ones so that the rank is at most 64 - precision + 1
+	rank := uint8(bits.LeadingZeros64(hash<<h.precision|1<<(h.precision-1))) + 1
+
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// Merge adds all the keys of the other HyperLogLog, which must have the same precision
+func (h *HyperLogLog) Merge(other *HyperLogLog) error {
+	if h.precision != other.precision {
+		return errors.Errorf("cannot merge HyperLogLog of precision %v into %v", other.precision, h.precision)
+	}
+
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+	return nil
+}
+
+// Count estimates the no. of distinct keys added
+func (h *HyperLogLog) Count() int {
+	m := float64(len(h.registers))
+
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha(len(h.registers)) * m * m / sum
+
+	// linear counting is more accurate while many registers are still empty
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return int(math.Round(estimate))
+}
+
+// RelativeError is the standard error of Count relative to the count
+func (h *HyperLogLog) RelativeError() float64 {
+	return 1.04 / math.Sqrt(float64(len(h.registers)))
+}
+
+// Precision is the precision the HyperLogLog was created with
+func (h *HyperLogLog) Precision() int {
+	return int(h.precision)
+}
+
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+// fnv-1a parameters
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// hashKey hashes a key for the sketches.
+// The hash is stable across runs so that sketches can be kept, fnv-1a is mixed further as its high bits are poorly spread
+func hashKey(key string) uint64 {
+	h := uint64(fnvOffset64)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= fnvPrime64
+	}
+	return mix64(h)
+}
+
+// mix64 is the finalizer of murmur3, every bit of the input affects every bit of the output
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,54 @@
+package counter
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HyperLogLog_Count(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 10000, 1000000} {
+		h, err := NewHyperLogLog(DefaultPrecision)
+		assert.NoError(t, err)
+
+		for i := 0; i < n; i++ {
+			h.Add(hashKey(strconv.Itoa(i)))
+			// duplicates are not counted again
+			h.Add(hashKey(strconv.Itoa(i)))
+		}
+
+		// within 3 standard errors
+		assert.InDelta(t, n, h.Count(), math.Max(3*h.RelativeError()*float64(n), 1), "%v keys", n)
+	}
+}
+
+func Test_HyperLogLog_Merge(t *testing.T) {
+	first, _ := NewHyperLogLog(12)
+	second, _ := NewHyperLogLog(12)
+	for i := 0; i < 20000; i++ {
+		first.Add(hashKey(strconv.Itoa(i)))
+		second.Add(hashKey(strconv.Itoa(i + 10000)))
+	}
+
+	assert.NoError(t, first.Merge(second))
+	assert.InDelta(t, 30000, first.Count(), 3*first.RelativeError()*30000)
+
+	other, _ := NewHyperLogLog(10)
+	assert.Error(t, first.Merge(other))
+}
+
+func Test_NewHyperLogLog_InvalidPrecision(t *testing.T) {
+	for _, p := range []int{MinPrecision - 1, MaxPrecision + 1} {
+		_, err := NewHyperLogLog(p)
+		assert.Error(t, err, p)
+	}
+}
+
+func Test_hashKey(t *testing.T) {
+	// the hash is kept in sketches so it must not change
+	assert.Equal(t, hashKey("abc"), hashKey("abc"))
+	assert.Equal(t, uint64(0x33ebaf9927cbc5bd), hashKey("abc"))
+	assert.NotEqual(t, hashKey("abc"), hashKey("abd"))
+}
@@ -1,109 +1,647 @@
 package counter
 
 import (
-	"errors"
+	"context"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
 	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tav/golly/log"
 )
 
-// FindSetIntersection finds counts the intersection of keys between two key streams.
-// Returns when both first and second channel is closed
-func FindSetIntersection(first <-chan string, second <-chan string) (IntersectionResult, error) {
-	if first == nil || second == nil {
-		return IntersectionResult{}, errors.New("input channel cannot nil")
+// Options configures how the intersection is computed
+type Options struct {
+	// MemoryLimit is the approximate no. of bytes the key counts of all inputs may take up
+	// before they are spilled to sorted runs on disk. The inputs are counted at once, each with an equal share of it,
+	// and a key counts for its length and 64 bytes more, see entryOverhead. Zero means no limit
+	MemoryLimit int64
+	// TempDir is the directory the sorted runs are written to. Defaults to the OS temp dir
+	TempDir string
+	// Visitor, when set, is called once for every distinct key across the inputs
+	Visitor KeyVisitor
+	// Approximate, when set, estimates the counts from sketches of the inputs instead, in place of the memory limit.
+	// Keys cannot be visited when approximating
+	Approximate *Approximation
+	// TopKeys, when more than 0, finds the histogram of how many times the keys of each input are repeated,
+	// along with the TopKeys most repeated keys of each input and the TopKeys keys adding the most to TotalOverlap.
+	// It cannot be used when approximating
+	TopKeys int
+	// Shards, when more than 1, splits the keys by their hash into that many shards that are counted and compared in parallel,
+	// for inputs that are faster to read than one core can count. Only used when counting in memory, without a memory limit
+	Shards int
+}
+
+// KeyVisitor is called with a key and the no. of times it was found in each input, in the order of the inputs.
+// The counts slice is reused between calls so it must not be held on to.
+// Returning an error stops the intersection
+type KeyVisitor func(key string, counts []int) error
+
+// FindSetIntersection finds counts the intersection of keys between two or more key streams.
+// Returns when all of the input channels are closed, or with the error of the context once it is done
+func FindSetIntersection(ctx context.Context, inputs ...<-chan string) (IntersectionResult, error) {
+	return FindSetIntersectionWithOptions(ctx, Options{}, inputs...)
+}
+
+// FindSetIntersectionWithOptions is FindSetIntersection with control over memory usage.
+// When a memory limit is set, the key counts that do not fit are sorted and written to disk
+// and the overlaps are found by merging the sorted runs instead
+func FindSetIntersectionWithOptions(ctx context.Context, opts Options, inputs ...<-chan string) (IntersectionResult, error) {
+	keyInputs := make([]Input, len(inputs))
+	for i, input := range inputs {
+		keyInputs[i] = Input{Keys: input}
+	}
+
+	return FindSetIntersectionOf(ctx, opts, keyInputs...)
+}
+
+// Input is an input of the intersection, either a channel of keys, a channel of batches of keys
+// or a sketch of them written by WriteSketch
+type Input struct {
+	Keys <-chan string
+	// Batches has the keys a batch at a time, there is one channel receive per batch instead of per key.
+	// The batches are not kept once counted
+	Batches <-chan []string
+	Sketch  *StoredSketch
+}
+
+// validate checks that the input has only one of its keys, batches of keys or sketch
+func (in Input) validate() error {
+	n := 0
+	for _, set := range []bool{in.Keys != nil, in.Batches != nil, in.Sketch != nil} {
+		if set {
+			n++
+		}
+	}
+
+	if n == 0 {
+		return errors.New("input channel cannot nil")
+	}
+	if n > 1 {
+		return errors.New("input can only have one of keys, batches of keys or a sketch")
+	}
+	return nil
+}
+
+// receive calls add with each key of the input until it is closed, or until add returns an error.
+// It blocks while waiting for keys so that slow inputs do not keep a core busy
+func (in Input) receive(ctx context.Context, add func(key string) error) error {
+	if in.Batches == nil {
+		for {
+			select {
+			case item, more := <-in.Keys:
+				if !more {
+					return nil
+				}
+				if err := add(item); err != nil {
+					return err
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	for {
+		select {
+		case batch, more := <-in.Batches:
+			if !more {
+				return nil
+			}
+			for _, item := range batch {
+				if err := add(item); err != nil {
+					return err
+				}
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// FindSetIntersectionOf is FindSetIntersectionWithOptions where an input can be a sketch in place of its keys.
+// The key counts of an exact sketch are merged from the file as they are sorted already, an approximate sketch
+// can only be used when approximating and the other inputs are then sketched with its Approximation
+func FindSetIntersectionOf(ctx context.Context, opts Options, inputs ...Input) (IntersectionResult, error) {
+	if len(inputs) < 2 {
+		return IntersectionResult{}, errors.Errorf("at least two inputs are needed, got: %v", len(inputs))
+	}
+
+	sorted := false
+	for _, input := range inputs {
+		if err := input.validate(); err != nil {
+			return IntersectionResult{}, err
+		}
+
+		if input.Sketch != nil {
+			if input.Sketch.Approximate != nil && opts.Approximate == nil {
+				return IntersectionResult{}, errors.Errorf("sketch is approximate, it can only be used when approximating: %s", input.Sketch.Path)
+			}
+			sorted = sorted || input.Sketch.Approximate == nil
+		}
+	}
+
+	if opts.MemoryLimit < 0 {
+		return IntersectionResult{}, errors.Errorf("invalid memory limit: %v", opts.MemoryLimit)
+	}
+
+	if opts.TopKeys < 0 {
+		return IntersectionResult{}, errors.Errorf("invalid no. of top keys: %v", opts.TopKeys)
+	}
+
+	if opts.Shards < 0 {
+		return IntersectionResult{}, errors.Errorf("invalid no. of shards: %v", opts.Shards)
+	}
+
+	if opts.Approximate != nil {
+		return findSetIntersectionApproximate(ctx, opts, inputs)
+	}
+
+	if opts.MemoryLimit > 0 || sorted {
+		return findSetIntersectionWithLimit(ctx, opts, inputs)
+	}
+
+	if opts.Shards > 1 {
+		return findSetIntersectionSharded(ctx, opts, inputs)
 	}
 
 	// find out if any channels are closed
-	return findSetIntersection(first, second)
+	return findSetIntersection(ctx, opts, inputs)
 }
 
-func findSetIntersection(first <-chan string, second <-chan string) (IntersectionResult, error) {
-	var firstKeys, secondKeys map[string]int
-	var firstTotalKeyCount, secondTotalKeyCount int
+func findSetIntersection(ctx context.Context, opts Options, inputs []Input) (IntersectionResult, error) {
+	keys := make([]map[string]int, len(inputs))
+	totalKeyCounts := make([]int, len(inputs))
+	errs := make([]error, len(inputs))
 
 	wg := sync.WaitGroup{}
-	wg.Add(2)
-	go func() {
-		firstKeys, firstTotalKeyCount = countKeys(first)
-		wg.Done()
-	}()
+	wg.Add(len(inputs))
+	for i, input := range inputs {
+		go func(i int, input Input) {
+			keys[i], totalKeyCounts[i], errs[i] = countKeys(ctx, input)
+			wg.Done()
+		}(i, input)
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return IntersectionResult{}, errors.Wrapf(err, "while counting keys of input %v", i+1)
+		}
+	}
+
+	// the keys are visited by one goroutine here, see findSetIntersectionSharded for overlaps found in parallel
+	t := newTally(len(keys))
+	f := newFrequencies(len(keys), opts.TopKeys)
+	if err := visitMaps(keys, withContext(ctx, withVisitor(withFrequencies(t.add, f), opts.Visitor))); err != nil {
+		return IntersectionResult{}, errors.Wrap(err, "while visiting keys")
+	}
+
+	result := t.result()
+	for i := range result.Files {
+		result.Files[i].KeyCount = totalKeyCounts[i]
+	}
+	result.setSimilarity()
+	f.set(&result)
+
+	return result, nil
+}
 
-	go func() {
-		secondKeys, secondTotalKeyCount = countKeys(second)
-		wg.Done()
+func findSetIntersectionWithLimit(ctx context.Context, opts Options, inputs []Input) (IntersectionResult, error) {
+	dir, err := ioutil.TempDir(opts.TempDir, "set-intersection-")
+	if err != nil {
+		return IntersectionResult{}, errors.Wrap(err, "unable to create directory for sorted runs")
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Errorf("unable to remove sorted runs: %s", dir)
+		}
 	}()
 
+	// each input gets an equal share of the budget, there is none when only sketches are sorted
+	limit := opts.MemoryLimit / int64(len(inputs))
+	if opts.MemoryLimit == 0 {
+		limit = math.MaxInt64
+	}
+
+	keys := make([]*spilledKeys, len(inputs))
+	errs := make([]error, len(inputs))
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(inputs))
+	for i, input := range inputs {
+		if input.Sketch != nil {
+			keys[i] = &spilledKeys{totalCount: input.Sketch.KeyCount, sketch: input.Sketch}
+			wg.Done()
+			continue
+		}
+
+		go func(i int, input Input) {
+			keys[i], errs[i] = countKeysWithLimit(ctx, input, limit, dir)
+			wg.Done()
+		}(i, input)
+	}
+
 	wg.Wait()
 
-	// distinctOverlap, totalOverlap := findOverlapsUsingWorkerPool(firstKeys, secondKeys, 1024)
-	distinctOverlap, totalOverlap := findOverlaps(firstKeys, secondKeys)
+	for i, err := range errs {
+		if err != nil {
+			return IntersectionResult{}, errors.Wrapf(err, "while counting keys of input %v", i+1)
+		}
+	}
 
-	result := IntersectionResult{
-		First: FileResult{
-			KeyCount:         firstTotalKeyCount,
-			DistinctKeyCount: len(firstKeys),
-		},
-		Second: FileResult{
-			KeyCount:         secondTotalKeyCount,
-			DistinctKeyCount: len(secondKeys),
-		},
-		TotalOverlap:    totalOverlap,
-		DistinctOverlap: distinctOverlap,
+	spilled := false
+	for _, k := range keys {
+		spilled = spilled || k.spilled()
+	}
+
+	var result IntersectionResult
+	f := newFrequencies(len(keys), opts.TopKeys)
+
+	if spilled {
+		iterators := make([]countIterator, 0, len(keys))
+		defer func() {
+			for _, it := range iterators {
+				if err := it.close(); err != nil {
+					log.Error(err.Error())
+				}
+			}
+		}()
+
+		// the runs of every input are open at once, so each input gets an equal share of maxFanIn. They are all sorted
+		// before any is opened, so that merging the runs of one input does not add to those the others have open
+		maxRuns := maxFanIn / len(keys)
+		for _, k := range keys {
+			if err := k.sortRuns(maxRuns); err != nil {
+				return IntersectionResult{}, err
+			}
+		}
+
+		for _, k := range keys {
+			it, err := k.iterator(maxRuns)
+			if err != nil {
+				return IntersectionResult{}, err
+			}
+			iterators = append(iterators, it)
+		}
+
+		t := newTally(len(keys))
+		if err := visitSorted(iterators, withContext(ctx, withVisitor(withFrequencies(t.add, f), opts.Visitor))); err != nil {
+			return IntersectionResult{}, errors.Wrap(err, "while merging sorted runs")
+		}
+		result = t.result()
+	} else {
+		// nothing was written to disk so the maps can be used as they are
+		counts := make([]map[string]int, len(keys))
+		for i, k := range keys {
+			counts[i] = k.counts
+		}
+
+		t := newTally(len(keys))
+		if err := visitMaps(counts, withContext(ctx, withVisitor(withFrequencies(t.add, f), opts.Visitor))); err != nil {
+			return IntersectionResult{}, errors.Wrap(err, "while visiting keys")
+		}
+		result = t.result()
+	}
+
+	for i, k := range keys {
+		result.Files[i].KeyCount = k.totalCount
 	}
+	result.setSimilarity()
+	f.set(&result)
 
 	return result, nil
 }
 
-func countKeys(input <-chan string) (map[string]int, int) {
+// countKeys counts the no. of times each key is found in the input until it is closed
+func countKeys(ctx context.Context, input Input) (map[string]int, int, error) {
 	res := make(map[string]int)
 	totalCount := 0
 
-	var noMore bool
-	for {
-		select {
-		case item, more := <-input:
-			if !more {
-				noMore = true
-				break
+	err := input.receive(ctx, func(item string) error {
+		res[item]++
+		totalCount++
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return res, totalCount, nil
+}
+
+func minCount(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// findOverlaps finds the overlaps between the key counts of every input.
+// KeyCount of the file results is left for the caller to fill in
+func findOverlaps(keys ...map[string]int) IntersectionResult {
+	t := newTally(len(keys))
+	// tallying never fails
+	_ = visitMaps(keys, t.add)
+	return t.result()
+}
+
+// withVisitor calls the optional visitor after the tally
+func withVisitor(tally KeyVisitor, visitor KeyVisitor) KeyVisitor {
+	if visitor == nil {
+		return tally
+	}
+
+	return func(key string, counts []int) error {
+		if err := tally(key, counts); err != nil {
+			return err
+		}
+		return visitor(key, counts)
+	}
+}
+
+// withFrequencies finds the frequencies of the keys after the tally, when they are wanted
+func withFrequencies(tally KeyVisitor, f *frequencies) KeyVisitor {
+	if f.top <= 0 {
+		return tally
+	}
+	return withVisitor(tally, f.add)
+}
+
+// contextCheckInterval is the no. of keys visited between checks of whether the context is done
+const contextCheckInterval = 1024
+
+// withContext stops the visit with the error of the context once it is done
+func withContext(ctx context.Context, visit KeyVisitor) KeyVisitor {
+	visited := 0
+	return func(key string, counts []int) error {
+		visited++
+		if visited%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
 			}
+		}
+		return visit(key, counts)
+	}
+}
+
+// visitMaps calls visit once for every distinct key across the maps with the count of the key in each map
+func visitMaps(keys []map[string]int, visit KeyVisitor) error {
+	counts := make([]int, len(keys))
 
-			if _, ok := res[item]; !ok {
-				res[item] = 0
+	for i, current := range keys {
+	nextKey:
+		for k := range current {
+			// already visited from an earlier map
+			for _, earlier := range keys[:i] {
+				if _, ok := earlier[k]; ok {
+					continue nextKey
+				}
+			}
+
+			for j := range keys {
+				counts[j] = keys[j][k]
+			}
+			if err := visit(k, counts); err != nil {
+				return err
 			}
-			res[item]++
-			totalCount++
-		default:
 		}
+	}
+
+	return nil
+}
+
+// tally adds up the overlaps of keys as they are visited
+type tally struct {
+	files []FileResult
+	pairs [][]Overlap
+	// pairTotals are the TotalOverlap of the pairs, which can be too large for an int
+	pairTotals      [][]overlapCount
+	totalOverlap    overlapCount
+	distinctOverlap int
+	distinctUnion   int
+}
 
-		if noMore {
-			break
+func newTally(n int) *tally {
+	pairs := make([][]Overlap, n)
+	pairTotals := make([][]overlapCount, n)
+	for i := range pairs {
+		pairs[i] = make([]Overlap, n)
+		pairTotals[i] = make([]overlapCount, n)
+	}
+
+	return &tally{
+		files:      make([]FileResult, n),
+		pairs:      pairs,
+		pairTotals: pairTotals,
+	}
+}
+
+func (t *tally) add(_ string, counts []int) error {
+	inAll := true
+	// index of the only input the key is in, -1 when in none yet, -2 when in more than one
+	onlyIn := -1
+
+	for i, c := range counts {
+		for j := i + 1; j < len(counts); j++ {
+			t.addPair(i, j, c, counts[j])
+		}
+
+		if c == 0 {
+			inAll = false
+			continue
+		}
+
+		t.files[i].DistinctKeyCount++
+		t.pairs[i][i].DistinctOverlap++
+		t.pairTotals[i][i].addMul(c, c)
+		addSaturating(&t.pairs[i][i].MultisetOverlap, &t.pairs[i][i].MultisetOverlapSaturated, c)
+		t.pairs[i][i].DistinctUnion++
+
+		if onlyIn == -1 {
+			onlyIn = i
+		} else {
+			onlyIn = -2
+		}
+	}
+
+	t.distinctUnion++
+
+	if onlyIn >= 0 {
+		addSaturating(&t.files[onlyIn].ExclusiveKeyCount, &t.files[onlyIn].ExclusiveKeyCountSaturated, counts[onlyIn])
+		t.files[onlyIn].DistinctExclusiveKeyCount++
+	}
+
+	if inAll {
+		t.distinctOverlap++
+		t.totalOverlap.addProduct(counts)
+	}
+
+	return nil
+}
+
+// merge adds the tally of other keys to this one
+func (t *tally) merge(other *tally) {
+	for i := range t.files {
+		t.files[i].DistinctKeyCount += other.files[i].DistinctKeyCount
+		addSaturating(&t.files[i].ExclusiveKeyCount, &t.files[i].ExclusiveKeyCountSaturated, other.files[i].ExclusiveKeyCount)
+		t.files[i].ExclusiveKeyCountSaturated = t.files[i].ExclusiveKeyCountSaturated || other.files[i].ExclusiveKeyCountSaturated
+		t.files[i].DistinctExclusiveKeyCount += other.files[i].DistinctExclusiveKeyCount
+
+		for j := range t.pairs[i] {
+			pair, otherPair := &t.pairs[i][j], other.pairs[i][j]
+			t.pairTotals[i][j].merge(other.pairTotals[i][j])
+			pair.DistinctOverlap += otherPair.DistinctOverlap
+			pair.DistinctDifference += otherPair.DistinctDifference
+			pair.DistinctUnion += otherPair.DistinctUnion
+			pair.DistinctSymmetricDifference += otherPair.DistinctSymmetricDifference
+			addSaturating(&pair.MultisetOverlap, &pair.MultisetOverlapSaturated, otherPair.MultisetOverlap)
+			pair.MultisetOverlapSaturated = pair.MultisetOverlapSaturated || otherPair.MultisetOverlapSaturated
 		}
 	}
-	return res, totalCount
+
+	t.totalOverlap.merge(other.totalOverlap)
+	t.distinctOverlap += other.distinctOverlap
+	t.distinctUnion += other.distinctUnion
 }
 
-func findOverlaps(firstKeys, secondKeys map[string]int) (int, int) {
-	distinctOverlaps := 0
-	totalOverlaps := 0
+// addPair tallies a key for the ith and jth input, given its count in each
+func (t *tally) addPair(i, j, first, second int) {
+	pair := &t.pairs[i][j]
+
+	switch {
+	case first > 0 && second > 0:
+		pair.DistinctOverlap++
+		t.pairTotals[i][j].addMul(first, second)
+		addSaturating(&pair.MultisetOverlap, &pair.MultisetOverlapSaturated, minCount(first, second))
+		pair.DistinctUnion++
+	case first > 0:
+		pair.DistinctDifference++
+		pair.DistinctSymmetricDifference++
+		pair.DistinctUnion++
+	case second > 0:
+		// the difference the other way round is kept in the lower half of the matrix
+		t.pairs[j][i].DistinctDifference++
+		pair.DistinctSymmetricDifference++
+		pair.DistinctUnion++
+	}
+}
 
-	for fk, fv := range firstKeys {
-		if sv, ok := secondKeys[fk]; ok {
-			distinctOverlaps++
-			totalOverlaps += fv * sv
+func (t *tally) result() IntersectionResult {
+	for i := range t.pairs {
+		for j := i; j < len(t.pairs); j++ {
+			t.pairs[i][j].TotalOverlap, t.pairs[i][j].BigTotalOverlap = t.pairTotals[i][j].value()
 		}
 	}
-	return distinctOverlaps, totalOverlaps
+
+	// only the upper half of the matrix is tallied, apart from the difference which is not symmetric
+	for i := range t.pairs {
+		for j := 0; j < i; j++ {
+			difference := t.pairs[i][j].DistinctDifference
+			t.pairs[i][j] = t.pairs[j][i]
+			t.pairs[i][j].DistinctDifference = difference
+		}
+	}
+
+	result := IntersectionResult{
+		Files:           t.files,
+		Pairs:           t.pairs,
+		DistinctOverlap: t.distinctOverlap,
+		DistinctUnion:   t.distinctUnion,
+	}
+	result.TotalOverlap, result.BigTotalOverlap = t.totalOverlap.value()
+
+	return result
 }
 
-// IntersectionResult represents result of intersection count
+// IntersectionResult represents result of intersection count, it can be serialized as json or yaml
 type IntersectionResult struct {
-	First           FileResult
-	Second          FileResult
-	TotalOverlap    int
-	DistinctOverlap int
+	// Files has the result of each input, in the order the inputs were passed in
+	Files []FileResult `json:"files" yaml:"files"`
+	// Pairs is the overlap between every two inputs, Pairs[i][j] being between the ith and jth input.
+	// Pairs[i][i] is the overlap of an input with itself
+	Pairs [][]Overlap `json:"pairs" yaml:"pairs"`
+	// TotalOverlap and DistinctOverlap are of the keys found in all of the inputs
+	TotalOverlap    int `json:"total_overlap" yaml:"total_overlap"`
+	DistinctOverlap int `json:"distinct_overlap" yaml:"distinct_overlap"`
+	// BigTotalOverlap is only set when TotalOverlap is too large for an int, it has the exact TotalOverlap
+	// and TotalOverlap is then kept at the largest int
+	BigTotalOverlap *big.Int `json:"big_total_overlap,omitempty" yaml:"big_total_overlap,omitempty"`
+	// DistinctUnion is the no. of distinct keys across all of the inputs
+	DistinctUnion int `json:"distinct_union" yaml:"distinct_union"`
+
+	// Approximate is true when the counts were estimated, see Options.Approximate.
+	// The exact value of an estimated count is then within its Error field of it about 95% of the time, the error is 0 when exact
+	Approximate          bool `json:"approximate,omitempty" yaml:"approximate,omitempty"`
+	TotalOverlapError    int  `json:"total_overlap_error,omitempty" yaml:"total_overlap_error,omitempty"`
+	DistinctOverlapError int  `json:"distinct_overlap_error,omitempty" yaml:"distinct_overlap_error,omitempty"`
+	DistinctUnionError   int  `json:"distinct_union_error,omitempty" yaml:"distinct_union_error,omitempty"`
+
+	// TopOverlapKeys are the keys adding the most to TotalOverlap, the most first. Only set with Options.TopKeys
+	TopOverlapKeys []OverlapKey `json:"top_overlap_keys,omitempty" yaml:"top_overlap_keys,omitempty"`
 }
 
 // FileResult represents result of a file key count
 type FileResult struct {
-	KeyCount         int
-	DistinctKeyCount int
+	KeyCount         int `json:"key_count" yaml:"key_count"`
+	DistinctKeyCount int `json:"distinct_key_count" yaml:"distinct_key_count"`
+	// ExclusiveKeyCount and DistinctExclusiveKeyCount are of the keys not found in any other input
+	ExclusiveKeyCount         int `json:"exclusive_key_count" yaml:"exclusive_key_count"`
+	DistinctExclusiveKeyCount int `json:"distinct_exclusive_key_count" yaml:"distinct_exclusive_key_count"`
+	// ExclusiveKeyCountSaturated is true when ExclusiveKeyCount is too large for an int, it is then kept at the largest int.
+	// When estimated, it is true when the estimate is from a sample too large for an int
+	ExclusiveKeyCountSaturated bool `json:"exclusive_key_count_saturated,omitempty" yaml:"exclusive_key_count_saturated,omitempty"`
+
+	// errors of the estimated counts, KeyCount is always exact
+	DistinctKeyCountError          int `json:"distinct_key_count_error,omitempty" yaml:"distinct_key_count_error,omitempty"`
+	ExclusiveKeyCountError         int `json:"exclusive_key_count_error,omitempty" yaml:"exclusive_key_count_error,omitempty"`
+	DistinctExclusiveKeyCountError int `json:"distinct_exclusive_key_count_error,omitempty" yaml:"distinct_exclusive_key_count_error,omitempty"`
+
+	// SkippedRows is the no. of malformed rows of the file that are skipped, their keys are not counted
+	SkippedRows int `json:"skipped_rows,omitempty" yaml:"skipped_rows,omitempty"`
+	// ExcludedKeyCount is the no. of null keys of the file that are left out, they are not in any of the counts.
+	// NullKeys counts them by their value when they are counted separately, the most found first
+	ExcludedKeyCount int            `json:"excluded_key_count,omitempty" yaml:"excluded_key_count,omitempty"`
+	NullKeys         []KeyFrequency `json:"null_keys,omitempty" yaml:"null_keys,omitempty"`
+
+	// Histogram counts the keys by how many times they are repeated, up to the bucket of the most repeated key.
+	// TopKeys are the keys repeated the most, the most first. Both are only set with Options.TopKeys
+	Histogram []HistogramBucket `json:"histogram,omitempty" yaml:"histogram,omitempty"`
+	TopKeys   []KeyFrequency    `json:"top_keys,omitempty" yaml:"top_keys,omitempty"`
+}
+
+// Overlap represents the overlap of keys between two inputs
+type Overlap struct {
+	TotalOverlap    int `json:"total_overlap" yaml:"total_overlap"`
+	DistinctOverlap int `json:"distinct_overlap" yaml:"distinct_overlap"`
+	// BigTotalOverlap is only set when TotalOverlap is too large for an int, see IntersectionResult.BigTotalOverlap
+	BigTotalOverlap *big.Int `json:"big_total_overlap,omitempty" yaml:"big_total_overlap,omitempty"`
+	// DistinctDifference is the no. of distinct keys in the first input but not in the second,
+	// ie. Pairs[i][j].DistinctDifference is of the keys only in the ith input
+	DistinctDifference int `json:"distinct_difference" yaml:"distinct_difference"`
+	// DistinctUnion is the no. of distinct keys in either of the inputs
+	DistinctUnion int `json:"distinct_union" yaml:"distinct_union"`
+	// DistinctSymmetricDifference is the no. of distinct keys in exactly one of the inputs
+	DistinctSymmetricDifference int `json:"distinct_symmetric_difference" yaml:"distinct_symmetric_difference"`
+	// MultisetOverlap counts each key found in both inputs the lesser of the no. of times it is found in either,
+	// ie. the size of the intersection of the keys of the inputs as multisets
+	MultisetOverlap int `json:"multiset_overlap" yaml:"multiset_overlap"`
+	// MultisetOverlapSaturated is true when MultisetOverlap is too large for an int, see FileResult.ExclusiveKeyCountSaturated
+	MultisetOverlapSaturated bool `json:"multiset_overlap_saturated,omitempty" yaml:"multiset_overlap_saturated,omitempty"`
+
+	// DistinctSimilarity is of the distinct keys of the inputs,
+	// WeightedSimilarity of all of their keys with each counted as many times as it is found
+	DistinctSimilarity Similarity `json:"distinct_similarity" yaml:"distinct_similarity"`
+	WeightedSimilarity Similarity `json:"weighted_similarity" yaml:"weighted_similarity"`
+
+	// errors of the estimated counts
+	TotalOverlapError                int `json:"total_overlap_error,omitempty" yaml:"total_overlap_error,omitempty"`
+	DistinctOverlapError             int `json:"distinct_overlap_error,omitempty" yaml:"distinct_overlap_error,omitempty"`
+	DistinctDifferenceError          int `json:"distinct_difference_error,omitempty" yaml:"distinct_difference_error,omitempty"`
+	DistinctUnionError               int `json:"distinct_union_error,omitempty" yaml:"distinct_union_error,omitempty"`
+	DistinctSymmetricDifferenceError int `json:"distinct_symmetric_difference_error,omitempty" yaml:"distinct_symmetric_difference_error,omitempty"`
+	MultisetOverlapError             int `json:"multiset_overlap_error,omitempty" yaml:"multiset_overlap_error,omitempty"`
 }
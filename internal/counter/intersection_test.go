@@ -1,9 +1,14 @@
 package counter
 
 import (
+	"context"
+	"errors"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
 )
 
 const (
@@ -13,33 +18,33 @@ const (
 )
 
 func Test_findOverlaps_Empty(t *testing.T) {
-	distinct, total := findOverlaps(map[string]int{}, map[string]int{})
-	assert.Equal(t, 0, distinct)
-	assert.Equal(t, 0, total)
+	res := findOverlaps(map[string]int{}, map[string]int{})
+	assert.Equal(t, 0, res.DistinctOverlap)
+	assert.Equal(t, 0, res.TotalOverlap)
 }
 
 func Test_findOverlaps(t *testing.T) {
-	distinct, total := findOverlaps(map[string]int{
+	res := findOverlaps(map[string]int{
 		"a": 1,
 	}, map[string]int{
 		"a": 1,
 	})
-	assert.Equal(t, 1, distinct)
-	assert.Equal(t, 1, total)
+	assert.Equal(t, 1, res.DistinctOverlap)
+	assert.Equal(t, 1, res.TotalOverlap)
 }
 
 func Test_findOverlaps_NoOverlap(t *testing.T) {
-	distinct, total := findOverlaps(map[string]int{
+	res := findOverlaps(map[string]int{
 		"a": 1,
 	}, map[string]int{
 		"b": 1,
 	})
-	assert.Equal(t, 0, distinct)
-	assert.Equal(t, 0, total)
+	assert.Equal(t, 0, res.DistinctOverlap)
+	assert.Equal(t, 0, res.TotalOverlap)
 }
 
 func Test_findOverlaps_MultipleOverlaps(t *testing.T) {
-	distinct, total := findOverlaps(map[string]int{
+	res := findOverlaps(map[string]int{
 		"a": 1,
 		"b": 2,
 		"c": 3,
@@ -50,8 +55,8 @@ func Test_findOverlaps_MultipleOverlaps(t *testing.T) {
 		"c": 1,
 		"e": 2,
 	})
-	assert.Equal(t, 3, distinct)
-	assert.Equal(t, 10, total)
+	assert.Equal(t, 3, res.DistinctOverlap)
+	assert.Equal(t, 10, res.TotalOverlap)
 }
 
 func Test_FindSetIntersection(t *testing.T) {
@@ -83,27 +88,157 @@ func Test_FindSetIntersection(t *testing.T) {
 		second <- "y"
 	}()
 
-	res, err := FindSetIntersection(first, second)
+	res, err := FindSetIntersection(context.Background(), first, second)
 	assert.NoError(t, err)
+
+	same := Similarity{Jaccard: 1, ContainmentOfFirst: 1, ContainmentOfSecond: 1, OverlapCoefficient: 1, Dice: 1}
 	assert.Equal(t, IntersectionResult{
-		First: FileResult{
-			KeyCount:         8,
-			DistinctKeyCount: 6,
+		Files: []FileResult{
+			{
+				KeyCount:                  8,
+				DistinctKeyCount:          6,
+				ExclusiveKeyCount:         2,
+				DistinctExclusiveKeyCount: 2,
+			},
+			{
+				KeyCount:                  9,
+				DistinctKeyCount:          6,
+				ExclusiveKeyCount:         2,
+				DistinctExclusiveKeyCount: 2,
+			},
 		},
-		Second: FileResult{
-			KeyCount:         9,
-			DistinctKeyCount: 6,
+		Pairs: [][]Overlap{
+			{
+				{DistinctOverlap: 6, TotalOverlap: 12, DistinctUnion: 6, MultisetOverlap: 8, DistinctSimilarity: same, WeightedSimilarity: same},
+				{
+					DistinctOverlap: 4, TotalOverlap: 11, DistinctDifference: 2, DistinctUnion: 8, DistinctSymmetricDifference: 4, MultisetOverlap: 5,
+					DistinctSimilarity: Similarity{Jaccard: 0.5, ContainmentOfFirst: 4.0 / 6, ContainmentOfSecond: 4.0 / 6, OverlapCoefficient: 4.0 / 6, Dice: 8.0 / 12},
+					WeightedSimilarity: Similarity{Jaccard: 5.0 / 12, ContainmentOfFirst: 5.0 / 8, ContainmentOfSecond: 5.0 / 9, OverlapCoefficient: 5.0 / 8, Dice: 10.0 / 17},
+				},
+			},
+			{
+				{
+					DistinctOverlap: 4, TotalOverlap: 11, DistinctDifference: 2, DistinctUnion: 8, DistinctSymmetricDifference: 4, MultisetOverlap: 5,
+					DistinctSimilarity: Similarity{Jaccard: 0.5, ContainmentOfFirst: 4.0 / 6, ContainmentOfSecond: 4.0 / 6, OverlapCoefficient: 4.0 / 6, Dice: 8.0 / 12},
+					WeightedSimilarity: Similarity{Jaccard: 5.0 / 12, ContainmentOfFirst: 5.0 / 9, ContainmentOfSecond: 5.0 / 8, OverlapCoefficient: 5.0 / 8, Dice: 10.0 / 17},
+				},
+				{DistinctOverlap: 6, TotalOverlap: 17, DistinctUnion: 6, MultisetOverlap: 9, DistinctSimilarity: same, WeightedSimilarity: same},
+			},
 		},
 		DistinctOverlap: 4,
 		TotalOverlap:    11,
+		DistinctUnion:   8,
 	}, res)
 }
 
 func Test_FindSetIntersection_Nil(t *testing.T) {
-	_, err := FindSetIntersection(nil, nil)
+	_, err := FindSetIntersection(context.Background(), nil, nil)
 	assert.Error(t, err)
 }
 
+func Test_FindSetIntersection_Canceled(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	for _, limit := range []int64{0, 1 << 20} {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		// the inputs are never closed
+		first := make(chan string, 1)
+		first <- "a"
+		second := make(chan string)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+
+		_, err := FindSetIntersectionWithOptions(ctx, Options{MemoryLimit: limit, TempDir: t.TempDir()}, first, second)
+		assert.True(t, errors.Is(err, context.Canceled), err)
+	}
+}
+
+func Test_FindSetIntersection_SingleInput(t *testing.T) {
+	_, err := FindSetIntersection(context.Background(), feed([]string{"a"}))
+	assert.Error(t, err)
+}
+
+func Test_FindSetIntersection_MultipleInputs(t *testing.T) {
+	res, err := FindSetIntersection(context.Background(),
+		feed([]string{"a", "b", "c", "c"}),
+		feed([]string{"a", "c", "d"}),
+		feed([]string{"a", "a", "c", "d", "e"}),
+	)
+	assert.NoError(t, err)
+	expected := IntersectionResult{
+		Files: []FileResult{
+			{KeyCount: 4, DistinctKeyCount: 3, ExclusiveKeyCount: 1, DistinctExclusiveKeyCount: 1},
+			{KeyCount: 3, DistinctKeyCount: 3},
+			{KeyCount: 5, DistinctKeyCount: 4, ExclusiveKeyCount: 1, DistinctExclusiveKeyCount: 1},
+		},
+		Pairs: [][]Overlap{
+			{
+				{DistinctOverlap: 3, TotalOverlap: 6, DistinctUnion: 3, MultisetOverlap: 4},
+				{DistinctOverlap: 2, TotalOverlap: 3, DistinctDifference: 1, DistinctUnion: 4, DistinctSymmetricDifference: 2, MultisetOverlap: 2},
+				{DistinctOverlap: 2, TotalOverlap: 4, DistinctDifference: 1, DistinctUnion: 5, DistinctSymmetricDifference: 3, MultisetOverlap: 2},
+			},
+			{
+				{DistinctOverlap: 2, TotalOverlap: 3, DistinctDifference: 1, DistinctUnion: 4, DistinctSymmetricDifference: 2, MultisetOverlap: 2},
+				{DistinctOverlap: 3, TotalOverlap: 3, DistinctUnion: 3, MultisetOverlap: 3},
+				{DistinctOverlap: 3, TotalOverlap: 4, DistinctUnion: 4, DistinctSymmetricDifference: 1, MultisetOverlap: 3},
+			},
+			{
+				{DistinctOverlap: 2, TotalOverlap: 4, DistinctDifference: 2, DistinctUnion: 5, DistinctSymmetricDifference: 3, MultisetOverlap: 2},
+				{DistinctOverlap: 3, TotalOverlap: 4, DistinctDifference: 1, DistinctUnion: 4, DistinctSymmetricDifference: 1, MultisetOverlap: 3},
+				{DistinctOverlap: 4, TotalOverlap: 7, DistinctUnion: 4, MultisetOverlap: 5},
+			},
+		},
+		// a: 1 * 1 * 2, c: 2 * 1 * 1
+		DistinctOverlap: 2,
+		TotalOverlap:    4,
+		DistinctUnion:   5,
+	}
+	expected.setSimilarity()
+	assert.Equal(t, expected, res)
+}
+
+func Test_FindSetIntersectionWithOptions_Visitor(t *testing.T) {
+	for _, limit := range []int64{0, 1} {
+		visited := map[string][]int{}
+		_, err := FindSetIntersectionWithOptions(context.Background(), Options{
+			MemoryLimit: limit,
+			TempDir:     t.TempDir(),
+			Visitor: func(key string, counts []int) error {
+				_, ok := visited[key]
+				assert.False(t, ok, "key visited more than once: %s", key)
+				visited[key] = append([]int{}, counts...)
+				return nil
+			},
+		}, feed([]string{"a", "b", "b"}), feed([]string{"b", "c"}))
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]int{
+			"a": {1, 0},
+			"b": {2, 1},
+			"c": {0, 1},
+		}, visited, "memory limit: %v", limit)
+	}
+}
+
+func Test_FindSetIntersectionWithOptions_VisitorError(t *testing.T) {
+	for _, limit := range []int64{0, 1} {
+		calls := 0
+		_, err := FindSetIntersectionWithOptions(context.Background(), Options{
+			MemoryLimit: limit,
+			TempDir:     t.TempDir(),
+			Visitor: func(key string, counts []int) error {
+				calls++
+				return errors.New("visitor failed")
+			},
+		}, feed([]string{"a", "b"}), feed([]string{"b", "c"}))
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	}
+}
+
 func Test_FindSetIntersection_Empty(t *testing.T) {
 	first := make(chan string, bufferSize)
 	second := make(chan string, bufferSize)
@@ -111,17 +246,20 @@ func Test_FindSetIntersection_Empty(t *testing.T) {
 	go close(first)
 	go close(second)
 
-	res, err := FindSetIntersection(first, second)
+	res, err := FindSetIntersection(context.Background(), first, second)
 	assert.NoError(t, err)
 	assert.Equal(t, IntersectionResult{
-		First: FileResult{
-			KeyCount:         0,
-			DistinctKeyCount: 0,
-		},
-		Second: FileResult{
-			KeyCount:         0,
-			DistinctKeyCount: 0,
+		Files: []FileResult{
+			{
+				KeyCount:         0,
+				DistinctKeyCount: 0,
+			},
+			{
+				KeyCount:         0,
+				DistinctKeyCount: 0,
+			},
 		},
+		Pairs:           [][]Overlap{{{}, {}}, {{}, {}}},
 		DistinctOverlap: 0,
 		TotalOverlap:    0,
 	}, res)
@@ -133,17 +271,20 @@ func Test_FindSetIntersection_ClosedChannel(t *testing.T) {
 	close(first)
 	close(second)
 
-	res, err := FindSetIntersection(first, second)
+	res, err := FindSetIntersection(context.Background(), first, second)
 	assert.NoError(t, err)
 	assert.Equal(t, IntersectionResult{
-		First: FileResult{
-			KeyCount:         0,
-			DistinctKeyCount: 0,
-		},
-		Second: FileResult{
-			KeyCount:         0,
-			DistinctKeyCount: 0,
+		Files: []FileResult{
+			{
+				KeyCount:         0,
+				DistinctKeyCount: 0,
+			},
+			{
+				KeyCount:         0,
+				DistinctKeyCount: 0,
+			},
 		},
+		Pairs:           [][]Overlap{{{}, {}}, {{}, {}}},
 		DistinctOverlap: 0,
 		TotalOverlap:    0,
 	}, res)
@@ -162,7 +303,7 @@ func Benchmark_findOverlaps(b *testing.B) {
 			input2[getRandomString(3)] = i
 		}
 
-		_, _ = findOverlaps(input1, input2)
+		_ = findOverlaps(input1, input2)
 	}
 }
 
@@ -187,6 +328,56 @@ func Benchmark_FindSetIntersection(b *testing.B) {
 			}
 		}()
 
-		_, _ = FindSetIntersection(first, second)
+		_, _ = FindSetIntersection(context.Background(), first, second)
+	}
+}
+
+// slowInputBatch is the no. of keys a slow input sends between waits
+const slowInputBatch = 1024
+
+// benchmarkCPUPerKey runs the intersection of inputs of rowCount keys each and reports the cpu time per key.
+// delay is how long each producer waits after every slowInputBatch keys, like a reader on a slow mount
+func benchmarkCPUPerKey(b *testing.B, delay time.Duration) {
+	keys := make([]string, rowCount)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i % (rowCount / 2))
 	}
+
+	produce := func(input chan<- string) {
+		defer close(input)
+		for i, k := range keys {
+			if delay > 0 && i%slowInputBatch == 0 {
+				time.Sleep(delay)
+			}
+			input <- k
+		}
+	}
+
+	startCPU, cpuOk := processCPUTime()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		first := make(chan string, bufferSize)
+		second := make(chan string, bufferSize)
+		go produce(first)
+		go produce(second)
+
+		if _, err := FindSetIntersection(context.Background(), first, second); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.StopTimer()
+	if endCPU, ok := processCPUTime(); ok && cpuOk {
+		b.ReportMetric(float64(endCPU-startCPU)/float64(b.N*2*rowCount), "cpu-ns/key")
+	}
+}
+
+func Benchmark_FindSetIntersection_CPUPerKey(b *testing.B) {
+	benchmarkCPUPerKey(b, 0)
+}
+
+// the cpu time per key of a slow input should be about that of a fast one, as waiting for keys costs nothing
+func Benchmark_FindSetIntersection_CPUPerKey_SlowInput(b *testing.B) {
+	benchmarkCPUPerKey(b, time.Millisecond)
 }
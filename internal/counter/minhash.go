@@ -0,0 +1,119 @@
+package counter
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// MinHash keeps the keys with the smallest hashes along with the no. of times each was added.
+// As the hashes are random this is a uniform sample of the distinct keys, one that is the same for every input,
+// so the overlaps of inputs can be estimated from the share of the sample of their union found in each of them
+type MinHash struct {
+	size   int
+	counts map[uint64]int
+	// largest is a max heap of the hashes in counts, to find the one to drop when full
+	largest hashHeap
+	// dropped is true once a hash was left out, either dropped for a smaller one or not kept at all
+	dropped bool
+}
+
+// NewMinHash creates an empty MinHash that keeps up to size hashes
+func NewMinHash(size int) (*MinHash, error) {
+	if size <= 0 {
+		return nil, errors.Errorf("minhash size must be more than 0, got: %v", size)
+	}
+
+	return &MinHash{
+		size:   size,
+		counts: make(map[uint64]int),
+	}, nil
+}
+
+// Add adds the hash of a key, see hashKey.
+// Once a hash is dropped for a smaller one it can never come back, so the count of a hash that is kept is exact
+func (m *MinHash) Add(hash uint64) {
+	m.add(hash, 1)
+}
+
+// add adds the hash of a key count times
+func (m *MinHash) add(hash uint64, count int) {
+	if _, ok := m.counts[hash]; ok {
+		m.counts[hash] += count
+		return
+	}
+
+	if len(m.counts) < m.size {
+		m.counts[hash] = count
+		heap.Push(&m.largest, hash)
+		return
+	}
+
+	m.dropped = true
+	if hash >= m.largest[0] {
+		return
+	}
+
+	delete(m.counts, m.largest[0])
+	m.largest[0] = hash
+	heap.Fix(&m.largest, 0)
+	m.counts[hash] = count
+}
+
+// Dropped is true once the MinHash has left out a hash, until then it has every distinct key that was added,
+// even when it has as many as its size
+func (m *MinHash) Dropped() bool {
+	return m.dropped
+}
+
+// Len is the no. of hashes kept
+func (m *MinHash) Len() int {
+	return len(m.counts)
+}
+
+// Size is the no. of hashes the MinHash keeps
+func (m *MinHash) Size() int {
+	return m.size
+}
+
+// count is the no. of times the hash was added, 0 when it is not kept
+func (m *MinHash) count(hash uint64) int {
+	return m.counts[hash]
+}
+
+// unionSample returns the smallest hashes of the union of the inputs, up to the size of the MinHash,
+// and whether any were left out. A hash that is among them and in an input is also kept by the MinHash of that input
+func unionSample(sketches []*MinHash) ([]uint64, bool) {
+	seen := make(map[uint64]bool)
+	for _, s := range sketches {
+		for h := range s.counts {
+			seen[h] = true
+		}
+	}
+
+	hashes := make([]uint64, 0, len(seen))
+	for h := range seen {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+
+	if size := sketches[0].size; len(hashes) > size {
+		return hashes[:size], true
+	}
+	return hashes, false
+}
+
+// hashHeap is a max heap of hashes
+type hashHeap []uint64
+
+func (h hashHeap) Len() int            { return len(h) }
+func (h hashHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h hashHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *hashHeap) Push(x interface{}) { *h = append(*h, x.(uint64)) }
+func (h *hashHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,75 @@
+package counter
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MinHash_KeepsSmallest(t *testing.T) {
+	m, err := NewMinHash(3)
+	assert.NoError(t, err)
+
+	for _, h := range []uint64{50, 10, 40, 10, 30, 20, 60, 20, 20} {
+		m.Add(h)
+	}
+
+	assert.True(t, m.Dropped())
+	assert.Equal(t, 3, m.Len())
+	assert.Equal(t, map[uint64]int{10: 2, 20: 3, 30: 1}, m.counts)
+	// dropped hashes do not come back
+	m.Add(40)
+	assert.Equal(t, 0, m.count(40))
+}
+
+func Test_MinHash_NotFull(t *testing.T) {
+	m, _ := NewMinHash(3)
+	m.Add(1)
+	m.Add(1)
+
+	assert.False(t, m.Dropped())
+	assert.Equal(t, 1, m.Len())
+	assert.Equal(t, 2, m.count(1))
+}
+
+func Test_MinHash_ExactlySize(t *testing.T) {
+	m, _ := NewMinHash(3)
+	for _, h := range []uint64{30, 10, 20, 10} {
+		m.Add(h)
+	}
+
+	// as many hashes as the size, but none left out
+	assert.False(t, m.Dropped())
+	assert.Equal(t, 3, m.Len())
+
+	// a larger hash is left out even though it is not kept
+	m.Add(40)
+	assert.True(t, m.Dropped())
+	assert.Equal(t, map[uint64]int{10: 2, 20: 1, 30: 1}, m.counts)
+}
+
+func Test_unionSample(t *testing.T) {
+	first, _ := NewMinHash(3)
+	second, _ := NewMinHash(3)
+	for _, h := range []uint64{5, 1, 9, 7} {
+		first.Add(h)
+	}
+	for _, h := range []uint64{2, 5, 8} {
+		second.Add(h)
+	}
+
+	sample, dropped := unionSample([]*MinHash{first, second})
+	assert.True(t, sort.SliceIsSorted(sample, func(i, j int) bool { return sample[i] < sample[j] }))
+	assert.Equal(t, []uint64{1, 2, 5}, sample)
+	assert.True(t, dropped)
+
+	sample, dropped = unionSample([]*MinHash{second, second})
+	assert.Equal(t, []uint64{2, 5, 8}, sample)
+	assert.False(t, dropped)
+}
+
+func Test_NewMinHash_InvalidSize(t *testing.T) {
+	_, err := NewMinHash(0)
+	assert.Error(t, err)
+}
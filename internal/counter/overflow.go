@@ -0,0 +1,125 @@
+package counter
+
+import (
+	"math/big"
+	"math/bits"
+)
+
+// maxInt is the largest int, a count too large for it is kept at maxInt
+const maxInt = int(^uint(0) >> 1)
+
+// mulCounts is a * b, ok is false when it is too large for an int. Counts are never negative
+func mulCounts(a, b int) (int, bool) {
+	hi, lo := bits.Mul64(uint64(a), uint64(b))
+	if hi != 0 || lo > uint64(maxInt) {
+		return 0, false
+	}
+	return int(lo), true
+}
+
+// addCounts is a + b, ok is false when it is too large for an int and the sum is then kept at maxInt. Counts are never negative
+func addCounts(a, b int) (int, bool) {
+	if a > maxInt-b {
+		return maxInt, false
+	}
+	return a + b, true
+}
+
+// addSaturating adds n to the count, setting saturated once the count is kept at maxInt
+func addSaturating(count *int, saturated *bool, n int) {
+	var ok bool
+	if *count, ok = addCounts(*count, n); !ok {
+		*saturated = true
+	}
+}
+
+// squareCount is count * count, kept at maxInt when it is too large for an int
+func squareCount(count int) int {
+	if square, ok := mulCounts(count, count); ok {
+		return square
+	}
+	return maxInt
+}
+
+// productOf is the product of the counts, ok is false when it is too large for an int
+func productOf(counts []int) (int, bool) {
+	product := 1
+	for _, c := range counts {
+		var ok bool
+		if product, ok = mulCounts(product, c); !ok {
+			return 0, false
+		}
+	}
+	return product, true
+}
+
+// bigProductOf is the product of the counts, however large
+func bigProductOf(counts []int) *big.Int {
+	product := big.NewInt(1)
+	for _, c := range counts {
+		product.Mul(product, big.NewInt(int64(c)))
+	}
+	return product
+}
+
+// overlapCount adds up the products of the counts of keys. It is an int until the sum is too large for one,
+// from then on it is a big.Int, so that a total overlap never wraps around
+type overlapCount struct {
+	n   int
+	big *big.Int
+}
+
+// addProduct adds the product of the counts
+func (o *overlapCount) addProduct(counts []int) {
+	if product, ok := productOf(counts); ok {
+		o.add(product)
+		return
+	}
+	o.addBig(bigProductOf(counts))
+}
+
+// addMul adds a * b
+func (o *overlapCount) addMul(a, b int) {
+	if product, ok := mulCounts(a, b); ok {
+		o.add(product)
+		return
+	}
+	o.addBig(new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(int64(b))))
+}
+
+// add adds n, which is not negative
+func (o *overlapCount) add(n int) {
+	if o.big == nil && o.n <= maxInt-n {
+		o.n += n
+		return
+	}
+	o.addBig(big.NewInt(int64(n)))
+}
+
+func (o *overlapCount) addBig(n *big.Int) {
+	if o.big == nil {
+		o.big = big.NewInt(int64(o.n))
+	}
+	o.big.Add(o.big, n)
+}
+
+// merge adds the sum of other
+func (o *overlapCount) merge(other overlapCount) {
+	if other.big != nil {
+		o.addBig(other.big)
+		return
+	}
+	o.add(other.n)
+}
+
+// value returns the sum when it fits in an int. When it does not, the int is maxInt and the sum is returned as a big.Int
+func (o overlapCount) value() (int, *big.Int) {
+	if o.big == nil {
+		return o.n, nil
+	}
+
+	if o.big.IsInt64() && o.big.Int64() <= int64(maxInt) {
+		return int(o.big.Int64()), nil
+	}
+	return maxInt, new(big.Int).Set(o.big)
+}
@@ -0,0 +1,191 @@
+package counter
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_mulCounts(t *testing.T) {
+	product, ok := mulCounts(3, 4)
+	assert.True(t, ok)
+	assert.Equal(t, 12, product)
+
+	product, ok = mulCounts(0, math.MaxInt64)
+	assert.True(t, ok)
+	assert.Equal(t, 0, product)
+
+	product, ok = mulCounts(1, math.MaxInt64)
+	assert.True(t, ok)
+	assert.Equal(t, math.MaxInt64, product)
+
+	_, ok = mulCounts(2, math.MaxInt64/2+1)
+	assert.False(t, ok)
+
+	_, ok = mulCounts(math.MaxInt64, math.MaxInt64)
+	assert.False(t, ok)
+}
+
+func Test_addCounts(t *testing.T) {
+	sum, ok := addCounts(3, 4)
+	assert.Equal(t, 7, sum)
+	assert.True(t, ok)
+
+	sum, ok = addCounts(math.MaxInt64-1, 1)
+	assert.Equal(t, math.MaxInt64, sum)
+	assert.True(t, ok)
+
+	sum, ok = addCounts(math.MaxInt64, math.MaxInt64)
+	assert.Equal(t, math.MaxInt64, sum)
+	assert.False(t, ok)
+}
+
+func Test_squareCount(t *testing.T) {
+	assert.Equal(t, 9, squareCount(3))
+	assert.Equal(t, 3037000499*3037000499, squareCount(3037000499))
+	assert.Equal(t, math.MaxInt64, squareCount(3037000500))
+}
+
+func Test_tally_SquaresDoNotWrap(t *testing.T) {
+	// the squares of the counts of keys in the sample, as tallied for the variance of an estimate
+	square := squareCount(4000000000)
+	squares := newTally(2)
+	assert.NoError(t, squares.add("a", []int{square, 0}))
+	assert.NoError(t, squares.add("b", []int{square, 0}))
+	assert.NoError(t, squares.add("c", []int{square, square}))
+
+	res := squares.result()
+	assert.Equal(t, math.MaxInt64, res.Files[0].ExclusiveKeyCount)
+	assert.True(t, res.Files[0].ExclusiveKeyCountSaturated)
+	assert.False(t, res.Files[1].ExclusiveKeyCountSaturated)
+	assert.Equal(t, math.MaxInt64, res.Pairs[0][1].MultisetOverlap)
+	assert.False(t, res.Pairs[0][1].MultisetOverlapSaturated)
+	assert.Equal(t, math.MaxInt64, res.Pairs[0][0].MultisetOverlap)
+	assert.True(t, res.Pairs[0][0].MultisetOverlapSaturated)
+	assert.Equal(t, math.MaxInt64, res.Pairs[0][1].TotalOverlap)
+}
+
+func Test_tally_MergeSaturated(t *testing.T) {
+	// a saturated count stays flagged when merged with a tally of no keys only in the input
+	first, second := newTally(2), newTally(2)
+	assert.NoError(t, first.add("a", []int{math.MaxInt64, 0}))
+	assert.NoError(t, first.add("b", []int{1, 0}))
+	assert.NoError(t, second.add("c", []int{0, 1}))
+
+	second.merge(first)
+	res := second.result()
+	assert.Equal(t, math.MaxInt64, res.Files[0].ExclusiveKeyCount)
+	assert.True(t, res.Files[0].ExclusiveKeyCountSaturated)
+	assert.False(t, res.Files[1].ExclusiveKeyCountSaturated)
+	assert.True(t, res.Pairs[0][0].MultisetOverlapSaturated)
+	assert.False(t, res.Pairs[0][1].MultisetOverlapSaturated)
+}
+
+func Test_overlapCount(t *testing.T) {
+	o := overlapCount{}
+	o.add(math.MaxInt64 - 1)
+	n, big := o.value()
+	assert.Equal(t, math.MaxInt64-1, n)
+	assert.Nil(t, big)
+
+	o.add(1)
+	n, big = o.value()
+	assert.Equal(t, math.MaxInt64, n)
+	assert.Nil(t, big)
+
+	o.add(1)
+	n, big = o.value()
+	assert.Equal(t, math.MaxInt64, n)
+	assert.Equal(t, "9223372036854775808", big.String())
+
+	// the value returned is not changed by adding more
+	o.addMul(2, 3)
+	assert.Equal(t, "9223372036854775808", big.String())
+
+	n, big = o.value()
+	assert.Equal(t, math.MaxInt64, n)
+	assert.Equal(t, "9223372036854775814", big.String())
+}
+
+func Test_findOverlaps_SumOverflows(t *testing.T) {
+	// each product fits in an int64, their sum does not
+	count := 3037000499 // floor(sqrt(math.MaxInt64))
+	res := findOverlaps(map[string]int{
+		"a": count,
+		"b": count,
+	}, map[string]int{
+		"a": count,
+		"b": count,
+	})
+
+	expected := new(big.Int).Mul(big.NewInt(int64(count)), big.NewInt(int64(count)))
+	expected.Mul(expected, big.NewInt(2))
+
+	assert.Equal(t, 2, res.DistinctOverlap)
+	assert.Equal(t, math.MaxInt64, res.TotalOverlap)
+	assert.Equal(t, expected, res.BigTotalOverlap)
+	assert.Equal(t, expected, res.Pairs[0][1].BigTotalOverlap)
+	assert.Equal(t, expected, res.Pairs[1][0].BigTotalOverlap)
+	assert.Equal(t, expected, res.Pairs[0][0].BigTotalOverlap)
+	assert.Equal(t, 2*count, res.Pairs[0][1].MultisetOverlap)
+}
+
+func Test_findOverlaps_ProductOverflows(t *testing.T) {
+	res := findOverlaps(map[string]int{
+		"a": 1 << 40,
+		"b": 2,
+	}, map[string]int{
+		"a": 1 << 40,
+		"b": 3,
+	}, map[string]int{
+		"a": 1 << 40,
+		"b": 4,
+	})
+
+	// 2^120 + 24
+	expected := new(big.Int).Lsh(big.NewInt(1), 120)
+	expected.Add(expected, big.NewInt(24))
+	assert.Equal(t, math.MaxInt64, res.TotalOverlap)
+	assert.Equal(t, expected, res.BigTotalOverlap)
+
+	// 2^80 + 6
+	pair := new(big.Int).Lsh(big.NewInt(1), 80)
+	pair.Add(pair, big.NewInt(6))
+	assert.Equal(t, math.MaxInt64, res.Pairs[0][1].TotalOverlap)
+	assert.Equal(t, pair, res.Pairs[0][1].BigTotalOverlap)
+}
+
+func Test_findOverlaps_NoOverflow(t *testing.T) {
+	res := findOverlaps(map[string]int{"a": math.MaxInt64}, map[string]int{"a": 1})
+	assert.Equal(t, math.MaxInt64, res.TotalOverlap)
+	assert.Nil(t, res.BigTotalOverlap)
+	assert.Nil(t, res.Pairs[0][1].BigTotalOverlap)
+	assert.NotNil(t, res.Pairs[0][0].BigTotalOverlap)
+}
+
+func Test_tally_MergeOverflows(t *testing.T) {
+	count := 3037000499
+	first, second := newTally(2), newTally(2)
+	assert.NoError(t, first.add("a", []int{count, count}))
+	assert.NoError(t, second.add("b", []int{count, count}))
+
+	first.merge(second)
+	res := first.result()
+
+	expected := new(big.Int).Mul(big.NewInt(int64(count)), big.NewInt(int64(count)))
+	expected.Mul(expected, big.NewInt(2))
+	assert.Equal(t, math.MaxInt64, res.TotalOverlap)
+	assert.Equal(t, expected, res.BigTotalOverlap)
+}
+
+func Test_frequencies_ProductOverflows(t *testing.T) {
+	f := newFrequencies(2, 1)
+	assert.NoError(t, f.add("a", []int{math.MaxInt64, 2}))
+
+	res := IntersectionResult{Files: make([]FileResult, 2)}
+	f.set(&res)
+	assert.Equal(t, []OverlapKey{{Key: "a", Counts: []int{math.MaxInt64, 2}, Overlap: math.MaxInt64}}, res.TopOverlapKeys)
+	assert.Equal(t, HistogramBucket{Min: 1000000000000000001, Max: math.MaxInt64, DistinctKeys: 1, Keys: math.MaxInt64}, res.Files[0].Histogram[len(res.Files[0].Histogram)-1])
+}
@@ -0,0 +1,255 @@
+package counter
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// shardBatchSize is the no. of keys of an input sent to a shard at a time
+const shardBatchSize = 1024
+
+// keyBatch is a batch of keys of an input for a shard
+type keyBatch struct {
+	input int
+	keys  *[]string
+}
+
+// batchPool reuses the slices of keys once they are counted
+var batchPool = sync.Pool{
+	New: func() interface{} {
+		keys := make([]string, 0, shardBatchSize)
+		return &keys
+	},
+}
+
+// shard counts the keys of every input whose hash falls in it, so that the overlaps of a shard only depend on its own counts
+type shard struct {
+	counts  []map[string]int
+	batches chan keyBatch
+}
+
+// findSetIntersectionSharded splits the keys of the inputs across opts.Shards shards by their hash.
+// Each shard counts its keys into maps of its own and then finds the overlaps of its keys, both in parallel,
+// and the tallies of the shards are added up at the end
+func findSetIntersectionSharded(ctx context.Context, opts Options, inputs []Input) (IntersectionResult, error) {
+	shards := make([]*shard, opts.Shards)
+	for s := range shards {
+		shards[s] = &shard{
+			counts:  make([]map[string]int, len(inputs)),
+			batches: make(chan keyBatch, len(inputs)),
+		}
+		for i := range inputs {
+			shards[s].counts[i] = make(map[string]int)
+		}
+	}
+
+	// count the keys of each shard as batches of them come in
+	counting := sync.WaitGroup{}
+	counting.Add(len(shards))
+	for _, s := range shards {
+		go func(s *shard) {
+			defer counting.Done()
+			for batch := range s.batches {
+				counts := s.counts[batch.input]
+				for _, k := range *batch.keys {
+					counts[k]++
+				}
+				*batch.keys = (*batch.keys)[:0]
+				batchPool.Put(batch.keys)
+			}
+		}(s)
+	}
+
+	totalKeyCounts := make([]int, len(inputs))
+	errs := make([]error, len(inputs))
+
+	dispatching := sync.WaitGroup{}
+	dispatching.Add(len(inputs))
+	for i, input := range inputs {
+		go func(i int, input Input) {
+			totalKeyCounts[i], errs[i] = dispatchKeys(ctx, i, input, shards)
+			dispatching.Done()
+		}(i, input)
+	}
+
+	dispatching.Wait()
+	for _, s := range shards {
+		close(s.batches)
+	}
+	counting.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return IntersectionResult{}, errors.Wrapf(err, "while counting keys of input %v", i+1)
+		}
+	}
+
+	// the visitor can only be called one key at a time, so the shards send it their keys in batches instead of waiting on each other
+	visitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var visits chan visitBatch
+	visited := make(chan error, 1)
+	if opts.Visitor != nil {
+		visits = make(chan visitBatch, len(shards))
+		go func() {
+			err := visitBatches(visits, len(inputs), opts.Visitor)
+			if err != nil {
+				// the shards stop sending once the visitor fails
+				cancel()
+			}
+			visited <- err
+		}()
+	}
+
+	tallies := make([]*tally, len(shards))
+	freqs := make([]*frequencies, len(shards))
+	group, groupCtx := errgroup.WithContext(visitCtx)
+	for s := range shards {
+		s := s
+		group.Go(func() error {
+			tallies[s] = newTally(len(inputs))
+			freqs[s] = newFrequencies(len(inputs), opts.TopKeys)
+
+			visit := withFrequencies(tallies[s].add, freqs[s])
+			if visits == nil {
+				return visitMaps(shards[s].counts, withContext(groupCtx, visit))
+			}
+
+			send, flush := batchVisits(groupCtx, len(inputs), visits)
+			if err := visitMaps(shards[s].counts, withContext(groupCtx, withVisitor(visit, send))); err != nil {
+				return err
+			}
+			return flush()
+		})
+	}
+
+	err := group.Wait()
+	if visits != nil {
+		close(visits)
+		if visitErr := <-visited; visitErr != nil {
+			err = visitErr
+		}
+	}
+	if err != nil {
+		return IntersectionResult{}, errors.Wrap(err, "while visiting keys")
+	}
+
+	// the keys of the shards are apart, so their tallies and frequencies add up to those of all the keys
+	t, f := tallies[0], freqs[0]
+	for s := 1; s < len(shards); s++ {
+		t.merge(tallies[s])
+		f.merge(freqs[s])
+	}
+
+	result := t.result()
+	for i := range result.Files {
+		result.Files[i].KeyCount = totalKeyCounts[i]
+	}
+	result.setSimilarity()
+	f.set(&result)
+
+	return result, nil
+}
+
+// dispatchKeys sends the keys of an input to their shards in batches until the input is closed, returning the no. of keys
+func dispatchKeys(ctx context.Context, index int, input Input, shards []*shard) (int, error) {
+	pending := make([]*[]string, len(shards))
+	for s := range pending {
+		pending[s] = batchPool.Get().(*[]string)
+	}
+
+	send := func(s int) error {
+		select {
+		case shards[s].batches <- keyBatch{input: index, keys: pending[s]}:
+			pending[s] = batchPool.Get().(*[]string)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	totalCount := 0
+	err := input.receive(ctx, func(item string) error {
+		totalCount++
+		s := int(hashKey(item) % uint64(len(shards)))
+		*pending[s] = append(*pending[s], item)
+		if len(*pending[s]) >= shardBatchSize {
+			return send(s)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for s := range pending {
+		if len(*pending[s]) > 0 {
+			if err := send(s); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return totalCount, nil
+}
+
+// visitBatchSize is the no. of keys a shard sends to the visitor at a time
+const visitBatchSize = 1024
+
+// visitBatch is a batch of keys visited by a shard, counts has the counts of each key one after the other
+type visitBatch struct {
+	keys   []string
+	counts []int
+}
+
+// batchVisits collects the keys visited by a shard into batches sent to visits, unless the context is done first.
+// flush sends the last batch once the shard is visited
+func batchVisits(ctx context.Context, inputs int, visits chan<- visitBatch) (send KeyVisitor, flush func() error) {
+	var batch visitBatch
+
+	flush = func() error {
+		if len(batch.keys) == 0 {
+			return nil
+		}
+
+		select {
+		case visits <- batch:
+			batch = visitBatch{}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	send = func(key string, counts []int) error {
+		if batch.keys == nil {
+			batch = visitBatch{keys: make([]string, 0, visitBatchSize), counts: make([]int, 0, visitBatchSize*inputs)}
+		}
+
+		// counts is reused for the next key, so it is copied
+		batch.keys = append(batch.keys, key)
+		batch.counts = append(batch.counts, counts...)
+		if len(batch.keys) < visitBatchSize {
+			return nil
+		}
+		return flush()
+	}
+
+	return send, flush
+}
+
+// visitBatches calls visit with every key of the batches until visits is closed, or visit fails
+func visitBatches(visits <-chan visitBatch, inputs int, visit KeyVisitor) error {
+	for batch := range visits {
+		for i, key := range batch.keys {
+			if err := visit(key, batch.counts[i*inputs:(i+1)*inputs]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package counter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func Test_FindSetIntersectionWithOptions_Shards(t *testing.T) {
+	inputs := generateInputs(5000)
+	expected, err := FindSetIntersectionWithOptions(context.Background(), Options{TopKeys: 5},
+		feed(inputs[0]), feed(inputs[1]), feed(inputs[2]))
+	assert.NoError(t, err)
+
+	for _, shards := range []int{2, 3, 16} {
+		res, err := FindSetIntersectionWithOptions(context.Background(), Options{TopKeys: 5, Shards: shards},
+			feed(inputs[0]), feed(inputs[1]), feed(inputs[2]))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, res, "shards: %v", shards)
+	}
+}
+
+func Test_FindSetIntersectionWithOptions_ShardsVisitor(t *testing.T) {
+	visited := map[string][]int{}
+	visiting := int32(0)
+
+	_, err := FindSetIntersectionWithOptions(context.Background(), Options{
+		Shards: 4,
+		Visitor: func(key string, counts []int) error {
+			// the visitor is only called from one goroutine at a time
+			if !atomic.CompareAndSwapInt32(&visiting, 0, 1) {
+				return errors.New("visitor called concurrently")
+			}
+			defer atomic.StoreInt32(&visiting, 0)
+			visited[key] = append([]int{}, counts...)
+			return nil
+		},
+	}, feed([]string{"a", "b", "b"}), feed([]string{"b", "c"}))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]int{"a": {1, 0}, "b": {2, 1}, "c": {0, 1}}, visited)
+
+	// more keys than a batch sent to the visitor, along with the frequencies of each shard
+	inputs := generateInputs(5000)
+	visitAll := func(shards int) (IntersectionResult, map[string][]int) {
+		visited := map[string][]int{}
+		res, err := FindSetIntersectionWithOptions(context.Background(), Options{
+			Shards:  shards,
+			TopKeys: 5,
+			Visitor: func(key string, counts []int) error {
+				visited[key] = append([]int{}, counts...)
+				return nil
+			},
+		}, feed(inputs[0]), feed(inputs[1]), feed(inputs[2]))
+		assert.NoError(t, err)
+		return res, visited
+	}
+
+	expected, expectedVisited := visitAll(1)
+	res, visited := visitAll(8)
+	assert.Equal(t, expected, res)
+	assert.Equal(t, expectedVisited, visited)
+
+	failed := errors.New("failed")
+	_, err = FindSetIntersectionWithOptions(context.Background(), Options{
+		Shards:  4,
+		Visitor: func(string, []int) error { return failed },
+	}, feed([]string{"a", "b", "b"}), feed([]string{"b", "c"}))
+	assert.True(t, errors.Is(err, failed), err)
+}
+
+func Test_FindSetIntersectionWithOptions_ShardsCanceled(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// the second input is never closed
+	first := feed([]string{"a"})
+	second := make(chan string)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := FindSetIntersectionWithOptions(ctx, Options{Shards: 4}, first, second)
+	assert.True(t, errors.Is(err, context.Canceled), err)
+
+	_, err = FindSetIntersectionWithOptions(context.Background(), Options{Shards: -1}, feed(nil), feed(nil))
+	assert.Error(t, err)
+}
+
+// Benchmark_FindSetIntersection_Shards compares four inputs of rowCount keys each counted with a growing no. of shards
+func Benchmark_FindSetIntersection_Shards(b *testing.B) {
+	inputs := make([][]string, 4)
+	for i := range inputs {
+		inputs[i] = make([]string, rowCount*4)
+		for j := range inputs[i] {
+			inputs[i][j] = strconv.Itoa((i*rowCount + j) % (rowCount * 8))
+		}
+	}
+
+	for _, shards := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("shards=%v", shards), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				channels := make([]<-chan string, len(inputs))
+				for j, keys := range inputs {
+					channels[j] = feed(keys)
+				}
+
+				if _, err := FindSetIntersectionWithOptions(context.Background(), Options{Shards: shards}, channels...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
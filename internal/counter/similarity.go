@@ -0,0 +1,53 @@
+package counter
+
+// Similarity has ratios from 0 to 1 of how alike two inputs A and B are.
+// A ratio with nothing to divide by, such as the Jaccard index of two empty inputs, is 0
+type Similarity struct {
+	// Jaccard is |A∩B| / |A∪B|
+	Jaccard float64 `json:"jaccard" yaml:"jaccard"`
+	// ContainmentOfFirst is the share of A found in B, |A∩B| / |A|
+	ContainmentOfFirst float64 `json:"containment_of_first" yaml:"containment_of_first"`
+	// ContainmentOfSecond is the share of B found in A, |A∩B| / |B|
+	ContainmentOfSecond float64 `json:"containment_of_second" yaml:"containment_of_second"`
+	// OverlapCoefficient (Szymkiewicz–Simpson) is |A∩B| / min(|A|, |B|), 1 when either contains the other
+	OverlapCoefficient float64 `json:"overlap_coefficient" yaml:"overlap_coefficient"`
+	// Dice (Sørensen–Dice) is 2|A∩B| / (|A| + |B|)
+	Dice float64 `json:"dice" yaml:"dice"`
+}
+
+// newSimilarity works out the ratios from the size of the intersection and of each input
+func newSimilarity(intersection, first, second int) Similarity {
+	return Similarity{
+		Jaccard:             ratio(intersection, first+second-intersection),
+		ContainmentOfFirst:  ratio(intersection, first),
+		ContainmentOfSecond: ratio(intersection, second),
+		OverlapCoefficient:  ratio(intersection, minCount(first, second)),
+		Dice:                ratio(2*intersection, first+second),
+	}
+}
+
+// ratio is n / d, or 0 when d is not more than 0.
+// Estimated counts may not add up, so it is kept to at most 1
+func ratio(n, d int) float64 {
+	if d <= 0 || n <= 0 {
+		return 0
+	}
+	if n >= d {
+		return 1
+	}
+	return float64(n) / float64(d)
+}
+
+// setSimilarity works out the similarity of every pair of inputs from their counts, KeyCount of the files must be set.
+// The weighted similarity treats the keys of each input as a multiset, where A∩B is MultisetOverlap
+func (r *IntersectionResult) setSimilarity() {
+	for i := range r.Pairs {
+		for j := range r.Pairs[i] {
+			pair := &r.Pairs[i][j]
+			first, second := r.Files[i], r.Files[j]
+
+			pair.DistinctSimilarity = newSimilarity(pair.DistinctOverlap, first.DistinctKeyCount, second.DistinctKeyCount)
+			pair.WeightedSimilarity = newSimilarity(pair.MultisetOverlap, first.KeyCount, second.KeyCount)
+		}
+	}
+}
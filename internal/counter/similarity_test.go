@@ -0,0 +1,28 @@
+package counter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newSimilarity(t *testing.T) {
+	assert.Equal(t, Similarity{Jaccard: 0.25, ContainmentOfFirst: 0.5, ContainmentOfSecond: 1.0 / 3, OverlapCoefficient: 0.5, Dice: 0.4},
+		newSimilarity(1, 2, 3))
+
+	// the first is in the second
+	assert.Equal(t, Similarity{Jaccard: 0.5, ContainmentOfFirst: 1, ContainmentOfSecond: 0.5, OverlapCoefficient: 1, Dice: 2.0 / 3},
+		newSimilarity(2, 2, 4))
+}
+
+func Test_newSimilarity_NoOverlap(t *testing.T) {
+	assert.Equal(t, Similarity{}, newSimilarity(0, 2, 3))
+	assert.Equal(t, Similarity{}, newSimilarity(0, 0, 0))
+	assert.Equal(t, Similarity{}, newSimilarity(0, 0, 3))
+}
+
+func Test_newSimilarity_Estimated(t *testing.T) {
+	// estimates that do not add up are kept to 1
+	assert.Equal(t, Similarity{Jaccard: 1, ContainmentOfFirst: 1, ContainmentOfSecond: 1, OverlapCoefficient: 1, Dice: 1},
+		newSimilarity(5, 4, 4))
+}
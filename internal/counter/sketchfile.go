@@ -0,0 +1,534 @@
+package counter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tav/golly/log"
+)
+
+// SketchVersion is the version of the sketch files written by WriteSketch, files of other versions cannot be read
+const SketchVersion = 1
+
+// sketchMagic starts every sketch file
+var sketchMagic = []byte("SETSKTCH")
+
+// kinds of sketch file
+const (
+	sketchExact       byte = 0
+	sketchApproximate byte = 1
+)
+
+// maxSketchStrings is a sanity limit on the no. of key columns, normalizers or null values read from a sketch file
+const maxSketchStrings = 1 << 10
+
+// StoredSketch is a sketch of the keys of an input written by WriteSketch, it is used in place of reading the input again.
+// A sketch file has either the exact count of every key, sorted by key, or an approximate Sketch
+type StoredSketch struct {
+	Path string
+	// Key has the columns that made up the key of the input
+	Key []string
+	// Settings are what the keys of the input were read with
+	Settings ReadSettings
+	// KeyCount is the no. of keys of the input
+	KeyCount int
+	// Approximate is the sketch of an approximate sketch file, nil when the file has the count of every key.
+	// The counts of an exact sketch file are read from the file as they are needed
+	Approximate *Sketch
+	// offset of the key counts of an exact sketch file
+	offset int64
+}
+
+// ReadSettings are the settings that change which keys are read from an input, or how. A key only matches the same key
+// read with the same settings, so they are kept in a sketch to be checked against the inputs it is compared with
+type ReadSettings struct {
+	// Normalizers are the normalizers applied to the key values in order, as they were given, eg. lower
+	Normalizers []string
+	// NullPolicy is what was done with the null keys, eg. exclude. NullValues are the values that are null when they are not counted
+	NullPolicy string
+	NullValues []string
+	// Filter is the expression that picked the rows, empty for every row
+	Filter string
+}
+
+// Equal is whether the settings are the same
+func (s ReadSettings) Equal(other ReadSettings) bool {
+	return equalStrings(s.Normalizers, other.Normalizers) && s.NullPolicy == other.NullPolicy &&
+		equalStrings(s.NullValues, other.NullValues) && s.Filter == other.Filter
+}
+
+func (s ReadSettings) String() string {
+	normalizers := "no normalizers"
+	if len(s.Normalizers) > 0 {
+		normalizers = fmt.Sprintf("normalizers (%s)", strings.Join(s.Normalizers, ", "))
+	}
+
+	nulls := fmt.Sprintf("null keys (%s)", s.NullPolicy)
+	if len(s.NullValues) > 0 {
+		nulls = fmt.Sprintf("null keys (%s of %s)", s.NullPolicy, strings.Join(s.NullValues, ", "))
+	}
+
+	filter := "no filter"
+	if s.Filter != "" {
+		filter = fmt.Sprintf("filter (%s)", s.Filter)
+	}
+
+	return strings.Join([]string{normalizers, nulls, filter}, ", ")
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteSketch writes a sketch of the keys of the input to w, once the input is closed.
+// It has the exact count of every key unless opts.Approximate is set, the key counts that go over opts.MemoryLimit
+// are spilled to disk while counting. key and settings are kept in the file, to check the sketch against the inputs it is compared with
+func WriteSketch(ctx context.Context, opts Options, key []string, settings ReadSettings, input Input, w io.Writer) error {
+	if err := input.validate(); err != nil {
+		return err
+	}
+
+	if input.Sketch != nil {
+		return errors.New("a sketch cannot be written of a sketch")
+	}
+
+	if opts.Visitor != nil {
+		return errors.New("keys cannot be visited when writing a sketch")
+	}
+
+	if opts.MemoryLimit < 0 {
+		return errors.Errorf("invalid memory limit: %v", opts.MemoryLimit)
+	}
+
+	if opts.Approximate != nil {
+		if err := opts.Approximate.validate(); err != nil {
+			return err
+		}
+
+		sketch, err := sketchKeys(ctx, input, *opts.Approximate)
+		if err != nil {
+			return errors.Wrap(err, "while sketching keys")
+		}
+
+		return writeApproximateSketch(w, key, settings, sketch)
+	}
+
+	dir, err := ioutil.TempDir(opts.TempDir, "set-intersection-")
+	if err != nil {
+		return errors.Wrap(err, "unable to create directory for sorted runs")
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Errorf("unable to remove sorted runs: %s", dir)
+		}
+	}()
+
+	limit := opts.MemoryLimit
+	if limit == 0 {
+		limit = math.MaxInt64
+	}
+
+	keys, err := countKeysWithLimit(ctx, input, limit, dir)
+	if err != nil {
+		return errors.Wrap(err, "while counting keys")
+	}
+
+	it, err := keys.iterator(maxFanIn)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := it.close(); err != nil {
+			log.Error(err.Error())
+		}
+	}()
+
+	return writeExactSketch(ctx, w, key, settings, keys.totalCount, it)
+}
+
+// writeSketchHeader writes the magic bytes, version, kind, key columns, read settings and key count that every sketch file starts with.
+// Integers are written as uvarints, strings as their length followed by their bytes and lists of strings as their length followed by each string
+func writeSketchHeader(w *bufio.Writer, kind byte, key []string, settings ReadSettings, keyCount int) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	writeUvarint := func(v uint64) error {
+		n := binary.PutUvarint(buf, v)
+		_, err := w.Write(buf[:n])
+		return err
+	}
+	writeString := func(s string) error {
+		if err := writeUvarint(uint64(len(s))); err != nil {
+			return err
+		}
+		_, err := w.WriteString(s)
+		return err
+	}
+	writeStrings := func(values []string) error {
+		if err := writeUvarint(uint64(len(values))); err != nil {
+			return err
+		}
+		for _, s := range values {
+			if err := writeString(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if _, err := w.Write(sketchMagic); err != nil {
+		return err
+	}
+	if err := writeUvarint(SketchVersion); err != nil {
+		return err
+	}
+	if err := w.WriteByte(kind); err != nil {
+		return err
+	}
+
+	if err := writeStrings(key); err != nil {
+		return err
+	}
+	if err := writeStrings(settings.Normalizers); err != nil {
+		return err
+	}
+	if err := writeString(settings.NullPolicy); err != nil {
+		return err
+	}
+	if err := writeStrings(settings.NullValues); err != nil {
+		return err
+	}
+	if err := writeString(settings.Filter); err != nil {
+		return err
+	}
+
+	return writeUvarint(uint64(keyCount))
+}
+
+// writeExactSketch writes the header followed by the key counts of the iterator in the format of a sorted run
+func writeExactSketch(ctx context.Context, w io.Writer, key []string, settings ReadSettings, keyCount int, it countIterator) error {
+	bw := bufio.NewWriter(w)
+	if err := writeSketchHeader(bw, sketchExact, key, settings, keyCount); err != nil {
+		return errors.Wrap(err, "unable to write sketch")
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	for written := 1; ; written++ {
+		if written%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		entry, more, err := it.next()
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+
+		if err := writeEntry(bw, buf, entry); err != nil {
+			return errors.Wrap(err, "unable to write sketch")
+		}
+	}
+
+	return errors.Wrap(bw.Flush(), "unable to write sketch")
+}
+
+// writeApproximateSketch writes the header followed by the precision and registers of the HyperLogLog,
+// then the size of the MinHash, whether it left out any hashes as 1 or 0, and each of its hashes as 8 big endian bytes
+// along with the count of the hash
+func writeApproximateSketch(w io.Writer, key []string, settings ReadSettings, sketch *Sketch) error {
+	bw := bufio.NewWriter(w)
+	if err := writeSketchHeader(bw, sketchApproximate, key, settings, sketch.KeyCount); err != nil {
+		return errors.Wrap(err, "unable to write sketch")
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	writeUvarint := func(v uint64) error {
+		n := binary.PutUvarint(buf, v)
+		_, err := bw.Write(buf[:n])
+		return err
+	}
+
+	if err := bw.WriteByte(sketch.Distinct.precision); err != nil {
+		return errors.Wrap(err, "unable to write sketch")
+	}
+	if _, err := bw.Write(sketch.Distinct.registers); err != nil {
+		return errors.Wrap(err, "unable to write sketch")
+	}
+
+	if err := writeUvarint(uint64(sketch.Sample.size)); err != nil {
+		return errors.Wrap(err, "unable to write sketch")
+	}
+	dropped := byte(0)
+	if sketch.Sample.dropped {
+		dropped = 1
+	}
+	if err := bw.WriteByte(dropped); err != nil {
+		return errors.Wrap(err, "unable to write sketch")
+	}
+	if err := writeUvarint(uint64(len(sketch.Sample.counts))); err != nil {
+		return errors.Wrap(err, "unable to write sketch")
+	}
+	// the heap has every hash of the sample
+	for _, hash := range sketch.Sample.largest {
+		binary.BigEndian.PutUint64(buf, hash)
+		if _, err := bw.Write(buf[:8]); err != nil {
+			return errors.Wrap(err, "unable to write sketch")
+		}
+		if err := writeUvarint(uint64(sketch.Sample.counts[hash])); err != nil {
+			return errors.Wrap(err, "unable to write sketch")
+		}
+	}
+
+	return errors.Wrap(bw.Flush(), "unable to write sketch")
+}
+
+// OpenSketch reads the sketch file at path.
+// An approximate sketch is read whole, only the header of an exact one is read until its key counts are needed
+func OpenSketch(path string) (*StoredSketch, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open sketch: %s", path)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Errorf("unable to close sketch: %s", path)
+		}
+	}()
+
+	r := bufio.NewReader(file)
+	sketch, kind, err := readSketchHeader(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid sketch: %s", path)
+	}
+	sketch.Path = path
+
+	if kind == sketchApproximate {
+		sketch.Approximate, err = readApproximateSketch(r, sketch.KeyCount)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid sketch: %s", path)
+		}
+		return sketch, nil
+	}
+
+	// the key counts start after what was read of the file, less what is still buffered
+	position, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read sketch: %s", path)
+	}
+	sketch.offset = position - int64(r.Buffered())
+
+	return sketch, nil
+}
+
+func readSketchHeader(r *bufio.Reader) (*StoredSketch, byte, error) {
+	magic := make([]byte, len(sketchMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, sketchMagic) {
+		return nil, 0, errors.New("not a sketch file")
+	}
+
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "unable to read version")
+	}
+	if version != SketchVersion {
+		return nil, 0, errors.Errorf("unsupported sketch version %v, only version %v can be read", version, SketchVersion)
+	}
+
+	kind, err := r.ReadByte()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "unable to read kind")
+	}
+	if kind != sketchExact && kind != sketchApproximate {
+		return nil, 0, errors.Errorf("unknown kind of sketch: %v", kind)
+	}
+
+	sketch := &StoredSketch{}
+	if sketch.Key, err = readSketchStrings(r); err != nil {
+		return nil, 0, errors.Wrap(err, "unable to read key")
+	}
+	if sketch.Settings.Normalizers, err = readSketchStrings(r); err != nil {
+		return nil, 0, errors.Wrap(err, "unable to read normalizers")
+	}
+	if sketch.Settings.NullPolicy, err = readSketchString(r); err != nil {
+		return nil, 0, errors.Wrap(err, "unable to read null policy")
+	}
+	if sketch.Settings.NullValues, err = readSketchStrings(r); err != nil {
+		return nil, 0, errors.Wrap(err, "unable to read null values")
+	}
+	if sketch.Settings.Filter, err = readSketchString(r); err != nil {
+		return nil, 0, errors.Wrap(err, "unable to read filter")
+	}
+
+	keyCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "unable to read key count")
+	}
+	sketch.KeyCount = int(keyCount)
+
+	return sketch, kind, nil
+}
+
+// readSketchStrings reads a list of strings written by writeSketchHeader, nil when it is empty
+func readSketchStrings(r *bufio.Reader) ([]string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxSketchStrings {
+		return nil, errors.Errorf("too many values: %v", n)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	values := make([]string, n)
+	for i := range values {
+		if values[i], err = readSketchString(r); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// readSketchString reads a string written by writeSketchHeader
+func readSketchString(r *bufio.Reader) (string, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if length > math.MaxInt32 {
+		return "", errors.Errorf("value too long: %v", length)
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+func readApproximateSketch(r *bufio.Reader, keyCount int) (*Sketch, error) {
+	precision, err := r.ReadByte()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read precision")
+	}
+
+	distinct, err := NewHyperLogLog(int(precision))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, distinct.registers); err != nil {
+		return nil, errors.Wrap(err, "unable to read registers")
+	}
+
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read sample size")
+	}
+	if size > math.MaxInt32 {
+		return nil, errors.Errorf("sample size too large: %v", size)
+	}
+
+	sample, err := NewMinHash(int(size))
+	if err != nil {
+		return nil, err
+	}
+
+	dropped, err := r.ReadByte()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read sample")
+	}
+	if dropped > 1 {
+		return nil, errors.Errorf("invalid sample, expected 0 or 1 for whether it left out hashes, got: %v", dropped)
+	}
+
+	hashes, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read sample")
+	}
+	if hashes > size {
+		return nil, errors.Errorf("sample has %v hashes, more than its size %v", hashes, size)
+	}
+
+	hash := make([]byte, 8)
+	for i := uint64(0); i < hashes; i++ {
+		if _, err := io.ReadFull(r, hash); err != nil {
+			return nil, errors.Wrap(err, "unable to read sample")
+		}
+		count, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read sample")
+		}
+		sample.add(binary.BigEndian.Uint64(hash), int(count))
+	}
+	sample.dropped = dropped == 1
+
+	return &Sketch{KeyCount: keyCount, Distinct: distinct, Sample: sample}, nil
+}
+
+// iterator returns the key counts of an exact sketch file in ascending order of the key
+func (s *StoredSketch) iterator() (countIterator, error) {
+	if s.Approximate != nil {
+		return nil, errors.Errorf("approximate sketch has no key counts: %s", s.Path)
+	}
+
+	return openRunAt(s.Path, s.offset)
+}
+
+// sketch returns the approximate sketch, which is built from the key counts of an exact sketch file
+func (s *StoredSketch) sketch(ctx context.Context, a Approximation) (*Sketch, error) {
+	if s.Approximate != nil {
+		return s.Approximate, nil
+	}
+
+	sketch, err := NewSketch(a)
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := s.iterator()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := it.close(); err != nil {
+			log.Error(err.Error())
+		}
+	}()
+
+	for read := 1; ; read++ {
+		if read%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		entry, more, err := it.next()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			return sketch, nil
+		}
+		sketch.add(entry.key, entry.count)
+	}
+}
@@ -0,0 +1,147 @@
+package counter
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSketchFile writes the sketch of the keys to a file and opens it
+func writeSketchFile(t *testing.T, opts Options, keys []string) *StoredSketch {
+	t.Helper()
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSketch(context.Background(), opts, []string{"id"}, ReadSettings{}, Input{Keys: feed(keys)}, &buf))
+
+	path := filepath.Join(t.TempDir(), "keys.sketch")
+	assert.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0o600))
+
+	sketch, err := OpenSketch(path)
+	assert.NoError(t, err)
+	return sketch
+}
+
+func Test_WriteSketch_Exact(t *testing.T) {
+	inputs := generateInputs(1000)
+	expected, err := FindSetIntersection(context.Background(), feed(inputs[0]), feed(inputs[1]), feed(inputs[2]))
+	assert.NoError(t, err)
+
+	// spilling while the sketch is written does not change it
+	for _, opts := range []Options{{}, {MemoryLimit: 1024, TempDir: t.TempDir()}} {
+		sketch := writeSketchFile(t, opts, inputs[0])
+		assert.Equal(t, []string{"id"}, sketch.Key)
+		assert.Equal(t, len(inputs[0]), sketch.KeyCount)
+		assert.Nil(t, sketch.Approximate)
+
+		res, err := FindSetIntersectionOf(context.Background(), Options{},
+			Input{Sketch: sketch}, Input{Keys: feed(inputs[1])}, Input{Keys: feed(inputs[2])})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, res)
+
+		res, err = FindSetIntersectionOf(context.Background(), Options{MemoryLimit: 1024, TempDir: t.TempDir()},
+			Input{Keys: feed(inputs[1])}, Input{Sketch: sketch}, Input{Sketch: sketch})
+		assert.NoError(t, err)
+		assert.Equal(t, len(inputs[0]), res.Files[1].KeyCount)
+		assert.Equal(t, expected.Pairs[0][0], res.Pairs[1][2])
+	}
+}
+
+func Test_WriteSketch_Approximate(t *testing.T) {
+	inputs := generateInputs(100000)
+	approximation := Approximation{Precision: 12, SampleSize: 1024}
+	expected, err := FindSetIntersectionWithOptions(context.Background(), Options{Approximate: &approximation},
+		feed(inputs[0]), feed(inputs[1]), feed(inputs[2]))
+	assert.NoError(t, err)
+
+	sketch := writeSketchFile(t, Options{Approximate: &approximation}, inputs[0])
+	assert.Equal(t, len(inputs[0]), sketch.KeyCount)
+	assert.Equal(t, approximation, sketch.Approximate.Approximation())
+
+	// the other inputs are sketched the same way as the sketch file
+	res, err := FindSetIntersectionOf(context.Background(), Options{Approximate: &Approximation{Precision: DefaultPrecision, SampleSize: DefaultSampleSize}},
+		Input{Sketch: sketch}, Input{Keys: feed(inputs[1])}, Input{Keys: feed(inputs[2])})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, res)
+
+	// an approximate sketch cannot be counted exactly
+	_, err = FindSetIntersectionOf(context.Background(), Options{}, Input{Sketch: sketch}, Input{Keys: feed(inputs[1])})
+	assert.Error(t, err)
+}
+
+func Test_WriteSketch_ExactApproximated(t *testing.T) {
+	inputs := generateInputs(1000)
+	approximation := Approximation{Precision: DefaultPrecision, SampleSize: DefaultSampleSize}
+	expected, err := FindSetIntersectionWithOptions(context.Background(), Options{Approximate: &approximation},
+		feed(inputs[0]), feed(inputs[1]))
+	assert.NoError(t, err)
+
+	sketch := writeSketchFile(t, Options{}, inputs[0])
+	res, err := FindSetIntersectionOf(context.Background(), Options{Approximate: &approximation},
+		Input{Sketch: sketch}, Input{Keys: feed(inputs[1])})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, res)
+}
+
+func Test_WriteSketch_Settings(t *testing.T) {
+	settings := ReadSettings{
+		Normalizers: []string{"trim", "s/-//"},
+		NullPolicy:  "exclude",
+		NullValues:  []string{"NULL", ""},
+		Filter:      "status = active",
+	}
+
+	for _, opts := range []Options{{}, {Approximate: &Approximation{Precision: 10, SampleSize: 16}}} {
+		var buf bytes.Buffer
+		assert.NoError(t, WriteSketch(context.Background(), opts, []string{"id", "region"}, settings, Input{Keys: feed([]string{"a", "b"})}, &buf))
+
+		path := filepath.Join(t.TempDir(), "keys.sketch")
+		assert.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0o600))
+
+		sketch, err := OpenSketch(path)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"id", "region"}, sketch.Key)
+		assert.Equal(t, settings, sketch.Settings)
+		assert.Equal(t, 2, sketch.KeyCount)
+	}
+}
+
+func Test_ReadSettings(t *testing.T) {
+	settings := ReadSettings{NullPolicy: "count"}
+	assert.True(t, settings.Equal(ReadSettings{NullPolicy: "count", Normalizers: []string{}}))
+	assert.False(t, settings.Equal(ReadSettings{NullPolicy: "count", Normalizers: []string{"lower"}}))
+	assert.False(t, settings.Equal(ReadSettings{NullPolicy: "exclude"}))
+	assert.False(t, settings.Equal(ReadSettings{NullPolicy: "count", Filter: "a = 1"}))
+
+	assert.Equal(t, "no normalizers, null keys (count), no filter", settings.String())
+	assert.Equal(t, "normalizers (lower, trim), null keys (exclude of NULL, NA), filter (a = 1)",
+		ReadSettings{Normalizers: []string{"lower", "trim"}, NullPolicy: "exclude", NullValues: []string{"NULL", "NA"}, Filter: "a = 1"}.String())
+}
+
+func Test_OpenSketch_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSketch(context.Background(), Options{}, []string{"id"}, ReadSettings{}, Input{Keys: feed([]string{"a"})}, &buf))
+	valid := buf.Bytes()
+
+	for name, content := range map[string][]byte{
+		"empty":     {},
+		"not":       []byte("id\n1\n"),
+		"version":   append(append([]byte{}, sketchMagic...), SketchVersion+1),
+		"kind":      append(append([]byte{}, sketchMagic...), SketchVersion, 7),
+		"truncated": valid[:len(sketchMagic)+3],
+	} {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, ioutil.WriteFile(path, content, 0o600))
+
+		_, err := OpenSketch(path)
+		assert.Error(t, err, name)
+	}
+
+	_, err := OpenSketch(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
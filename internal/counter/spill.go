@@ -0,0 +1,508 @@
+package counter
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// entryOverhead is a rough estimate of the bytes a map entry costs on top of the key itself: the string header and count
+// held in the buckets of the map, the room left in buckets that are not full, and the allocation of the key rounded up.
+// Maps of 100k to 1M keys measure from about 35 to 65 bytes an entry, so it errs on the high side
+const entryOverhead = 64
+
+// maxFanIn is the most runs that are open at once when merging them, those of all the inputs together,
+// so that a small memory limit on large inputs does not run out of file descriptors. It is a var so that tests can lower it
+var maxFanIn = 64
+
+// keyCount is a key along with the no. of times it was seen
+type keyCount struct {
+	key   string
+	count int
+}
+
+// countIterator iterates over key counts in ascending order of the key.
+// next returns false once there are no more keys
+type countIterator interface {
+	next() (keyCount, bool, error)
+	close() error
+}
+
+// spilledKeys holds the key counts of an input that exceeded its memory budget.
+// Keys that did not fit are written as sorted runs in dir, the remainder is kept in counts
+type spilledKeys struct {
+	counts     map[string]int
+	totalCount int
+	dir        string
+	runs       []string
+	// sketch, when set, has the sorted key counts in place of the runs
+	sketch *StoredSketch
+}
+
+// countKeysWithLimit counts keys like countKeys but writes the counts to a sorted run on disk
+// every time their estimated size, see entryOverhead, goes past memoryLimit.
+// The input is drained on error until it is closed or the context is done, so that the producer does not block forever
+func countKeysWithLimit(ctx context.Context, input Input, memoryLimit int64, dir string) (*spilledKeys, error) {
+	res := &spilledKeys{
+		counts: make(map[string]int),
+		dir:    dir,
+	}
+
+	var usage int64
+	var spillErr error
+
+	err := input.receive(ctx, func(item string) error {
+		if spillErr != nil {
+			return nil
+		}
+
+		if _, ok := res.counts[item]; !ok {
+			usage += int64(len(item)) + entryOverhead
+		}
+		res.counts[item]++
+		res.totalCount++
+
+		if usage > memoryLimit {
+			spillErr = res.spill()
+			usage = 0
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if spillErr != nil {
+		return nil, spillErr
+	}
+
+	return res, nil
+}
+
+func (s *spilledKeys) spilled() bool {
+	return len(s.runs) > 0 || s.sketch != nil
+}
+
+// spill writes the in memory counts to a new sorted run and resets them
+func (s *spilledKeys) spill() error {
+	file, err := ioutil.TempFile(s.dir, "run-*")
+	if err != nil {
+		return errors.Wrap(err, "unable to create run file")
+	}
+
+	if err := writeRun(file, s.counts); err != nil {
+		_ = file.Close()
+		return errors.Wrapf(err, "while writing run: %s", file.Name())
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.Wrapf(err, "unable to close run: %s", file.Name())
+	}
+
+	s.runs = append(s.runs, file.Name())
+	s.counts = make(map[string]int)
+	return nil
+}
+
+// iterator returns the key counts in ascending order, merging the runs on disk with what is left in memory.
+// No more than maxRuns runs are open at once, see sortRuns
+func (s *spilledKeys) iterator(maxRuns int) (countIterator, error) {
+	if s.sketch != nil {
+		return s.sketch.iterator()
+	}
+
+	if !s.spilled() {
+		return newSortedMapIterator(s.counts), nil
+	}
+
+	if err := s.sortRuns(maxRuns); err != nil {
+		return nil, err
+	}
+
+	return newMergeIterator(s.runs)
+}
+
+// sortRuns writes what is left in memory to a run once the counts are spilled, and merges the runs until no more than maxRuns are left.
+// It does nothing once they are sorted
+func (s *spilledKeys) sortRuns(maxRuns int) error {
+	if s.sketch != nil || !s.spilled() {
+		return nil
+	}
+
+	if len(s.counts) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+
+	return s.compact(maxRuns)
+}
+
+// compact merges the runs in groups of maxFanIn into new runs, pass after pass, until no more than maxRuns are left
+func (s *spilledKeys) compact(maxRuns int) error {
+	if maxRuns < 1 {
+		maxRuns = 1
+	}
+
+	for len(s.runs) > maxRuns {
+		merged := make([]string, 0, (len(s.runs)+maxFanIn-1)/maxFanIn)
+
+		for start := 0; start < len(s.runs); start += maxFanIn {
+			end := start + maxFanIn
+			if end > len(s.runs) {
+				end = len(s.runs)
+			}
+
+			if end-start == 1 {
+				merged = append(merged, s.runs[start])
+				continue
+			}
+
+			run, err := s.mergeRuns(s.runs[start:end])
+			if err != nil {
+				return err
+			}
+			merged = append(merged, run)
+		}
+
+		s.runs = merged
+	}
+	return nil
+}
+
+// mergeRuns merges the runs into a new run and removes them, returning the path of the new run
+func (s *spilledKeys) mergeRuns(paths []string) (string, error) {
+	file, err := ioutil.TempFile(s.dir, "run-*")
+	if err != nil {
+		return "", errors.Wrap(err, "unable to create run file")
+	}
+
+	if err := writeMerged(file, paths); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return "", errors.Wrapf(err, "while merging runs into: %s", file.Name())
+	}
+
+	if err := file.Close(); err != nil {
+		return "", errors.Wrapf(err, "unable to close run: %s", file.Name())
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			return "", errors.Wrapf(err, "unable to remove run: %s", path)
+		}
+	}
+
+	return file.Name(), nil
+}
+
+// writeMerged writes the merged key counts of the runs as a single run, see writeRun
+func writeMerged(w io.Writer, paths []string) (err error) {
+	it, err := newMergeIterator(paths)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := it.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, binary.MaxVarintLen64)
+
+	for {
+		entry, more, err := it.next()
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+
+		if err := writeEntry(bw, buf, entry); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeRun writes the counts sorted by key.
+// Each entry is encoded as uvarint key length, key bytes and uvarint count
+func writeRun(w io.Writer, counts map[string]int) error {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, binary.MaxVarintLen64)
+
+	for _, k := range keys {
+		if err := writeEntry(bw, buf, keyCount{key: k, count: counts[k]}); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeEntry writes a key count of a run, buf is scratch space of binary.MaxVarintLen64 bytes
+func writeEntry(w *bufio.Writer, buf []byte, entry keyCount) error {
+	n := binary.PutUvarint(buf, uint64(len(entry.key)))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+	if _, err := w.WriteString(entry.key); err != nil {
+		return err
+	}
+	n = binary.PutUvarint(buf, uint64(entry.count))
+	_, err := w.Write(buf[:n])
+	return err
+}
+
+// sortedMapIterator iterates over an in memory map in ascending order of the key
+type sortedMapIterator struct {
+	counts map[string]int
+	keys   []string
+	pos    int
+}
+
+func newSortedMapIterator(counts map[string]int) *sortedMapIterator {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return &sortedMapIterator{
+		counts: counts,
+		keys:   keys,
+	}
+}
+
+func (it *sortedMapIterator) next() (keyCount, bool, error) {
+	if it.pos >= len(it.keys) {
+		return keyCount{}, false, nil
+	}
+
+	k := it.keys[it.pos]
+	it.pos++
+	return keyCount{key: k, count: it.counts[k]}, true, nil
+}
+
+func (it *sortedMapIterator) close() error {
+	return nil
+}
+
+// runReader reads back a run written by writeRun
+type runReader struct {
+	file   *os.File
+	reader *bufio.Reader
+}
+
+func openRun(path string) (*runReader, error) {
+	return openRunAt(path, 0)
+}
+
+// openRunAt reads back a run that starts at offset bytes into the file
+func openRunAt(path string, offset int64) (*runReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open run: %s", path)
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, errors.Wrapf(err, "unable to seek run: %s", path)
+	}
+
+	return &runReader{
+		file:   file,
+		reader: bufio.NewReader(file),
+	}, nil
+}
+
+func (r *runReader) next() (keyCount, bool, error) {
+	keyLen, err := binary.ReadUvarint(r.reader)
+	if err == io.EOF {
+		return keyCount{}, false, nil
+	}
+	if err != nil {
+		return keyCount{}, false, errors.Wrapf(err, "while reading run: %s", r.file.Name())
+	}
+
+	key := make([]byte, keyLen)
+	if _, err := io.ReadFull(r.reader, key); err != nil {
+		return keyCount{}, false, errors.Wrapf(err, "while reading run: %s", r.file.Name())
+	}
+
+	count, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return keyCount{}, false, errors.Wrapf(err, "while reading run: %s", r.file.Name())
+	}
+
+	return keyCount{key: string(key), count: int(count)}, true, nil
+}
+
+func (r *runReader) close() error {
+	if err := r.file.Close(); err != nil {
+		return errors.Wrapf(err, "unable to close run: %s", r.file.Name())
+	}
+	return nil
+}
+
+// cursor is an iterator along with the entry it is currently at
+type cursor struct {
+	it      countIterator
+	index   int
+	current keyCount
+}
+
+// cursorHeap orders the cursors by their current key
+type cursorHeap []*cursor
+
+func (h cursorHeap) Len() int            { return len(h) }
+func (h cursorHeap) Less(i, j int) bool  { return h[i].current.key < h[j].current.key }
+func (h cursorHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *cursorHeap) Push(x interface{}) { *h = append(*h, x.(*cursor)) }
+func (h *cursorHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+func newCursorHeap(iterators []countIterator) (cursorHeap, error) {
+	h := make(cursorHeap, 0, len(iterators))
+
+	for i, it := range iterators {
+		current, more, err := it.next()
+		if err != nil {
+			return nil, err
+		}
+		if more {
+			h = append(h, &cursor{it: it, index: i, current: current})
+		}
+	}
+
+	heap.Init(&h)
+	return h, nil
+}
+
+// popKey calls fn with every cursor at the smallest key and moves them along.
+// Returns the smallest key, or false when all cursors are exhausted
+func (h *cursorHeap) popKey(fn func(c *cursor)) (string, bool, error) {
+	if h.Len() == 0 {
+		return "", false, nil
+	}
+
+	key := (*h)[0].current.key
+	for h.Len() > 0 && (*h)[0].current.key == key {
+		c := (*h)[0]
+		fn(c)
+
+		current, more, err := c.it.next()
+		if err != nil {
+			return "", false, err
+		}
+		if more {
+			c.current = current
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+
+	return key, true, nil
+}
+
+// mergeIterator does a k-way merge of sorted runs, adding up the counts of keys found in more than one run
+type mergeIterator struct {
+	runs []countIterator
+	heap cursorHeap
+}
+
+func newMergeIterator(paths []string) (*mergeIterator, error) {
+	it := &mergeIterator{}
+
+	for _, path := range paths {
+		run, err := openRun(path)
+		if err != nil {
+			_ = it.close()
+			return nil, err
+		}
+		it.runs = append(it.runs, run)
+	}
+
+	h, err := newCursorHeap(it.runs)
+	if err != nil {
+		_ = it.close()
+		return nil, err
+	}
+	it.heap = h
+
+	return it, nil
+}
+
+func (it *mergeIterator) next() (keyCount, bool, error) {
+	count := 0
+	key, more, err := it.heap.popKey(func(c *cursor) {
+		count += c.current.count
+	})
+	if err != nil || !more {
+		return keyCount{}, false, err
+	}
+
+	return keyCount{key: key, count: count}, true, nil
+}
+
+func (it *mergeIterator) close() error {
+	var firstErr error
+	for _, run := range it.runs {
+		if err := run.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// visitSorted walks sorted iterators side by side and calls visit once for every distinct key
+// with the count of the key in each iterator
+func visitSorted(iterators []countIterator, visit KeyVisitor) error {
+	h, err := newCursorHeap(iterators)
+	if err != nil {
+		return err
+	}
+
+	counts := make([]int, len(iterators))
+	for {
+		for i := range counts {
+			counts[i] = 0
+		}
+
+		key, more, err := h.popKey(func(c *cursor) {
+			counts[c.index] = c.current.count
+		})
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+
+		if err := visit(key, counts); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package counter
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_writeRun_RoundTrip(t *testing.T) {
+	file, err := ioutil.TempFile(t.TempDir(), "run")
+	assert.NoError(t, err)
+	assert.NoError(t, writeRun(file, map[string]int{"c": 3, "a": 1, "b": 2}))
+	assert.NoError(t, file.Close())
+
+	it, err := newMergeIterator([]string{file.Name()})
+	assert.NoError(t, err)
+	defer it.close()
+
+	assert.Equal(t, []keyCount{{"a", 1}, {"b", 2}, {"c", 3}}, drain(t, it))
+}
+
+func Test_mergeIterator_MergesRuns(t *testing.T) {
+	keys := &spilledKeys{dir: t.TempDir(), counts: map[string]int{"a": 1, "c": 1}}
+	assert.NoError(t, keys.spill())
+
+	keys.counts = map[string]int{"b": 2, "c": 4}
+	assert.NoError(t, keys.spill())
+
+	keys.counts = map[string]int{"d": 1}
+	it, err := keys.iterator(maxFanIn)
+	assert.NoError(t, err)
+	defer it.close()
+
+	assert.Equal(t, []keyCount{{"a", 1}, {"b", 2}, {"c", 5}, {"d", 1}}, drain(t, it))
+}
+
+func Test_spilledKeys_iterator_MergesInPasses(t *testing.T) {
+	defer func(fanIn int) { maxFanIn = fanIn }(maxFanIn)
+	maxFanIn = 2
+
+	dir := t.TempDir()
+	keys := &spilledKeys{dir: dir}
+	for _, counts := range []map[string]int{{"a": 1}, {"b": 1, "a": 2}, {"c": 1}, {"a": 3, "d": 1}, {"e": 1}} {
+		keys.counts = counts
+		assert.NoError(t, keys.spill())
+	}
+
+	keys.counts = map[string]int{"b": 5}
+	it, err := keys.iterator(maxFanIn)
+	assert.NoError(t, err)
+	defer it.close()
+
+	assert.Len(t, keys.runs, 2)
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	assert.Equal(t, []keyCount{{"a", 6}, {"b", 6}, {"c", 1}, {"d", 1}, {"e", 1}}, drain(t, it))
+}
+
+func Test_writeRun_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, writeRun(&buf, map[string]int{}))
+	assert.Equal(t, 0, buf.Len())
+}
+
+func Test_countKeysWithLimit_Spills(t *testing.T) {
+	input := make(chan string, bufferSize)
+	go func() {
+		defer close(input)
+		for _, k := range []string{"a", "b", "a", "c", "d", "a"} {
+			input <- k
+		}
+	}()
+
+	keys, err := countKeysWithLimit(context.Background(), Input{Keys: input}, 1, t.TempDir())
+	assert.NoError(t, err)
+	assert.True(t, keys.spilled())
+	assert.Equal(t, 6, keys.totalCount)
+
+	it, err := keys.iterator(maxFanIn)
+	assert.NoError(t, err)
+	defer it.close()
+
+	assert.Equal(t, []keyCount{{"a", 3}, {"b", 1}, {"c", 1}, {"d", 1}}, drain(t, it))
+}
+
+func Test_countKeysWithLimit_InvalidDir(t *testing.T) {
+	input := make(chan string, bufferSize)
+	go func() {
+		defer close(input)
+		for i := 0; i < 100; i++ {
+			input <- getRandomString(4)
+		}
+	}()
+
+	// input must still be drained so the producer above is able to finish
+	_, err := countKeysWithLimit(context.Background(), Input{Keys: input}, 1, "./non-existent-dir")
+	assert.Error(t, err)
+}
+
+func Test_FindSetIntersectionWithOptions_MatchesInMemory(t *testing.T) {
+	// short keys so that there are plenty of overlaps and duplicates
+	firstKeys := make([]string, 0, 2000)
+	secondKeys := make([]string, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		firstKeys = append(firstKeys, getRandomString(2))
+		secondKeys = append(secondKeys, getRandomString(2))
+	}
+
+	thirdKeys := append([]string{}, firstKeys[:1000]...)
+	thirdKeys = append(thirdKeys, secondKeys[:1000]...)
+
+	expected, err := FindSetIntersection(context.Background(), feed(firstKeys), feed(secondKeys), feed(thirdKeys))
+	assert.NoError(t, err)
+
+	for _, limit := range []int64{16 * entryOverhead, 256 * entryOverhead, 1 << 30} {
+		res, err := FindSetIntersectionWithOptions(context.Background(), Options{
+			MemoryLimit: limit,
+			TempDir:     t.TempDir(),
+		}, feed(firstKeys), feed(secondKeys), feed(thirdKeys))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, res, "memory limit: %v", limit)
+	}
+}
+
+func Test_FindSetIntersectionWithOptions_ManyInputsSpilled(t *testing.T) {
+	defer func(fanIn int) { maxFanIn = fanIn }(maxFanIn)
+	maxFanIn = 8
+
+	// every input spills far more runs than the fan in
+	inputs := make([][]string, 16)
+	for i := range inputs {
+		for j := 0; j < 500; j++ {
+			inputs[i] = append(inputs[i], strconv.Itoa((i*100+j)%1000))
+		}
+	}
+	feedAll := func() []<-chan string {
+		channels := make([]<-chan string, len(inputs))
+		for i, keys := range inputs {
+			channels[i] = feed(keys)
+		}
+		return channels
+	}
+
+	expected, err := FindSetIntersection(context.Background(), feedAll()...)
+	assert.NoError(t, err)
+
+	// the runs open while the keys are visited, on top of what is open before
+	before, fdErr := ioutil.ReadDir("/proc/self/fd")
+	maxOpen := 0
+	visitor := func(string, []int) error {
+		if open, err := ioutil.ReadDir("/proc/self/fd"); err == nil && len(open)-len(before) > maxOpen {
+			maxOpen = len(open) - len(before)
+		}
+		return nil
+	}
+
+	res, err := FindSetIntersectionWithOptions(context.Background(), Options{
+		MemoryLimit: int64(len(inputs)) * 8 * entryOverhead,
+		TempDir:     t.TempDir(),
+		Visitor:     visitor,
+	}, feedAll()...)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, res)
+
+	if fdErr == nil {
+		// one run for each input, as there are more inputs than the fan in
+		assert.LessOrEqual(t, maxOpen, len(inputs))
+		assert.Greater(t, maxOpen, 0)
+	}
+}
+
+func Test_FindSetIntersectionWithOptions_OneSideSpilled(t *testing.T) {
+	res, err := FindSetIntersectionWithOptions(context.Background(), Options{
+		MemoryLimit: 3 * entryOverhead,
+		TempDir:     t.TempDir(),
+	}, feed([]string{"a", "b", "c", "d", "d", "e", "f", "f"}), feed([]string{"a"}))
+	assert.NoError(t, err)
+	expected := IntersectionResult{
+		Files: []FileResult{
+			{
+				KeyCount:                  8,
+				DistinctKeyCount:          6,
+				ExclusiveKeyCount:         7,
+				DistinctExclusiveKeyCount: 5,
+			},
+			{
+				KeyCount:         1,
+				DistinctKeyCount: 1,
+			},
+		},
+		Pairs: [][]Overlap{
+			{
+				{DistinctOverlap: 6, TotalOverlap: 12, DistinctUnion: 6, MultisetOverlap: 8},
+				{DistinctOverlap: 1, TotalOverlap: 1, DistinctDifference: 5, DistinctUnion: 6, DistinctSymmetricDifference: 5, MultisetOverlap: 1},
+			},
+			{
+				{DistinctOverlap: 1, TotalOverlap: 1, DistinctUnion: 6, DistinctSymmetricDifference: 5, MultisetOverlap: 1},
+				{DistinctOverlap: 1, TotalOverlap: 1, DistinctUnion: 1, MultisetOverlap: 1},
+			},
+		},
+		DistinctOverlap: 1,
+		TotalOverlap:    1,
+		DistinctUnion:   6,
+	}
+	expected.setSimilarity()
+	assert.Equal(t, expected, res)
+}
+
+func Test_FindSetIntersectionWithOptions_InvalidLimit(t *testing.T) {
+	_, err := FindSetIntersectionWithOptions(context.Background(), Options{MemoryLimit: -1}, feed(nil), feed(nil))
+	assert.Error(t, err)
+}
+
+func Test_visitSorted(t *testing.T) {
+	type visited struct {
+		key    string
+		counts []int
+	}
+
+	var res []visited
+	err := visitSorted([]countIterator{
+		newSortedMapIterator(map[string]int{"a": 1, "c": 2}),
+		newSortedMapIterator(map[string]int{}),
+		newSortedMapIterator(map[string]int{"b": 3, "c": 1}),
+	}, func(key string, counts []int) error {
+		res = append(res, visited{key, append([]int{}, counts...)})
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []visited{
+		{"a", []int{1, 0, 0}},
+		{"b", []int{0, 0, 3}},
+		{"c", []int{2, 0, 1}},
+	}, res)
+}
+
+func feed(keys []string) <-chan string {
+	ch := make(chan string, bufferSize)
+	go func() {
+		defer close(ch)
+		for _, k := range keys {
+			ch <- k
+		}
+	}()
+	return ch
+}
+
+func drain(t *testing.T, it countIterator) []keyCount {
+	var res []keyCount
+	for {
+		kc, more, err := it.next()
+		assert.NoError(t, err)
+		if !more {
+			return res
+		}
+		res = append(res, kc)
+	}
+}
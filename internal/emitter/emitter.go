@@ -0,0 +1,211 @@
+package emitter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/rickyshrestha/set-intersection-exercise/internal/reader"
+)
+
+const (
+	// SetCommon is the set of keys found in all of the inputs
+	SetCommon = "common"
+	// setOnlyPrefix is followed by the 1 based no. of the input for the set of keys only found in that input
+	setOnlyPrefix = "only_"
+)
+
+// Emitter writes out keys as they are visited by the counter, without holding on to them.
+// Keys found in all inputs are written along with their count in each input,
+// keys found in only one input are written along with their count in that input.
+// Keys found in some but not all of the inputs are not written.
+// A key made up of more than one column is written as a column each
+type Emitter struct {
+	// common and only have the writer of each set, they are the same writer when writing to a single stream
+	common *csv.Writer
+	only   []*csv.Writer
+	// withSet is true when the set name is written as the first column to tell the sets apart
+	withSet bool
+	// keyColumns is the no. of columns that make up the key
+	keyColumns int
+	files      []*os.File
+	row        []string
+}
+
+// New creates an emitter that writes all of the sets to w, with the name of the set as the first column.
+// keyColumns is the no. of columns that make up the key of each input
+func New(w io.Writer, inputs, keyColumns int) (*Emitter, error) {
+	writer := csv.NewWriter(w)
+
+	e := &Emitter{
+		common:     writer,
+		only:       make([]*csv.Writer, inputs),
+		withSet:    true,
+		keyColumns: keyColumns,
+	}
+	for i := range e.only {
+		e.only[i] = writer
+	}
+
+	if err := writer.Write(append([]string{"set"}, countHeaders(inputs, keyColumns)...)); err != nil {
+		return nil, errors.Wrap(err, "while writing header")
+	}
+
+	return e, nil
+}
+
+// NewDir creates an emitter that writes each set to its own file in dir.
+// Keys found in all inputs go to common.csv and those only in the nth input go to only_n.csv
+func NewDir(dir string, inputs, keyColumns int) (*Emitter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "unable to create directory: %s", dir)
+	}
+
+	e := &Emitter{
+		only:       make([]*csv.Writer, inputs),
+		keyColumns: keyColumns,
+	}
+
+	common, err := e.create(filepath.Join(dir, SetCommon+".csv"), countHeaders(inputs, keyColumns))
+	if err != nil {
+		_ = e.Close()
+		return nil, err
+	}
+	e.common = common
+
+	for i := range e.only {
+		only, err := e.create(filepath.Join(dir, SetOnly(i)+".csv"), append(keyHeaders(keyColumns), "count"))
+		if err != nil {
+			_ = e.Close()
+			return nil, err
+		}
+		e.only[i] = only
+	}
+
+	return e, nil
+}
+
+// SetOnly is the name of the set of keys found only in the ith (0 based) input
+func SetOnly(i int) string {
+	return setOnlyPrefix + strconv.Itoa(i+1)
+}
+
+func (e *Emitter) create(path string, header []string) (*csv.Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create file: %s", path)
+	}
+	e.files = append(e.files, file)
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(header); err != nil {
+		return nil, errors.Wrapf(err, "while writing header: %s", path)
+	}
+
+	return writer, nil
+}
+
+// Visit writes the key to the set it belongs to, it can be used as a counter.KeyVisitor
+func (e *Emitter) Visit(key string, counts []int) error {
+	onlyIn := -1
+	inAll := true
+
+	for i, c := range counts {
+		if c == 0 {
+			inAll = false
+			continue
+		}
+
+		if onlyIn == -1 {
+			onlyIn = i
+		} else {
+			onlyIn = -2
+		}
+	}
+
+	switch {
+	case inAll:
+		return e.write(e.common, SetCommon, key, counts)
+	case onlyIn >= 0:
+		if e.withSet {
+			// keep the count in its column so the rows line up with the header
+			return e.write(e.only[onlyIn], SetOnly(onlyIn), key, counts)
+		}
+		return e.write(e.only[onlyIn], SetOnly(onlyIn), key, counts[onlyIn:onlyIn+1])
+	}
+
+	return nil
+}
+
+func (e *Emitter) write(w *csv.Writer, set, key string, counts []int) error {
+	e.row = e.row[:0]
+	if e.withSet {
+		e.row = append(e.row, set)
+	}
+
+	columns, err := reader.SplitCompositeKey(key, e.keyColumns)
+	if err != nil {
+		return errors.Wrapf(err, "while writing key to %s", set)
+	}
+
+	e.row = append(e.row, columns...)
+	for _, c := range counts {
+		e.row = append(e.row, strconv.Itoa(c))
+	}
+
+	if err := w.Write(e.row); err != nil {
+		return errors.Wrapf(err, "while writing key to %s", set)
+	}
+	return nil
+}
+
+// Close flushes whatever is buffered and closes the files, if any
+func (e *Emitter) Close() error {
+	var firstErr error
+
+	writers := append([]*csv.Writer{e.common}, e.only...)
+	for _, w := range writers {
+		if w == nil {
+			continue
+		}
+
+		w.Flush()
+		if err := w.Error(); err != nil && firstErr == nil {
+			firstErr = errors.Wrap(err, "while flushing keys")
+		}
+	}
+
+	for _, file := range e.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "unable to close file: %s", file.Name())
+		}
+	}
+
+	return firstErr
+}
+
+func countHeaders(inputs, keyColumns int) []string {
+	header := keyHeaders(keyColumns)
+	for i := 0; i < inputs; i++ {
+		header = append(header, fmt.Sprintf("count_%v", i+1))
+	}
+	return header
+}
+
+// keyHeaders is key for a key of one column, and key_n for the nth column of a key made up of more
+func keyHeaders(keyColumns int) []string {
+	if keyColumns == 1 {
+		return []string{"key"}
+	}
+
+	header := make([]string, 0, keyColumns)
+	for i := 0; i < keyColumns; i++ {
+		header = append(header, fmt.Sprintf("key_%v", i+1))
+	}
+	return header
+}
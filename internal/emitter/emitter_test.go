@@ -0,0 +1,117 @@
+package emitter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickyshrestha/set-intersection-exercise/internal/reader"
+)
+
+func Test_New(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := New(&buf, 2, 1)
+	assert.NoError(t, err)
+
+	assert.NoError(t, e.Visit("a", []int{1, 2}))
+	assert.NoError(t, e.Visit("b", []int{3, 0}))
+	assert.NoError(t, e.Visit("c", []int{0, 1}))
+	assert.NoError(t, e.Close())
+
+	assert.Equal(t, `set,key,count_1,count_2
+common,a,1,2
+only_1,b,3,0
+only_2,c,0,1
+`, buf.String())
+}
+
+func Test_New_SkipsPartialOverlap(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := New(&buf, 3, 1)
+	assert.NoError(t, err)
+
+	assert.NoError(t, e.Visit("a", []int{1, 1, 0}))
+	assert.NoError(t, e.Close())
+
+	assert.Equal(t, "set,key,count_1,count_2,count_3\n", buf.String())
+}
+
+func Test_New_QuotesKeys(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := New(&buf, 2, 1)
+	assert.NoError(t, err)
+
+	assert.NoError(t, e.Visit(`a,"b"`, []int{1, 1}))
+	assert.NoError(t, e.Close())
+
+	assert.Equal(t, "set,key,count_1,count_2\ncommon,\"a,\"\"b\"\"\",1,1\n", buf.String())
+}
+
+func Test_New_CompositeKey(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := New(&buf, 2, 2)
+	assert.NoError(t, err)
+
+	assert.NoError(t, e.Visit(reader.CompositeKey([]string{"a:b", "c"}), []int{1, 2}))
+	assert.NoError(t, e.Visit(reader.CompositeKey([]string{"x,y", ""}), []int{3, 0}))
+	assert.Error(t, e.Visit("a", []int{1, 1}))
+	assert.NoError(t, e.Close())
+
+	assert.Equal(t, `set,key_1,key_2,count_1,count_2
+common,a:b,c,1,2
+only_1,"x,y",,3,0
+`, buf.String())
+}
+
+func Test_NewDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+	e, err := NewDir(dir, 2, 1)
+	assert.NoError(t, err)
+
+	assert.NoError(t, e.Visit("a", []int{1, 2}))
+	assert.NoError(t, e.Visit("b", []int{3, 0}))
+	assert.NoError(t, e.Visit("c", []int{0, 1}))
+	assert.NoError(t, e.Visit("d", []int{0, 4}))
+	assert.NoError(t, e.Close())
+
+	for file, expected := range map[string]string{
+		"common.csv": "key,count_1,count_2\na,1,2\n",
+		"only_1.csv": "key,count\nb,3\n",
+		"only_2.csv": "key,count\nc,1\nd,4\n",
+	} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, file))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(content), file)
+	}
+}
+
+func Test_NewDir_CompositeKey(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+	e, err := NewDir(dir, 2, 3)
+	assert.NoError(t, err)
+
+	assert.NoError(t, e.Visit(reader.CompositeKey([]string{"1", "eu", "2021-01-01"}), []int{1, 1}))
+	assert.NoError(t, e.Visit(reader.CompositeKey([]string{"2", "us", "2021-01-02"}), []int{0, 2}))
+	assert.NoError(t, e.Close())
+
+	for file, expected := range map[string]string{
+		"common.csv": "key_1,key_2,key_3,count_1,count_2\n1,eu,2021-01-01,1,1\n",
+		"only_1.csv": "key_1,key_2,key_3,count\n",
+		"only_2.csv": "key_1,key_2,key_3,count\n2,us,2021-01-02,2\n",
+	} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, file))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(content), file)
+	}
+}
+
+func Test_NewDir_Invalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, ioutil.WriteFile(file, nil, 0o600))
+
+	_, err := NewDir(file, 2, 1)
+	assert.Error(t, err)
+}
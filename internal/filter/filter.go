@@ -0,0 +1,166 @@
+// Package filter parses and evaluates the expressions that pick the rows of a file to read the keys of, eg.
+//
+//	status = active and (country in (US, CA) or not region ~ "^eu-") and age >= 18
+//
+// A comparison is between a field and a value. Fields are named as the key columns are, values are bare words or
+// quoted strings, and either can be quoted with " or '. A bare number is compared as a number, a field that is
+// not a number never matches it, and anything else is compared as text. Comparisons are joined with and, or and not, or &&, || and !,
+// not binding tightest and or loosest, and grouped with parentheses.
+package filter
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filter is a parsed filter expression. It matches the values of its fields, which are found by the reader of each row
+type Filter struct {
+	expression string
+	root       node
+	fields     []string
+}
+
+// Fields returns the fields the filter compares, each once in the order they are first used.
+// Match takes their values in the same order
+func (f *Filter) Fields() []string {
+	return f.fields
+}
+
+// Match is whether the row with the values of the fields matches the filter.
+// A field that is missing or null in the row is empty
+func (f *Filter) Match(values []string) bool {
+	return f.root.match(values)
+}
+
+func (f *Filter) String() string {
+	return f.expression
+}
+
+// node is a part of the expression
+type node interface {
+	match(values []string) bool
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n andNode) match(values []string) bool {
+	return n.left.match(values) && n.right.match(values)
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n orNode) match(values []string) bool {
+	return n.left.match(values) || n.right.match(values)
+}
+
+type notNode struct {
+	node node
+}
+
+func (n notNode) match(values []string) bool {
+	return !n.node.match(values)
+}
+
+// compareNode compares the value of a field with a value, op being one of the comparison operators other than the matches
+type compareNode struct {
+	field int
+	op    string
+	value literal
+}
+
+func (n compareNode) match(values []string) bool {
+	c, ok := n.value.compare(values[n.field])
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case opEqual:
+		return c == 0
+	case opNotEqual:
+		return c != 0
+	case opLess:
+		return c < 0
+	case opLessEqual:
+		return c <= 0
+	case opGreater:
+		return c > 0
+	case opGreaterEqual:
+		return c >= 0
+	}
+	return false
+}
+
+// inNode is whether the value of a field is equal to any of the values
+type inNode struct {
+	field  int
+	values []literal
+}
+
+func (n inNode) match(values []string) bool {
+	for _, v := range n.values {
+		if c, ok := v.compare(values[n.field]); ok && c == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// matchNode is whether the regular expression matches the value of a field
+type matchNode struct {
+	field int
+	re    *regexp.Regexp
+}
+
+func (n matchNode) match(values []string) bool {
+	return n.re.MatchString(values[n.field])
+}
+
+// literal is a value of the expression, a bare word that is a number is compared as one
+type literal struct {
+	text     string
+	number   float64
+	isNumber bool
+}
+
+func newLiteral(t token) literal {
+	l := literal{text: t.text}
+	if t.kind == tokenWord {
+		l.number, l.isNumber = parseNumber(t.text)
+	}
+	return l
+}
+
+// compare compares the value of a field with the literal, as numbers when the literal is a number and as text
+// otherwise. A value that is not a number cannot be compared with a number, so that eg. age >= 18 does not match abc
+func (l literal) compare(value string) (int, bool) {
+	if !l.isNumber {
+		return strings.Compare(value, l.text), true
+	}
+
+	n, ok := parseNumber(value)
+	if !ok {
+		return 0, false
+	}
+	switch {
+	case n < l.number:
+		return -1, true
+	case n > l.number:
+		return 1, true
+	}
+	return 0, true
+}
+
+// parseNumber parses a finite number, so that words such as inf or nan are left as text
+func parseNumber(value string) (float64, bool) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,70 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Filter_Match(t *testing.T) {
+	for _, tc := range []struct {
+		expression string
+		values     []string
+		expected   bool
+	}{
+		{"status = active", []string{"active"}, true},
+		{"status = active", []string{"Active"}, false},
+		{"status = active", []string{""}, false},
+		{"status != active", []string{"inactive"}, true},
+		{"status = ''", []string{""}, true},
+
+		// numbers compare as numbers with values that are numbers
+		{"age >= 18", []string{"18"}, true},
+		{"age >= 18", []string{"9"}, false},
+		{"age >= 18", []string{"18.0"}, true},
+		{"age < 18", []string{" 9 "}, true},
+		{"age = 1e2", []string{"100"}, true},
+		// a value that is not a number never matches a number
+		{"age > 18", []string{"abc"}, false},
+		{"age >= 18", []string{"abc"}, false},
+		{"age < 18", []string{"abc"}, false},
+		{"age != 18", []string{""}, false},
+		{"not age >= 18", []string{"abc"}, true},
+		{"age >= 18", []string{"inf"}, false},
+		{"code in (1, 2)", []string{"x"}, false},
+		{"zip = 01234", []string{"1234"}, true},
+		{"zip = '01234'", []string{"1234"}, false},
+		{"zip = '01234'", []string{"01234"}, true},
+
+		// and text compares as text
+		{"created >= 2024-01-01", []string{"2024-03-01"}, true},
+		{"created >= 2024-01-01", []string{"2023-12-31"}, false},
+		{"name < b", []string{"alice"}, true},
+		{"name < b", []string{"bob"}, false},
+
+		{"country in (US, CA)", []string{"CA"}, true},
+		{"country in (US, CA)", []string{"MX"}, false},
+		{"country not in (US, CA)", []string{"MX"}, true},
+		{"code in (1, 2)", []string{"2.0"}, true},
+
+		{"name ~ '^a'", []string{"alice"}, true},
+		{"name ~ '^a'", []string{"bob"}, false},
+		{"name ~ 'li'", []string{"alice"}, true},
+		{"name !~ '^a'", []string{"bob"}, true},
+		{"name ~ '(?i)^A'", []string{"alice"}, true},
+
+		{"a = 1 and b = 2", []string{"1", "2"}, true},
+		{"a = 1 and b = 2", []string{"1", "3"}, false},
+		{"a = 1 or b = 2", []string{"0", "2"}, true},
+		{"a = 1 or b = 2", []string{"0", "0"}, false},
+		{"not a = 1", []string{"1"}, false},
+		{"a = 1 or a = 2 and b = 3", []string{"1", "0"}, true},
+		{"(a = 1 or a = 2) and b = 3", []string{"1", "0"}, false},
+		{"a = 1 and b = 2 or a = 3", []string{"3", "0"}, true},
+	} {
+		f, err := Parse(tc.expression)
+		if assert.NoError(t, err, tc.expression) {
+			assert.Equal(t, tc.expected, f.Match(tc.values), "%s %q", tc.expression, tc.values)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package filter
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// tokenKind is the kind of a token of an expression
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	// tokenWord is a bare word, eg. a field name, a number or a value such as active
+	tokenWord
+	// tokenString is a quoted string
+	tokenString
+	// tokenOperator is one of the comparison operators
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenComma
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenIn
+)
+
+// the comparison operators
+const (
+	opEqual        = "="
+	opNotEqual     = "!="
+	opLess         = "<"
+	opLessEqual    = "<="
+	opGreater      = ">"
+	opGreaterEqual = ">="
+	opMatch        = "~"
+	opNotMatch     = "!~"
+)
+
+// operators are the comparison operators, the longer ones first so that they are found over their prefixes.
+// == is the same as =
+var operators = []string{"==", opNotEqual, opLessEqual, opGreaterEqual, opNotMatch, opEqual, opLess, opGreater, opMatch}
+
+// keywords are the words that are not names or values, unless quoted. They are not case sensitive
+var keywords = map[string]tokenKind{
+	"and": tokenAnd,
+	"or":  tokenOr,
+	"not": tokenNot,
+	"in":  tokenIn,
+}
+
+// token is a token of an expression along with where it starts in it
+type token struct {
+	kind tokenKind
+	// text is the token as written, or the content of a quoted string
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of filter"
+	case tokenString:
+		return "string " + quote(t.text)
+	}
+	return quote(t.text)
+}
+
+func quote(text string) string {
+	return `"` + strings.ReplaceAll(text, `"`, `\"`) + `"`
+}
+
+// specials end a bare word
+const specials = `=!<>~(),"'&|`
+
+// lex splits the expression into its tokens, ending with tokenEOF
+func lex(expression string) ([]token, error) {
+	var tokens []token
+
+	for pos := 0; pos < len(expression); {
+		r, size := utf8.DecodeRuneInString(expression[pos:])
+		if unicode.IsSpace(r) {
+			pos += size
+			continue
+		}
+
+		start := pos
+		rest := expression[pos:]
+
+		switch {
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", pos: start})
+			pos++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", pos: start})
+			pos++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: start})
+			pos++
+		case strings.HasPrefix(rest, "&&"):
+			tokens = append(tokens, token{kind: tokenAnd, text: "&&", pos: start})
+			pos += 2
+		case strings.HasPrefix(rest, "||"):
+			tokens = append(tokens, token{kind: tokenOr, text: "||", pos: start})
+			pos += 2
+		case r == '"' || r == '\'':
+			text, end, err := lexString(expression, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: start})
+			pos = end
+		default:
+			if op := lexOperator(rest); op != "" {
+				text := op
+				if op == "==" {
+					text = opEqual
+				}
+				tokens = append(tokens, token{kind: tokenOperator, text: text, pos: start})
+				pos += len(op)
+				continue
+			}
+
+			if r == '!' {
+				tokens = append(tokens, token{kind: tokenNot, text: "!", pos: start})
+				pos++
+				continue
+			}
+			if strings.ContainsRune(specials, r) {
+				return nil, errors.Errorf("unexpected %q at %v", r, start)
+			}
+
+			end := pos
+			for end < len(expression) {
+				r, size := utf8.DecodeRuneInString(expression[end:])
+				if unicode.IsSpace(r) || strings.ContainsRune(specials, r) {
+					break
+				}
+				end += size
+			}
+
+			word := expression[pos:end]
+			kind, ok := keywords[strings.ToLower(word)]
+			if !ok {
+				kind = tokenWord
+			}
+			tokens = append(tokens, token{kind: kind, text: word, pos: start})
+			pos = end
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(expression)}), nil
+}
+
+func lexOperator(rest string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// lexString reads the string quoted at pos, returning its content and where it ends.
+// A backslash escapes the quote or a backslash, any other backslash is kept as is so that regular expressions read the same
+func lexString(expression string, pos int) (string, int, error) {
+	quoteChar := expression[pos]
+
+	var sb strings.Builder
+	for i := pos + 1; i < len(expression); i++ {
+		c := expression[i]
+		switch {
+		case c == '\\' && i+1 < len(expression) && (expression[i+1] == quoteChar || expression[i+1] == '\\'):
+			sb.WriteByte(expression[i+1])
+			i++
+		case c == quoteChar:
+			return sb.String(), i + 1, nil
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return "", 0, errors.Errorf("unterminated string at %v", pos)
+}
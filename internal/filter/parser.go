@@ -0,0 +1,225 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Parse parses a filter expression, see the package doc for its syntax
+func Parse(expression string) (*Filter, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, errors.New("filter is empty")
+	}
+
+	tokens, err := lex(expression)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid filter (%s)", expression)
+	}
+
+	p := &parser{tokens: tokens, fieldIndex: make(map[string]int)}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = p.unexpected("and, or or the end of the filter")
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid filter (%s)", expression)
+	}
+
+	return &Filter{expression: expression, root: root, fields: p.fields}, nil
+}
+
+// parser is a recursive descent parser of the tokens of an expression:
+//
+//	or         = and { ("or" | "||") and }
+//	and        = unary { ("and" | "&&") unary }
+//	unary      = ("not" | "!") unary | primary
+//	primary    = "(" or ")" | comparison
+//	comparison = field operator value | field ["not"] "in" "(" value { "," value } ")"
+type parser struct {
+	tokens []token
+	pos    int
+
+	fields     []string
+	fieldIndex map[string]int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) unexpected(expected string) error {
+	t := p.peek()
+	return errors.Errorf("expected %s, found %s at %v", expected, t, t.pos)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node: n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.peek().kind == tokenLeftParen {
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenRightParen {
+			return nil, p.unexpected(")")
+		}
+		p.next()
+		return n, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	t := p.peek()
+	if t.kind != tokenWord && t.kind != tokenString {
+		return nil, p.unexpected("a field")
+	}
+	p.next()
+	if t.text == "" {
+		return nil, errors.Errorf("field cannot be empty at %v", t.pos)
+	}
+	field := p.field(t.text)
+
+	switch t := p.peek(); t.kind {
+	case tokenOperator:
+		p.next()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t.text {
+		case opMatch, opNotMatch:
+			re, err := regexp.Compile(value.text)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid regular expression at %v", t.pos)
+			}
+			if t.text == opNotMatch {
+				return notNode{node: matchNode{field: field, re: re}}, nil
+			}
+			return matchNode{field: field, re: re}, nil
+		}
+		return compareNode{field: field, op: t.text, value: value}, nil
+
+	case tokenNot:
+		p.next()
+		if p.peek().kind != tokenIn {
+			return nil, p.unexpected("in")
+		}
+		n, err := p.parseIn(field)
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node: n}, nil
+
+	case tokenIn:
+		return p.parseIn(field)
+	}
+
+	return nil, p.unexpected("a comparison such as =, !=, <, <=, >, >=, ~, !~ or in")
+}
+
+// parseIn parses the list of values of in
+func (p *parser) parseIn(field int) (node, error) {
+	p.next()
+	if p.peek().kind != tokenLeftParen {
+		return nil, p.unexpected("(")
+	}
+	p.next()
+
+	var values []literal
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		if p.peek().kind != tokenComma {
+			break
+		}
+		p.next()
+	}
+
+	if p.peek().kind != tokenRightParen {
+		return nil, p.unexpected(", or )")
+	}
+	p.next()
+
+	return inNode{field: field, values: values}, nil
+}
+
+func (p *parser) parseValue() (literal, error) {
+	t := p.peek()
+	if t.kind != tokenWord && t.kind != tokenString {
+		return literal{}, p.unexpected("a value")
+	}
+	p.next()
+	return newLiteral(t), nil
+}
+
+// field returns the index of the field, adding it if it is new
+func (p *parser) field(name string) int {
+	if i, ok := p.fieldIndex[name]; ok {
+		return i
+	}
+
+	p.fieldIndex[name] = len(p.fields)
+	p.fields = append(p.fields, name)
+	return len(p.fields) - 1
+}
@@ -0,0 +1,154 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// format writes the tree of the node with every part in parentheses, and the fields by name, to check how it was parsed
+func format(n node, fields []string) string {
+	switch n := n.(type) {
+	case andNode:
+		return fmt.Sprintf("(%s and %s)", format(n.left, fields), format(n.right, fields))
+	case orNode:
+		return fmt.Sprintf("(%s or %s)", format(n.left, fields), format(n.right, fields))
+	case notNode:
+		return fmt.Sprintf("(not %s)", format(n.node, fields))
+	case compareNode:
+		return fmt.Sprintf("(%s %s %s)", fields[n.field], n.op, formatLiteral(n.value))
+	case inNode:
+		values := make([]string, len(n.values))
+		for i, v := range n.values {
+			values[i] = formatLiteral(v)
+		}
+		return fmt.Sprintf("(%s in [%s])", fields[n.field], strings.Join(values, " "))
+	case matchNode:
+		return fmt.Sprintf("(%s ~ /%s/)", fields[n.field], n.re)
+	}
+	return fmt.Sprintf("unknown %T", n)
+}
+
+func formatLiteral(l literal) string {
+	if l.isNumber {
+		return fmt.Sprint(l.number)
+	}
+	return quote(l.text)
+}
+
+func Test_Parse(t *testing.T) {
+	for expression, expected := range map[string]string{
+		// comparisons
+		"status = active":                      `(status = "active")`,
+		"status == active":                     `(status = "active")`,
+		"status != active":                     `(status != "active")`,
+		"age < 18":                             `(age < 18)`,
+		"age <= 18":                            `(age <= 18)`,
+		"age > -1.5":                           `(age > -1.5)`,
+		"age >= 1e3":                           `(age >= 1000)`,
+		"age>=18":                              `(age >= 18)`,
+		"  age  >=  18  ":                      `(age >= 18)`,
+		"name ~ '^a.*'":                        `(name ~ /^a.*/)`,
+		"name !~ '^a'":                         `(not (name ~ /^a/))`,
+		`name ~ "\d+\.\d+"`:                    `(name ~ /\d+\.\d+/)`,
+		`name ~ "a\\b"`:                        `(name ~ /a\b/)`,
+		"country in (US, CA)":                  `(country in ["US" "CA"])`,
+		"country IN (US)":                      `(country in ["US"])`,
+		"country not in (US,CA,'New Zealand')": `(not (country in ["US" "CA" "New Zealand"]))`,
+		"zip in (01234, '01234')":              `(zip in [1234 "01234"])`,
+
+		// values and fields
+		`name = "Smith, John"`:      `(name = "Smith, John")`,
+		`name = "say \"hi\""`:       `(name = "say \"hi\"")`,
+		`name = 'say \'hi\''`:       `(name = "say 'hi'")`,
+		`name = ""`:                 `(name = "")`,
+		`"first name" = bob`:        `(first name = "bob")`,
+		`'and' = x`:                 `(and = "x")`,
+		"user.id = a@b.com":         `(user.id = "a@b.com")`,
+		"#2 = x":                    `(#2 = "x")`,
+		"created >= 2024-01-01":     `(created >= "2024-01-01")`,
+		"amount = 12.50":            `(amount = 12.5)`,
+		"value = inf":               `(value = "inf")`,
+		"value = NaN":               `(value = "NaN")`,
+		"status = 'in'":             `(status = "in")`,
+		"naming = x and orange = y": `((naming = "x") and (orange = "y"))`,
+		"état = été":                `(état = "été")`,
+
+		// logic and precedence
+		"a = 1 and b = 2":                         `((a = 1) and (b = 2))`,
+		"a = 1 AND b = 2":                         `((a = 1) and (b = 2))`,
+		"a = 1 && b = 2":                          `((a = 1) and (b = 2))`,
+		"a = 1 or b = 2":                          `((a = 1) or (b = 2))`,
+		"a = 1 || b = 2":                          `((a = 1) or (b = 2))`,
+		"not a = 1":                               `(not (a = 1))`,
+		"!a = 1":                                  `(not (a = 1))`,
+		"! (a = 1)":                               `(not (a = 1))`,
+		"not not a = 1":                           `(not (not (a = 1)))`,
+		"a = 1 or b = 2 and c = 3":                `((a = 1) or ((b = 2) and (c = 3)))`,
+		"a = 1 and b = 2 or c = 3":                `(((a = 1) and (b = 2)) or (c = 3))`,
+		"(a = 1 or b = 2) and c = 3":              `(((a = 1) or (b = 2)) and (c = 3))`,
+		"a = 1 and b = 2 and c = 3":               `(((a = 1) and (b = 2)) and (c = 3))`,
+		"a = 1 or b = 2 or c = 3":                 `(((a = 1) or (b = 2)) or (c = 3))`,
+		"not a = 1 and b = 2":                     `((not (a = 1)) and (b = 2))`,
+		"not (a = 1 and b = 2)":                   `(not ((a = 1) and (b = 2)))`,
+		"((a = 1))":                               `(a = 1)`,
+		"a = 1 and not b in (x) or c ~ 'y'":       `(((a = 1) and (not (b in ["x"]))) or (c ~ /y/))`,
+		"a=1&&(b!=2||!c~'^z')":                    `((a = 1) and ((b != 2) or (not (c ~ /^z/))))`,
+		"status = active and country in (US, CA)": `((status = "active") and (country in ["US" "CA"]))`,
+	} {
+		f, err := Parse(expression)
+		if assert.NoError(t, err, expression) {
+			assert.Equal(t, expected, format(f.root, f.fields), expression)
+			assert.Equal(t, expression, f.String())
+		}
+	}
+}
+
+func Test_Parse_Fields(t *testing.T) {
+	f, err := Parse("b = 1 and a = 2 or b in (3) and not c ~ 'x' and a != 4")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "a", "c"}, f.Fields())
+}
+
+func Test_Parse_Errors(t *testing.T) {
+	for expression, expected := range map[string]string{
+		"":                  "filter is empty",
+		"   ":               "filter is empty",
+		"status":            "expected a comparison such as =, !=, <, <=, >, >=, ~, !~ or in, found end of filter at 6",
+		"status active":     `expected a comparison such as =, !=, <, <=, >, >=, ~, !~ or in, found "active" at 7`,
+		"= active":          `expected a field, found "=" at 0`,
+		"status =":          "expected a value, found end of filter at 8",
+		"status = = x":      `expected a value, found "=" at 9`,
+		"status = and":      `expected a value, found "and" at 9`,
+		"and = x":           `expected a field, found "and" at 0`,
+		"a = 1 b = 2":       `expected and, or or the end of the filter, found "b" at 6`,
+		"a = 1 and":         "expected a field, found end of filter at 9",
+		"a = 1 or or b = 2": `expected a field, found "or" at 9`,
+		"not":               "expected a field, found end of filter at 3",
+		"(a = 1":            "expected ), found end of filter at 6",
+		"a = 1)":            `expected and, or or the end of the filter, found ")" at 5`,
+		"()":                `expected a field, found ")" at 1`,
+		"a in US":           `expected (, found "US" at 5`,
+		"a in ()":           `expected a value, found ")" at 6`,
+		"a in (US,)":        `expected a value, found ")" at 9`,
+		"a in (US CA)":      `expected , or ), found "CA" at 9`,
+		"a in (US":          "expected , or ), found end of filter at 8",
+		"a not = 1":         `expected in, found "=" at 6`,
+		"a ~ '('":           "invalid regular expression at 2",
+		"a = 'open":         "unterminated string at 4",
+		`a = "open\"`:       "unterminated string at 4",
+		"a = 1 & b = 2":     `unexpected '&' at 6`,
+		"a = 1 | b = 2":     `unexpected '|' at 6`,
+		"'' = x":            "field cannot be empty at 0",
+		"a = x, b = y":      `expected and, or or the end of the filter, found "," at 5`,
+		"a < in (1)":        `expected a value, found "in" at 4`,
+		"name = 'it''s'":    `expected and, or or the end of the filter, found string "s" at 11`,
+	} {
+		_, err := Parse(expression)
+		if assert.Error(t, err, expression) {
+			assert.Contains(t, err.Error(), expected, expression)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/rickyshrestha/set-intersection-exercise/internal/counter"
+)
+
+// Format is the format the result is written in
+type Format string
+
+// supported formats
+const (
+	// FormatTable is the table shown on the terminal, it is not written by Write
+	FormatTable    Format = "table"
+	FormatJSON     Format = "json"
+	FormatYAML     Format = "yaml"
+	FormatCsv      Format = "csv"
+	FormatKeyValue Format = "kv"
+)
+
+// ParseFormat parses the name of an output format
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case FormatTable, FormatJSON, FormatYAML, FormatCsv, FormatKeyValue:
+		return format, nil
+	case "yml":
+		return FormatYAML, nil
+	case "":
+		return FormatTable, nil
+	}
+
+	return "", errors.Errorf("unknown output format: %s", name)
+}
+
+// Input is a file that was compared
+type Input struct {
+	Path string `json:"path" yaml:"path"`
+	// Key has the columns that make up the key of the file
+	Key []string `json:"key" yaml:"key"`
+}
+
+// Report is the result along with what it is the result of
+type Report struct {
+	// Inputs are in the same order as the files of the result
+	Inputs []Input `json:"inputs" yaml:"inputs"`
+	// ElapsedSeconds is the time taken to find the result
+	ElapsedSeconds             float64 `json:"elapsed_seconds" yaml:"elapsed_seconds"`
+	counter.IntersectionResult `yaml:",inline"`
+}
+
+// NewReport creates the report of the result
+func NewReport(inputs []Input, result counter.IntersectionResult, elapsed time.Duration) Report {
+	return Report{
+		Inputs:             inputs,
+		ElapsedSeconds:     elapsed.Seconds(),
+		IntersectionResult: result,
+	}
+}
+
+// Write writes the report to w in the format
+func Write(w io.Writer, format Format, report Report) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return errors.Wrap(encoder.Encode(report), "unable to write json")
+	case FormatYAML:
+		encoder := yaml.NewEncoder(w)
+		if err := encoder.Encode(report); err != nil {
+			return errors.Wrap(err, "unable to write yaml")
+		}
+		return errors.Wrap(encoder.Close(), "unable to write yaml")
+	case FormatCsv:
+		return writeCsv(w, report)
+	case FormatKeyValue:
+		return writeKeyValue(w, report)
+	}
+
+	return errors.Errorf("cannot write output format: %s", format)
+}
+
+// field is a value of the report named by its path, eg. files.0.key_count
+type field struct {
+	name  string
+	value string
+}
+
+// flatten lists the values of the report in the order they are in the json
+func flatten(report Report) []field {
+	var fields []field
+	add := func(value interface{}, name ...interface{}) {
+		parts := make([]string, len(name))
+		for i, n := range name {
+			parts[i] = fmt.Sprint(n)
+		}
+		fields = append(fields, field{name: strings.Join(parts, "."), value: fmt.Sprint(value)})
+	}
+
+	for i, input := range report.Inputs {
+		add(input.Path, "inputs", i, "path")
+		add(strings.Join(input.Key, ","), "inputs", i, "key")
+	}
+	add(strconv.FormatFloat(report.ElapsedSeconds, 'f', -1, 64), "elapsed_seconds")
+
+	// the errors of estimated counts follow the counts
+	approximate := report.Approximate
+	addCount := func(value, errorBound int, name ...interface{}) {
+		add(value, name...)
+		if approximate {
+			last := len(name) - 1
+			add(errorBound, append(name[:last:last], fmt.Sprint(name[last], "_error"))...)
+		}
+	}
+
+	addSimilarity := func(similarity counter.Similarity, name ...interface{}) {
+		for _, ratio := range []struct {
+			name  string
+			value float64
+		}{
+			{"jaccard", similarity.Jaccard},
+			{"containment_of_first", similarity.ContainmentOfFirst},
+			{"containment_of_second", similarity.ContainmentOfSecond},
+			{"overlap_coefficient", similarity.OverlapCoefficient},
+			{"dice", similarity.Dice},
+		} {
+			add(strconv.FormatFloat(ratio.value, 'f', -1, 64), append(name[:len(name):len(name)], ratio.name)...)
+		}
+	}
+
+	if approximate {
+		add(true, "approximate")
+	}
+
+	for i, file := range report.Files {
+		add(file.KeyCount, "files", i, "key_count")
+		addCount(file.DistinctKeyCount, file.DistinctKeyCountError, "files", i, "distinct_key_count")
+		addCount(file.ExclusiveKeyCount, file.ExclusiveKeyCountError, "files", i, "exclusive_key_count")
+		addCount(file.DistinctExclusiveKeyCount, file.DistinctExclusiveKeyCountError, "files", i, "distinct_exclusive_key_count")
+		if file.ExclusiveKeyCountSaturated {
+			add(true, "files", i, "exclusive_key_count_saturated")
+		}
+		if file.SkippedRows > 0 {
+			add(file.SkippedRows, "files", i, "skipped_rows")
+		}
+		if file.ExcludedKeyCount > 0 {
+			add(file.ExcludedKeyCount, "files", i, "excluded_key_count")
+		}
+		for j, key := range file.NullKeys {
+			add(key.Key, "files", i, "null_keys", j, "key")
+			add(key.Count, "files", i, "null_keys", j, "count")
+		}
+
+		for j, bucket := range file.Histogram {
+			add(bucket.Min, "files", i, "histogram", j, "min")
+			add(bucket.Max, "files", i, "histogram", j, "max")
+			add(bucket.DistinctKeys, "files", i, "histogram", j, "distinct_keys")
+			add(bucket.Keys, "files", i, "histogram", j, "keys")
+		}
+		for j, key := range file.TopKeys {
+			add(key.Key, "files", i, "top_keys", j, "key")
+			add(key.Count, "files", i, "top_keys", j, "count")
+		}
+	}
+
+	for i := range report.Pairs {
+		for j, overlap := range report.Pairs[i] {
+			addCount(overlap.TotalOverlap, overlap.TotalOverlapError, "pairs", i, j, "total_overlap")
+			if overlap.BigTotalOverlap != nil {
+				add(overlap.BigTotalOverlap.String(), "pairs", i, j, "big_total_overlap")
+			}
+			addCount(overlap.DistinctOverlap, overlap.DistinctOverlapError, "pairs", i, j, "distinct_overlap")
+			addCount(overlap.DistinctDifference, overlap.DistinctDifferenceError, "pairs", i, j, "distinct_difference")
+			addCount(overlap.DistinctUnion, overlap.DistinctUnionError, "pairs", i, j, "distinct_union")
+			addCount(overlap.DistinctSymmetricDifference, overlap.DistinctSymmetricDifferenceError, "pairs", i, j, "distinct_symmetric_difference")
+			addCount(overlap.MultisetOverlap, overlap.MultisetOverlapError, "pairs", i, j, "multiset_overlap")
+			if overlap.MultisetOverlapSaturated {
+				add(true, "pairs", i, j, "multiset_overlap_saturated")
+			}
+			addSimilarity(overlap.DistinctSimilarity, "pairs", i, j, "distinct_similarity")
+			addSimilarity(overlap.WeightedSimilarity, "pairs", i, j, "weighted_similarity")
+		}
+	}
+
+	addCount(report.TotalOverlap, report.TotalOverlapError, "total_overlap")
+	if report.BigTotalOverlap != nil {
+		add(report.BigTotalOverlap.String(), "big_total_overlap")
+	}
+	addCount(report.DistinctOverlap, report.DistinctOverlapError, "distinct_overlap")
+	addCount(report.DistinctUnion, report.DistinctUnionError, "distinct_union")
+
+	for i, key := range report.TopOverlapKeys {
+		counts := make([]string, len(key.Counts))
+		for j, c := range key.Counts {
+			counts[j] = strconv.Itoa(c)
+		}
+		add(key.Key, "top_overlap_keys", i, "key")
+		add(strings.Join(counts, ","), "top_overlap_keys", i, "counts")
+		add(key.Overlap, "top_overlap_keys", i, "overlap")
+	}
+
+	return fields
+}
+
+// writeCsv writes a name,value row for each value of the report
+func writeCsv(w io.Writer, report Report) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"name", "value"}); err != nil {
+		return errors.Wrap(err, "unable to write csv")
+	}
+
+	for _, f := range flatten(report) {
+		if err := writer.Write([]string{f.name, f.value}); err != nil {
+			return errors.Wrap(err, "unable to write csv")
+		}
+	}
+
+	writer.Flush()
+	return errors.Wrap(writer.Error(), "unable to write csv")
+}
+
+// writeKeyValue writes a name=value line for each value of the report, values with spaces or quotes are quoted
+func writeKeyValue(w io.Writer, report Report) error {
+	for _, f := range flatten(report) {
+		value := f.value
+		if value == "" || strings.ContainsAny(value, " \t\r\n\"'=\\") {
+			value = strconv.Quote(value)
+		}
+
+		if _, err := fmt.Fprintf(w, "%s=%s\n", f.name, value); err != nil {
+			return errors.Wrap(err, "unable to write key values")
+		}
+	}
+
+	return nil
+}
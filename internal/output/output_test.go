@@ -0,0 +1,166 @@
+package output
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickyshrestha/set-intersection-exercise/internal/counter"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func dummyReport() Report {
+	same := counter.Similarity{Jaccard: 1, ContainmentOfFirst: 1, ContainmentOfSecond: 1, OverlapCoefficient: 1, Dice: 1}
+	return NewReport(
+		[]Input{
+			{Path: "./testdata/first.csv", Key: []string{"id"}},
+			{Path: "./testdata/second file.csv", Key: []string{"user_id", "region"}},
+		},
+		counter.IntersectionResult{
+			Files: []counter.FileResult{
+				{KeyCount: 8, DistinctKeyCount: 6, ExclusiveKeyCount: 2, DistinctExclusiveKeyCount: 2},
+				{KeyCount: 9, DistinctKeyCount: 6, ExclusiveKeyCount: 2, DistinctExclusiveKeyCount: 2},
+			},
+			Pairs: [][]counter.Overlap{
+				{
+					{DistinctOverlap: 6, TotalOverlap: 12, DistinctUnion: 6, MultisetOverlap: 8, DistinctSimilarity: same, WeightedSimilarity: same},
+					{
+						DistinctOverlap: 4, TotalOverlap: 11, DistinctDifference: 2, DistinctUnion: 8, DistinctSymmetricDifference: 4, MultisetOverlap: 5,
+						DistinctSimilarity: counter.Similarity{Jaccard: 0.5, ContainmentOfFirst: 4.0 / 6, ContainmentOfSecond: 4.0 / 6, OverlapCoefficient: 4.0 / 6, Dice: 8.0 / 12},
+						WeightedSimilarity: counter.Similarity{Jaccard: 5.0 / 12, ContainmentOfFirst: 5.0 / 8, ContainmentOfSecond: 5.0 / 9, OverlapCoefficient: 5.0 / 8, Dice: 10.0 / 17},
+					},
+				},
+				{
+					{
+						DistinctOverlap: 4, TotalOverlap: 11, DistinctDifference: 2, DistinctUnion: 8, DistinctSymmetricDifference: 4, MultisetOverlap: 5,
+						DistinctSimilarity: counter.Similarity{Jaccard: 0.5, ContainmentOfFirst: 4.0 / 6, ContainmentOfSecond: 4.0 / 6, OverlapCoefficient: 4.0 / 6, Dice: 8.0 / 12},
+						WeightedSimilarity: counter.Similarity{Jaccard: 5.0 / 12, ContainmentOfFirst: 5.0 / 9, ContainmentOfSecond: 5.0 / 8, OverlapCoefficient: 5.0 / 8, Dice: 10.0 / 17},
+					},
+					{DistinctOverlap: 6, TotalOverlap: 17, DistinctUnion: 6, MultisetOverlap: 9, DistinctSimilarity: same, WeightedSimilarity: same},
+				},
+			},
+			DistinctOverlap: 4,
+			TotalOverlap:    11,
+			DistinctUnion:   8,
+		},
+		1500*time.Millisecond,
+	)
+}
+
+// dummyApproximateReport is dummyReport with the counts estimated, one of them exactly
+func dummyApproximateReport() Report {
+	report := dummyReport()
+	report.Approximate = true
+	report.DistinctUnionError = 1
+	report.DistinctOverlapError = 2
+	report.TotalOverlapError = 3
+	report.Files[0].DistinctKeyCountError = 1
+	report.Files[1].ExclusiveKeyCountError = 1
+	report.Pairs[0][1].DistinctOverlapError = 1
+	report.Pairs[1][0].DistinctOverlapError = 1
+	report.Pairs[0][1].MultisetOverlapError = 2
+	report.Pairs[1][0].MultisetOverlapError = 2
+	return report
+}
+
+// dummyTopKeysReport is dummyReport with the frequencies of the keys
+func dummyTopKeysReport() Report {
+	report := dummyReport()
+	report.Files[0].Histogram = []counter.HistogramBucket{
+		{Min: 1, Max: 1, DistinctKeys: 4, Keys: 4},
+		{Min: 2, Max: 2, DistinctKeys: 2, Keys: 4},
+	}
+	report.Files[0].TopKeys = []counter.KeyFrequency{{Key: "D", Count: 2}, {Key: "F", Count: 2}}
+	report.Files[1].Histogram = []counter.HistogramBucket{
+		{Min: 1, Max: 1, DistinctKeys: 4, Keys: 4},
+		{Min: 2, Max: 2, DistinctKeys: 1, Keys: 2},
+		{Min: 3, Max: 10, DistinctKeys: 1, Keys: 3},
+	}
+	report.Files[1].TopKeys = []counter.KeyFrequency{{Key: "F", Count: 3}, {Key: "C", Count: 2}}
+	report.TopOverlapKeys = []counter.OverlapKey{{Key: "F", Counts: []int{2, 3}, Overlap: 6}, {Key: "C", Counts: []int{1, 2}, Overlap: 2}}
+	return report
+}
+
+// dummyBigReport is dummyReport with total overlaps too large for an int, and counts kept at the largest int
+func dummyBigReport() Report {
+	report := dummyReport()
+	report.Files[1].ExclusiveKeyCount, report.Files[1].ExclusiveKeyCountSaturated = math.MaxInt64, true
+	report.Pairs[1][1].MultisetOverlap, report.Pairs[1][1].MultisetOverlapSaturated = math.MaxInt64, true
+	total, _ := new(big.Int).SetString("85070591730234615865843651857942052864", 10)
+	report.TotalOverlap, report.BigTotalOverlap = math.MaxInt64, total
+	report.Pairs[0][1].TotalOverlap, report.Pairs[0][1].BigTotalOverlap = math.MaxInt64, total
+	report.Pairs[1][0].TotalOverlap, report.Pairs[1][0].BigTotalOverlap = math.MaxInt64, total
+	return report
+}
+
+// dummySkippedReport is dummyReport with malformed rows skipped from the second file
+func dummySkippedReport() Report {
+	report := dummyReport()
+	report.Files[1].SkippedRows = 3
+	return report
+}
+
+// dummyNullKeysReport is dummyReport with null keys left out of both files, and counted separately in the second
+func dummyNullKeysReport() Report {
+	report := dummyReport()
+	report.Files[0].ExcludedKeyCount = 2
+	report.Files[1].ExcludedKeyCount = 5
+	report.Files[1].NullKeys = []counter.KeyFrequency{{Key: "", Count: 3}, {Key: "NULL", Count: 2}}
+	return report
+}
+
+func Test_Write_Golden(t *testing.T) {
+	for name, report := range map[string]Report{
+		"report":             dummyReport(),
+		"report_approximate": dummyApproximateReport(),
+		"report_top_keys":    dummyTopKeysReport(),
+		"report_big":         dummyBigReport(),
+		"report_skipped":     dummySkippedReport(),
+		"report_null_keys":   dummyNullKeysReport(),
+	} {
+		for _, format := range []Format{FormatJSON, FormatYAML, FormatCsv, FormatKeyValue} {
+			var buf bytes.Buffer
+			assert.NoError(t, Write(&buf, format, report), format)
+
+			golden := filepath.Join("testdata", name+"."+string(format))
+			if *update {
+				assert.NoError(t, ioutil.WriteFile(golden, buf.Bytes(), 0o644))
+			}
+
+			expected, err := ioutil.ReadFile(golden)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), buf.String(), golden)
+		}
+	}
+}
+
+func Test_Write_Table(t *testing.T) {
+	assert.Error(t, Write(&bytes.Buffer{}, FormatTable, dummyReport()))
+}
+
+func Test_ParseFormat(t *testing.T) {
+	for name, expected := range map[string]Format{
+		"":      FormatTable,
+		"table": FormatTable,
+		"JSON":  FormatJSON,
+		"yaml":  FormatYAML,
+		"yml":   FormatYAML,
+		"csv":   FormatCsv,
+		"kv":    FormatKeyValue,
+	} {
+		format, err := ParseFormat(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, format, name)
+	}
+
+	_, err := ParseFormat("xml")
+	assert.Error(t, err)
+}
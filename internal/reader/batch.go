@@ -0,0 +1,156 @@
+package reader
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultBatchSize is the no. of keys sent at a time when Options.BatchSize is not set
+const DefaultBatchSize = 1024
+
+// ReadKeyBatchesFunc reads the keys from the reader into the channel in batches of up to Options.BatchSize keys,
+// so that there is one channel send per batch instead of per key. A batch is not used by the reader once sent,
+// the receiver is free to keep it. It stops with the error of the context once the context is done
+type ReadKeyBatchesFunc func(ctx context.Context, opts Options, reader io.Reader, batchesOutput chan<- []string) error
+
+// batchSize is the no. of keys in a batch
+func (o Options) batchSize() int {
+	if o.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return o.BatchSize
+}
+
+// batcher collects keys into a batch and sends it once it is full
+type batcher struct {
+	ctx    context.Context
+	output chan<- []string
+	size   int
+	batch  []string
+}
+
+func newBatcher(ctx context.Context, opts Options, output chan<- []string) *batcher {
+	return &batcher{
+		ctx:    ctx,
+		output: output,
+		size:   opts.batchSize(),
+	}
+}
+
+// add adds the key to the batch, sending it when full
+func (b *batcher) add(key string) error {
+	if b.batch == nil {
+		b.batch = make([]string, 0, b.size)
+	}
+
+	b.batch = append(b.batch, key)
+	if len(b.batch) < b.size {
+		return nil
+	}
+	return b.flush()
+}
+
+// flush sends the keys of the batch so far, if any, unless the context is done first
+func (b *batcher) flush() error {
+	if len(b.batch) == 0 {
+		return nil
+	}
+
+	select {
+	case b.output <- b.batch:
+		b.batch = nil
+		return nil
+	case <-b.ctx.Done():
+		return b.ctx.Err()
+	}
+}
+
+// readBatches reads the keys with read into batches sent to the channel, the last batch is sent once read returns
+func readBatches(ctx context.Context, opts Options, batchesOutput chan<- []string, read func(emit func(key string) error) error) error {
+	b := newBatcher(ctx, opts, batchesOutput)
+	if err := read(b.add); err != nil {
+		return err
+	}
+	return b.flush()
+}
+
+// Batched adapts a ReadKeysFunc sending one key at a time into a ReadKeyBatchesFunc.
+// The keys are batched as they come in, so a reader that only sends keys can be used where batches are expected
+func Batched(readKeys ReadKeysFunc) ReadKeyBatchesFunc {
+	return func(ctx context.Context, opts Options, reader io.Reader, batchesOutput chan<- []string) error {
+		keys := make(chan string, opts.batchSize())
+		errs := make(chan error, 1)
+
+		go func() {
+			defer close(keys)
+			errs <- readKeys(ctx, opts, reader, keys)
+		}()
+
+		err := readBatches(ctx, opts, batchesOutput, func(emit func(key string) error) error {
+			for key := range keys {
+				if err := emit(key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		// the reader stops once the context is done, even when its keys are no longer taken
+		if readErr := <-errs; readErr != nil {
+			return readErr
+		}
+		return err
+	}
+}
+
+// Unbatched adapts a ReadKeyBatchesFunc into a ReadKeysFunc sending the keys of each batch one at a time.
+// The readers of every format send batches, the readers sending keys are made from them with it
+func Unbatched(readBatches ReadKeyBatchesFunc) ReadKeysFunc {
+	return func(ctx context.Context, opts Options, reader io.Reader, keysOuput chan<- string) error {
+		batches := make(chan []string, 1)
+		errs := make(chan error, 1)
+
+		go func() {
+			defer close(batches)
+			errs <- readBatches(ctx, opts, reader, batches)
+		}()
+
+		// the batches are still taken once a key cannot be sent, until the reader stops as the context is done
+		var err error
+		for batch := range batches {
+			for _, key := range batch {
+				if err == nil {
+					err = sendKey(ctx, keysOuput, key)
+				}
+			}
+		}
+
+		if readErr := <-errs; readErr != nil {
+			return readErr
+		}
+		return err
+	}
+}
+
+// BatchedForFormat returns the function to read batches of keys from files in the format.
+// For FormatAuto the format is picked using the path
+func BatchedForFormat(format Format, path string) (ReadKeyBatchesFunc, error) {
+	if format == FormatAuto {
+		format = FormatFromPath(path)
+	}
+
+	switch format {
+	case FormatCsv:
+		return ReadKeyBatchesFromCsvIntoChannel, nil
+	case FormatJSONLines:
+		return ReadKeyBatchesFromJSONLinesIntoChannel, nil
+	case FormatJSON:
+		return ReadKeyBatchesFromJSONArrayIntoChannel, nil
+	case FormatParquet:
+		return ReadKeyBatchesFromParquetIntoChannel, nil
+	}
+
+	return nil, errors.Errorf("unknown format: %s", format)
+}
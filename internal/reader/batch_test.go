@@ -0,0 +1,183 @@
+package reader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func readBatchesOf(t *testing.T, read ReadKeyBatchesFunc, opts Options, content string) ([][]string, error) {
+	t.Helper()
+
+	outputChan := make(chan []string, 16)
+	err := read(context.Background(), opts, strings.NewReader(content), outputChan)
+	close(outputChan)
+
+	var batches [][]string
+	for batch := range outputChan {
+		batches = append(batches, batch)
+	}
+	return batches, err
+}
+
+func Test_ReadKeyBatchesFromCsvIntoChannel(t *testing.T) {
+	content := "key\na\nb\nc\n"
+
+	batches, err := readBatchesOf(t, ReadKeyBatchesFromCsvIntoChannel, Options{Key: []string{"key"}, BatchSize: 2}, content)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, batches)
+
+	batches, err = readBatchesOf(t, ReadKeyBatchesFromCsvIntoChannel, Options{Key: []string{"key"}}, content)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "b", "c"}}, batches)
+
+	batches, err = readBatchesOf(t, ReadKeyBatchesFromCsvIntoChannel, Options{Key: []string{"key"}}, "")
+	assert.NoError(t, err)
+	assert.Empty(t, batches)
+
+	_, err = readBatchesOf(t, ReadKeyBatchesFromCsvIntoChannel, Options{Key: []string{"other"}}, content)
+	assert.Error(t, err)
+}
+
+func Test_ReadKeyBatchesFromJSONIntoChannel(t *testing.T) {
+	opts := Options{Key: []string{"user.id"}, BatchSize: 2}
+
+	batches, err := readBatchesOf(t, ReadKeyBatchesFromJSONLinesIntoChannel, opts, dummyJSONLines)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}, {"3"}}, batches)
+
+	batches, err = readBatchesOf(t, ReadKeyBatchesFromJSONArrayIntoChannel, opts, dummyJSONArray)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}, {"3"}}, batches)
+}
+
+func Test_ReadKeyBatchesFromCsvIntoChannel_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// nobody reads the channel, so the reader would block forever if it did not stop on the context
+	err := ReadKeyBatchesFromCsvIntoChannel(ctx, Options{Key: []string{"key"}, BatchSize: 1}, strings.NewReader(dummyFile), make(chan []string))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func Test_Batched(t *testing.T) {
+	content := "key\na\nb\nc\n"
+
+	batches, err := readBatchesOf(t, Batched(ReadKeysFromCsvIntoChannel), Options{Key: []string{"key"}, BatchSize: 2}, content)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, batches)
+
+	_, err = readBatchesOf(t, Batched(ReadKeysFromCsvIntoChannel), Options{Key: []string{"other"}}, content)
+	assert.Error(t, err)
+
+	failed := errors.New("failed")
+	_, err = readBatchesOf(t, Batched(func(ctx context.Context, opts Options, reader io.Reader, keysOuput chan<- string) error {
+		return failed
+	}), Options{}, content)
+	assert.Equal(t, failed, err)
+}
+
+func Test_Batched_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Batched(ReadKeysFromCsvIntoChannel)(ctx, Options{Key: []string{"key"}, BatchSize: 1}, strings.NewReader(dummyFile), make(chan []string))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func Test_Unbatched(t *testing.T) {
+	keys, err := readJSONKeys(t, Unbatched(ReadKeyBatchesFromCsvIntoChannel), Options{Key: []string{"key"}, BatchSize: 2}, "key\na\nb\nc\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+
+	failed := errors.New("failed")
+	_, err = readJSONKeys(t, Unbatched(func(ctx context.Context, opts Options, reader io.Reader, batchesOutput chan<- []string) error {
+		batchesOutput <- []string{"a"}
+		return failed
+	}), Options{}, "")
+	assert.Equal(t, failed, err)
+}
+
+func Test_Unbatched_Canceled(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// nobody reads the channel, the reader of the batches stops along with the keys that are no longer sent
+	err := Unbatched(ReadKeyBatchesFromCsvIntoChannel)(ctx, Options{Key: []string{"key"}, BatchSize: 1}, strings.NewReader(dummyFile), make(chan string))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func Test_BatchedForFormat(t *testing.T) {
+	for _, tc := range []struct {
+		format   Format
+		path     string
+		expected ReadKeyBatchesFunc
+	}{
+		{FormatAuto, "a.csv", ReadKeyBatchesFromCsvIntoChannel},
+		{FormatAuto, "a.jsonl", ReadKeyBatchesFromJSONLinesIntoChannel},
+		{FormatJSON, "a", ReadKeyBatchesFromJSONArrayIntoChannel},
+		{FormatAuto, "a.parquet", ReadKeyBatchesFromParquetIntoChannel},
+	} {
+		read, err := BatchedForFormat(tc.format, tc.path)
+		assert.NoError(t, err)
+		assert.Equal(t, reflect.ValueOf(tc.expected).Pointer(), reflect.ValueOf(read).Pointer(), "%s %s", tc.format, tc.path)
+	}
+
+	_, err := BatchedForFormat(Format("xml"), "a.xml")
+	assert.Error(t, err)
+}
+
+// smallKeysFile has short keys, where passing the keys around takes the most time
+func smallKeysFile(rows int) string {
+	var sb strings.Builder
+	sb.WriteString("key\n")
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&sb, "%x\n", i)
+	}
+	return sb.String()
+}
+
+// Benchmark_ReadKeysFromCsv compares sending the keys one at a time, in batches and through the Batched adapter
+func Benchmark_ReadKeysFromCsv(b *testing.B) {
+	content := smallKeysFile(100000)
+	opts := Options{Key: []string{"key"}}
+
+	b.Run("keys", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			outputChan := make(chan string, DefaultBatchSize)
+			go func() {
+				defer close(outputChan)
+				_ = ReadKeysFromCsvIntoChannel(context.Background(), opts, strings.NewReader(content), outputChan)
+			}()
+			for range outputChan {
+			}
+		}
+	})
+
+	for name, read := range map[string]ReadKeyBatchesFunc{
+		"batches": ReadKeyBatchesFromCsvIntoChannel,
+		"batched": Batched(ReadKeysFromCsvIntoChannel),
+	} {
+		read := read
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				outputChan := make(chan []string, 4)
+				go func() {
+					defer close(outputChan)
+					_ = read(context.Background(), opts, strings.NewReader(content), outputChan)
+				}()
+				for range outputChan {
+				}
+			}
+		})
+	}
+}
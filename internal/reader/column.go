@@ -0,0 +1,99 @@
+package reader
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// column is a column of a key, or a field along the path of one, found by its name or by its position.
+// A column is given by index as #n, eg. #1 for the first column, or #0 when Options.ZeroBased.
+// A name starting with # is escaped as \#
+type column struct {
+	// spec is the column as it was given
+	spec string
+	name string
+	// index is the zero-based position of the column, -1 when it is found by name
+	index int
+}
+
+func (c column) byIndex() bool {
+	return c.index >= 0
+}
+
+func (c column) String() string {
+	return c.spec
+}
+
+// parseColumn parses a column given by name or by index, see column.
+// bareIndex is set when there are no names to find a column by, a number is then taken to be an index as well
+func parseColumn(spec string, opts Options, bareIndex bool) (column, error) {
+	switch {
+	case strings.HasPrefix(spec, `\#`):
+		return column{spec: spec, name: spec[1:], index: -1}, nil
+	case strings.HasPrefix(spec, "#"):
+		return parseIndex(spec, spec[1:], opts)
+	case bareIndex && isDigits(spec):
+		return parseIndex(spec, spec, opts)
+	}
+	return column{spec: spec, name: spec, index: -1}, nil
+}
+
+func parseIndex(spec, number string, opts Options) (column, error) {
+	index, err := strconv.Atoi(number)
+	if err != nil || !isDigits(number) {
+		return column{}, errors.Errorf("invalid column index: %s", spec)
+	}
+
+	index -= opts.firstIndex()
+	if index < 0 {
+		return column{}, errors.Errorf("invalid column index, the first column is #%v: %s", opts.firstIndex(), spec)
+	}
+	return column{spec: spec, index: index}, nil
+}
+
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseColumns parses each column of the key, see parseColumn
+func parseColumns(opts Options, bareIndex bool) ([]column, error) {
+	if len(opts.Key) == 0 {
+		return nil, errors.New("key columns are empty")
+	}
+
+	columns := make([]column, len(opts.Key))
+	for i, spec := range opts.Key {
+		var err error
+		if columns[i], err = parseColumn(spec, opts, bareIndex); err != nil {
+			return nil, errors.Wrapf(err, "invalid key (%s)", spec)
+		}
+	}
+	return columns, nil
+}
+
+// firstIndex is the index of the first column
+func (o Options) firstIndex() int {
+	if o.ZeroBased {
+		return 0
+	}
+	return 1
+}
+
+// pathString joins the fields of a path as they were given
+func pathString(path []column) string {
+	fields := make([]string, len(path))
+	for i, field := range path {
+		fields[i] = field.spec
+	}
+	return strings.Join(fields, ".")
+}
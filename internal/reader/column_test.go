@@ -0,0 +1,110 @@
+package reader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseColumn(t *testing.T) {
+	for _, tc := range []struct {
+		spec      string
+		zeroBased bool
+		bareIndex bool
+		expected  column
+	}{
+		{"id", false, false, column{spec: "id", name: "id", index: -1}},
+		{"#1", false, false, column{spec: "#1", index: 0}},
+		{"#0", true, false, column{spec: "#0", index: 0}},
+		{"#12", false, true, column{spec: "#12", index: 11}},
+		{"3", false, false, column{spec: "3", name: "3", index: -1}},
+		{"3", false, true, column{spec: "3", index: 2}},
+		{"3", true, true, column{spec: "3", index: 3}},
+		{`\#1`, false, true, column{spec: `\#1`, name: "#1", index: -1}},
+		{"id", false, true, column{spec: "id", name: "id", index: -1}},
+	} {
+		c, err := parseColumn(tc.spec, Options{ZeroBased: tc.zeroBased}, tc.bareIndex)
+		assert.NoError(t, err, tc.spec)
+		assert.Equal(t, tc.expected, c, tc.spec)
+	}
+
+	for _, spec := range []string{"#", "#a", "#-1", "#+1", "#0", "#1.5"} {
+		_, err := parseColumn(spec, Options{}, false)
+		assert.Error(t, err, spec)
+	}
+
+	_, err := parseColumn("0", Options{}, true)
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromCsvIntoChannel_ColumnIndex(t *testing.T) {
+	content := "id,key,name\n1,a,x\n2,b,y\n"
+
+	for _, tc := range []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{"index", Options{Key: []string{"#2"}}, []string{"a", "b"}},
+		{"zero based", Options{Key: []string{"#1"}, ZeroBased: true}, []string{"a", "b"}},
+		{"name and index", Options{Key: []string{"name", "#1"}}, []string{"1:x1:1", "1:y1:2"}},
+		{"no header", Options{Key: []string{"2"}, NoHeader: true}, []string{"key", "a", "b"}},
+		{"no header zero based", Options{Key: []string{"#0", "2"}, NoHeader: true, ZeroBased: true}, []string{"2:id4:name", "1:11:x", "1:21:y"}},
+	} {
+		keys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, tc.opts, content)
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.expected, keys, tc.name)
+	}
+
+	for _, opts := range []Options{
+		{Key: []string{"#4"}},
+		{Key: []string{"key"}, NoHeader: true},
+		{Key: []string{"#4"}, NoHeader: true},
+		{Key: []string{"#0"}},
+	} {
+		_, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, content)
+		assert.Error(t, err, opts.Key)
+	}
+
+	// a row without the key column is an error rather than a panic
+	_, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, Options{Key: []string{"#3"}, NoHeader: true, Csv: CsvDialect{FieldsPerRecord: -1}}, "1,a,x\n2,b\n")
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromJSONIntoChannel_ColumnIndex(t *testing.T) {
+	keys, err := readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{Key: []string{"#2"}}, "[1, \"a\"]\n[2, \"b\"]\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
+
+	keys, err = readJSONKeys(t, ReadKeysFromJSONArrayIntoChannel, Options{Key: []string{"user.tags.#0"}, ZeroBased: true}, `[{"user": {"tags": ["x", "y"]}}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"x"}, keys)
+
+	_, err = readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{Key: []string{"#3"}}, "[1, \"a\"]\n")
+	assert.Error(t, err)
+
+	_, err = readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{Key: []string{"#1"}}, dummyJSONLines)
+	assert.Error(t, err)
+
+	_, err = readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{Key: []string{"user.#1"}}, dummyJSONLines)
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromParquetIntoChannel_ColumnIndex(t *testing.T) {
+	keys, err := readParquetKeys(t, Options{Key: []string{"#1"}}, "testdata/users.parquet")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u0", "u1", "u2", "u0", "u1"}, keys)
+
+	keys, err = readParquetKeys(t, Options{Key: []string{"#2"}, ZeroBased: true}, "testdata/users.parquet")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"20", "21", "22", "23", "24"}, keys)
+
+	keys, err = readParquetKeys(t, Options{Key: []string{"#4.city"}}, "testdata/users.parquet")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"city0", "city1", "city2", "city0", "city1"}, keys)
+
+	for _, key := range []string{"#4", "#6", "address.#1"} {
+		_, err = readParquetKeys(t, Options{Key: []string{key}}, "testdata/users.parquet")
+		assert.Error(t, err, key)
+	}
+}
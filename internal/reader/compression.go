@@ -0,0 +1,180 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+)
+
+// Compression is the compression of an input file
+type Compression string
+
+// supported compressions
+const (
+	// CompressionAuto finds the compression from the magic bytes at the start of the file, then the file extension
+	CompressionAuto  Compression = "auto"
+	CompressionNone  Compression = "none"
+	CompressionGzip  Compression = "gzip"
+	CompressionZstd  Compression = "zstd"
+	CompressionBzip2 Compression = "bzip2"
+	CompressionXz    Compression = "xz"
+)
+
+// magic bytes at the start of compressed files
+var compressionMagic = []struct {
+	compression Compression
+	magic       []byte
+}{
+	{CompressionGzip, []byte{0x1f, 0x8b}},
+	{CompressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{CompressionXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
+
+// the longest of the magic bytes
+const compressionMagicLen = 6
+
+// ParseCompression parses the name of a compression
+func ParseCompression(name string) (Compression, error) {
+	switch compression := Compression(strings.ToLower(name)); compression {
+	case CompressionAuto, CompressionNone, CompressionGzip, CompressionZstd, CompressionBzip2, CompressionXz:
+		return compression, nil
+	case "gz":
+		return CompressionGzip, nil
+	case "zst":
+		return CompressionZstd, nil
+	case "bz2":
+		return CompressionBzip2, nil
+	case "":
+		return CompressionAuto, nil
+	}
+
+	return "", errors.Errorf("unknown compression: %s", name)
+}
+
+// CompressionFromPath finds the compression from the file extension
+func CompressionFromPath(path string) Compression {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".gzip":
+		return CompressionGzip
+	case ".zst", ".zstd":
+		return CompressionZstd
+	case ".bz2":
+		return CompressionBzip2
+	case ".xz":
+		return CompressionXz
+	default:
+		return CompressionNone
+	}
+}
+
+// trimCompressionExt removes the compression extension from the path, eg. users.csv.gz is users.csv
+func trimCompressionExt(path string) string {
+	if CompressionFromPath(path) == CompressionNone {
+		return path
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// Decompress returns a reader of the decompressed content of r along with a func to release the decompressor once done.
+// For CompressionAuto the compression is found from the magic bytes at the start of r, then the extension of the path.
+// r is returned as is when it is not compressed, so that readers needing a file (eg. parquet) still get the file
+func Decompress(compression Compression, path string, r io.Reader) (io.Reader, func(), error) {
+	release := func() {}
+	if r == nil {
+		return nil, release, errors.New("source to decompress is nil")
+	}
+
+	if compression == CompressionAuto || compression == "" {
+		var err error
+		compression, r, err = detectCompression(r)
+		if err != nil {
+			return nil, release, err
+		}
+
+		if compression == CompressionNone {
+			compression = CompressionFromPath(path)
+		}
+	}
+
+	switch compression {
+	case CompressionNone:
+		return r, release, nil
+	case CompressionGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, release, errors.Wrap(err, "unable to read gzip header")
+		}
+		return gz, func() { _ = gz.Close() }, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, release, errors.Wrap(err, "unable to read zstd stream")
+		}
+		return zr, zr.Close, nil
+	case CompressionBzip2:
+		return bzip2.NewReader(r), release, nil
+	case CompressionXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, release, errors.Wrap(err, "unable to read xz header")
+		}
+		return xr, release, nil
+	}
+
+	return nil, release, errors.Errorf("unknown compression: %s", compression)
+}
+
+// detectCompression finds the compression from the magic bytes at the start of r.
+// The bytes are read and r seeked back when it can be, otherwise r is buffered and the returned reader has to be used instead
+func detectCompression(r io.Reader) (Compression, io.Reader, error) {
+	var header []byte
+
+	if seeker, ok := r.(io.ReadSeeker); ok {
+		header = make([]byte, compressionMagicLen)
+		n, err := io.ReadFull(seeker, header)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return "", nil, errors.Wrap(err, "unable to read start of file")
+		}
+		header = header[:n]
+
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return "", nil, errors.Wrap(err, "unable to seek to start of file")
+		}
+	} else {
+		buffered := bufio.NewReader(r)
+		var err error
+		header, err = buffered.Peek(compressionMagicLen)
+		if err != nil && err != io.EOF {
+			return "", nil, errors.Wrap(err, "unable to read start of file")
+		}
+		r = buffered
+	}
+
+	for _, m := range compressionMagic {
+		if bytes.HasPrefix(header, m.magic) {
+			return m.compression, r, nil
+		}
+	}
+
+	if isBzip2Header(header) {
+		return CompressionBzip2, r, nil
+	}
+
+	return CompressionNone, r, nil
+}
+
+// isBzip2Header checks for BZh followed by the block size and the magic of the first block or of the end of stream,
+// as BZh alone could well be the start of a text file
+func isBzip2Header(header []byte) bool {
+	return len(header) >= 5 && bytes.HasPrefix(header, []byte("BZh")) &&
+		header[3] >= '1' && header[3] <= '9' &&
+		(header[4] == 0x31 || header[4] == 0x17)
+}
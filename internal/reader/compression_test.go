@@ -0,0 +1,166 @@
+package reader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
+)
+
+const dummyCompressedCsv = "id,name\n1,a\n2,b\n3,c\n"
+
+func compress(t *testing.T, compression Compression, content string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+
+	switch compression {
+	case CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case CompressionZstd:
+		w, err = zstd.NewWriter(&buf)
+	case CompressionXz:
+		w, err = xz.NewWriter(&buf)
+	default:
+		t.Fatalf("no writer for compression: %s", compression)
+	}
+	assert.NoError(t, err)
+
+	_, err = io.WriteString(w, content)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func decompress(t *testing.T, compression Compression, path string, r io.Reader) (string, error) {
+	t.Helper()
+
+	input, release, err := Decompress(compression, path, r)
+	defer release()
+	if err != nil {
+		return "", err
+	}
+
+	content, err := ioutil.ReadAll(input)
+	return string(content), err
+}
+
+func Test_Decompress_MagicBytes(t *testing.T) {
+	for _, compression := range []Compression{CompressionGzip, CompressionZstd, CompressionXz} {
+		compressed := compress(t, compression, dummyCompressedCsv)
+
+		// the extension does not matter when the magic bytes are found
+		content, err := decompress(t, CompressionAuto, "keys.csv", bytes.NewReader(compressed))
+		assert.NoError(t, err, compression)
+		assert.Equal(t, dummyCompressedCsv, content, compression)
+
+		// readers that cannot seek are buffered
+		content, err = decompress(t, CompressionAuto, "keys.csv", io.MultiReader(bytes.NewReader(compressed)))
+		assert.NoError(t, err, compression)
+		assert.Equal(t, dummyCompressedCsv, content, compression)
+	}
+}
+
+func Test_Decompress_Bzip2(t *testing.T) {
+	file, err := os.Open("testdata/keys.csv.bz2")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	content, err := decompress(t, CompressionAuto, file.Name(), file)
+	assert.NoError(t, err)
+	assert.Equal(t, dummyCompressedCsv, content)
+}
+
+func Test_Decompress_Override(t *testing.T) {
+	compressed := compress(t, CompressionGzip, dummyCompressedCsv)
+	content, err := decompress(t, CompressionGzip, "keys.csv", io.MultiReader(bytes.NewReader(compressed)))
+	assert.NoError(t, err)
+	assert.Equal(t, dummyCompressedCsv, content)
+
+	// a gzip file read as is
+	content, err = decompress(t, CompressionNone, "keys.csv.gz", bytes.NewReader(compressed))
+	assert.NoError(t, err)
+	assert.Equal(t, string(compressed), content)
+
+	_, err = decompress(t, CompressionZstd, "keys.csv", bytes.NewReader(compressed))
+	assert.Error(t, err)
+
+	_, err = decompress(t, Compression("lz4"), "keys.csv", bytes.NewReader(compressed))
+	assert.Error(t, err)
+}
+
+func Test_Decompress_NotCompressed(t *testing.T) {
+	file, err := os.Open("testdata/users.parquet")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	// the file itself is returned, after seeking back to the start
+	input, release, err := Decompress(CompressionAuto, file.Name(), file)
+	defer release()
+	assert.NoError(t, err)
+	assert.Equal(t, file, input)
+
+	offset, err := file.Seek(0, io.SeekCurrent)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), offset)
+
+	for _, content := range []string{"", "B", "BZh", "BZhello\n", dummyCompressedCsv} {
+		decompressed, err := decompress(t, CompressionAuto, "keys.csv", io.MultiReader(bytes.NewBufferString(content)))
+		assert.NoError(t, err, content)
+		assert.Equal(t, content, decompressed, content)
+	}
+}
+
+func Test_Decompress_Extension(t *testing.T) {
+	// without magic bytes the extension is used, so a plain text file named .gz is an error
+	_, err := decompress(t, CompressionAuto, "keys.csv.gz", bytes.NewBufferString(dummyCompressedCsv))
+	assert.Error(t, err)
+}
+
+func Test_Decompress_Nil(t *testing.T) {
+	_, err := decompress(t, CompressionAuto, "keys.csv", nil)
+	assert.Error(t, err)
+}
+
+func Test_ParseCompression(t *testing.T) {
+	for name, expected := range map[string]Compression{
+		"":      CompressionAuto,
+		"auto":  CompressionAuto,
+		"none":  CompressionNone,
+		"GZIP":  CompressionGzip,
+		"gz":    CompressionGzip,
+		"zst":   CompressionZstd,
+		"bz2":   CompressionBzip2,
+		"bzip2": CompressionBzip2,
+		"xz":    CompressionXz,
+	} {
+		compression, err := ParseCompression(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, compression, name)
+	}
+
+	_, err := ParseCompression("lz4")
+	assert.Error(t, err)
+}
+
+func Test_CompressionFromPath(t *testing.T) {
+	for path, expected := range map[string]Compression{
+		"a.csv":      CompressionNone,
+		"a.csv.gz":   CompressionGzip,
+		"a.GZ":       CompressionGzip,
+		"a.csv.zst":  CompressionZstd,
+		"a.json.bz2": CompressionBzip2,
+		"a.xz":       CompressionXz,
+		"a.gz/b":     CompressionNone,
+	} {
+		assert.Equal(t, expected, CompressionFromPath(path), path)
+	}
+}
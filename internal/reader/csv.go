@@ -1,52 +1,236 @@
 package reader
 
 import (
+	"context"
 	"encoding/csv"
 	"io"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
 // ReadKeysFromCsvIntoChannel reads csv content to find key for each row and push into the passed in channel
-// returns when end of file is reached or when error
-func ReadKeysFromCsvIntoChannel(key string, reader io.Reader, keysOuput chan<- string) error {
+// returns when end of file is reached or when error.
+// When the key is made up of more than one column, the values are normalized and then joined using CompositeKey
+func ReadKeysFromCsvIntoChannel(ctx context.Context, opts Options, reader io.Reader, keysOuput chan<- string) error {
+	return Unbatched(ReadKeyBatchesFromCsvIntoChannel)(ctx, opts, reader, keysOuput)
+}
+
+// ReadKeyBatchesFromCsvIntoChannel is ReadKeysFromCsvIntoChannel sending batches of keys
+func ReadKeyBatchesFromCsvIntoChannel(ctx context.Context, opts Options, reader io.Reader, batchesOutput chan<- []string) error {
+	return readBatches(ctx, opts, batchesOutput, func(emit func(key string) error) error {
+		return readCsv(ctx, opts, reader, emit)
+	})
+}
+
+// readCsv calls emit with the key of each row that matches the filter. Malformed rows, that cannot be parsed or do not have the key,
+// are skipped as set by Options.Malformed
+func readCsv(ctx context.Context, opts Options, reader io.Reader, emit func(key string) error) error {
 	if reader == nil {
 		return errors.New("csv source is nil")
 	}
 
-	csvReader := csv.NewReader(reader)
+	columns, err := parseColumns(opts, opts.NoHeader)
+	if err != nil {
+		return err
+	}
+	filterColumns, err := parseFilterColumns(opts, opts.NoHeader)
+	if err != nil {
+		return err
+	}
+
+	dialect, reader, err := opts.Csv.sniffFrom(reader)
+	if err != nil {
+		return err
+	}
+
+	// the lines of each row are only kept when malformed rows are skipped, so that they can be rejected as they are
+	var lines *rawLines
+	if opts.Malformed.Skip {
+		lines = newRawLines(reader, dialect)
+		reader = lines
+	}
+
+	csvReader, err := newCsvReader(dialect, reader)
+	if err != nil {
+		return err
+	}
+
+	var keyIndices, filterIndices []int
+	if opts.NoHeader {
+		if keyIndices, err = getIndices(nil, columns, "key"); err != nil {
+			return err
+		}
+		if filterIndices, err = getIndices(nil, filterColumns, "filter field"); err != nil {
+			return err
+		}
+	}
 
-	headerKeyIndex := -1
+	skipper := newRowSkipper(opts)
+	rows := newRowFilter(opts)
+	keys := newKeyWriter(opts, emit)
+	values := make([]string, len(columns))
+	rowNumber := 0
 
 	for {
+		if lines != nil {
+			lines.next()
+		}
+
 		row, err := csvReader.Read()
 		if err == io.EOF {
 			break
 		}
 
-		if err != nil {
+		// only a row that cannot be parsed is malformed, the header and any other error always fail
+		var parseErr *csv.ParseError
+		if err != nil && (keyIndices == nil || !errors.As(err, &parseErr)) {
 			return errors.Wrap(err, "while reading from reader")
 		}
+		rowNumber++
+		if err := checkContext(ctx, rowNumber); err != nil {
+			return err
+		}
+
+		if keyIndices == nil {
+			if keyIndices, err = getIndices(row, columns, "key"); err != nil {
+				return err
+			}
+			if filterIndices, err = getIndices(row, filterColumns, "filter field"); err != nil {
+				return err
+			}
+			continue
+		}
 
-		switch headerKeyIndex {
-		case -1:
-			headerKeyIndex, err = getIndex(row, key)
-			if err != nil {
-				return errors.Errorf("header: %s does not exist", key)
+		if err == nil {
+			err = rows.csvValues(row, rowNumber, filterColumns, filterIndices)
+		}
+		if err == nil && !rows.match() {
+			continue
+		}
+		skipper.rows++
+		if err == nil {
+			err = keyValues(row, rowNumber, columns, keyIndices, opts.Normalizers, values)
+		}
+		if err != nil {
+			line, raw := rowNumber, []byte(nil)
+			if lines != nil {
+				line, raw = lines.record()
 			}
-		default:
-			keysOuput <- row[headerKeyIndex]
+			if err := skipper.skip(line, raw, err); err != nil {
+				return errors.Wrap(err, "malformed row")
+			}
+			continue
+		}
+
+		if err := keys.write(values); err != nil {
+			return err
+		}
+	}
+
+	return skipper.done()
+}
+
+// keyValues writes the normalized value of each column of the key in the row into values
+func keyValues(row []string, rowNumber int, columns []column, keyIndices []int, normalizers []Normalizer, values []string) error {
+	for i, idx := range keyIndices {
+		if idx >= len(row) {
+			return errors.Errorf("key (%s) is not in row %v, it only has %v columns", columns[i], rowNumber, len(row))
 		}
+		values[i] = normalize(row[idx], normalizers)
 	}
+	return nil
+}
 
+// csvValues writes the value of each field of the filter in the row into the values of the filter
+func (f *rowFilter) csvValues(row []string, rowNumber int, columns []column, indices []int) error {
+	for i, idx := range indices {
+		if idx >= len(row) {
+			return errors.Errorf("filter field (%s) is not in row %v, it only has %v columns", columns[i], rowNumber, len(row))
+		}
+		f.values[i] = row[idx]
+	}
 	return nil
 }
 
-func getIndex(headers []string, key string) (int, error) {
+// CompositeKey joins the values of a key made up of more than one column.
+// Each value is prefixed with its length so that values containing any separator cannot collide,
+// eg. ("a:b", "c") and ("a", "b:c") become "3:a:b1:c" and "1:a3:b:c".
+// A single value is returned as is
+func CompositeKey(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+
+	var sb strings.Builder
+	for _, v := range values {
+		sb.WriteString(strconv.Itoa(len(v)))
+		sb.WriteByte(':')
+		sb.WriteString(v)
+	}
+	return sb.String()
+}
+
+// SplitCompositeKey splits a key made by CompositeKey back into the values of its columns.
+// A key of a single column is returned as is
+func SplitCompositeKey(key string, columns int) ([]string, error) {
+	if columns == 1 {
+		return []string{key}, nil
+	}
+
+	values := make([]string, 0, columns)
+	rest := key
+	for rest != "" {
+		sep := strings.IndexByte(rest, ':')
+		if sep < 0 {
+			return nil, errors.Errorf("invalid composite key, no length before: %s", rest)
+		}
+		length, err := strconv.Atoi(rest[:sep])
+		if err != nil || length < 0 || length > len(rest)-sep-1 {
+			return nil, errors.Errorf("invalid composite key, bad length: %s", rest[:sep])
+		}
+		values = append(values, rest[sep+1:sep+1+length])
+		rest = rest[sep+1+length:]
+	}
+
+	if len(values) != columns {
+		return nil, errors.Errorf("invalid composite key, expected %v columns but found %v", columns, len(values))
+	}
+	return values, nil
+}
+
+// getIndices finds the index of each column in the header, headers is nil when there is no header.
+// kind is what the columns are for errors, eg. key
+func getIndices(headers []string, columns []column, kind string) ([]int, error) {
+	indices := make([]int, 0, len(columns))
+	for _, c := range columns {
+		if c.byIndex() {
+			if headers != nil && c.index >= len(headers) {
+				return nil, errors.Errorf("%s (%s) does not exist, the header only has %v columns", kind, c, len(headers))
+			}
+			indices = append(indices, c.index)
+			continue
+		}
+
+		if headers == nil {
+			return nil, errors.Errorf("%s (%s) must be a column index when there is no header", kind, c)
+		}
+
+		idx, err := getIndex(headers, c.name, kind)
+		if err != nil {
+			return nil, err
+		}
+		indices = append(indices, idx)
+	}
+	return indices, nil
+}
+
+func getIndex(headers []string, name string, kind string) (int, error) {
 	for idx, header := range headers {
-		if header == key {
+		if header == name {
 			return idx, nil
 		}
 	}
-	return 0, errors.Errorf("key (%s) does not exist in header", key)
+	return 0, errors.Errorf("%s (%s) does not exist in header", kind, name)
 }
@@ -1,6 +1,7 @@
 package reader
 
 import (
+	"context"
 	"strings"
 	"testing"
 	"time"
@@ -19,7 +20,7 @@ func Test_ReadKeysFromCsvIntoChannel(t *testing.T) {
 
 	go func() {
 		defer close(outputChan)
-		err := ReadKeysFromCsvIntoChannel("key", strings.NewReader(dummyFile), outputChan)
+		err := ReadKeysFromCsvIntoChannel(context.Background(), Options{Key: []string{"key"}}, strings.NewReader(dummyFile), outputChan)
 		assert.NoError(t, err)
 	}()
 
@@ -40,29 +41,107 @@ func Test_ReadKeysFromCsvIntoChannel_Empty(t *testing.T) {
 
 	go func() {
 		defer close(outputChan)
-		err := ReadKeysFromCsvIntoChannel("key", strings.NewReader(""), outputChan)
+		err := ReadKeysFromCsvIntoChannel(context.Background(), Options{Key: []string{"key"}}, strings.NewReader(""), outputChan)
 		assert.NoError(t, err)
 	}()
 	_, more := <-outputChan
 	assert.False(t, more)
 }
 
+func Test_ReadKeysFromCsvIntoChannel_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// nobody reads the channel, so the reader would block forever if it did not stop on the context
+	err := ReadKeysFromCsvIntoChannel(ctx, Options{Key: []string{"key"}}, strings.NewReader(dummyFile), make(chan string))
+	assert.Equal(t, context.Canceled, err)
+}
+
 func Test_ReadKeysFromCsvIntoChannel_Nil(t *testing.T) {
 	outputChan := make(chan string)
-	err := ReadKeysFromCsvIntoChannel("key", nil, outputChan)
+	err := ReadKeysFromCsvIntoChannel(context.Background(), Options{Key: []string{"key"}}, nil, outputChan)
 	assert.Error(t, err)
 }
 
 func Test_ReadKeysFromCsvIntoChannel_NonExistentKey(t *testing.T) {
-	err := ReadKeysFromCsvIntoChannel("non-existent", strings.NewReader(dummyFile), make(chan string))
+	err := ReadKeysFromCsvIntoChannel(context.Background(), Options{Key: []string{"non-existent"}}, strings.NewReader(dummyFile), make(chan string))
 	assert.Error(t, err)
 }
 
 func Test_ReadKeysFromCsvIntoChannel_EmptyKey(t *testing.T) {
-	err := ReadKeysFromCsvIntoChannel("", strings.NewReader(dummyFile), make(chan string))
+	err := ReadKeysFromCsvIntoChannel(context.Background(), Options{Key: []string{""}}, strings.NewReader(dummyFile), make(chan string))
 	assert.Error(t, err)
 }
 
+func Test_ReadKeysFromCsvIntoChannel_NoKey(t *testing.T) {
+	err := ReadKeysFromCsvIntoChannel(context.Background(), Options{}, strings.NewReader(dummyFile), make(chan string))
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromCsvIntoChannel_CompositeKey(t *testing.T) {
+	outputChan := make(chan string, 8)
+
+	err := ReadKeysFromCsvIntoChannel(context.Background(), Options{Key: []string{"a", "c"}}, strings.NewReader(`a,b,c
+x,1,y
+"x:1",2,y
+x,3,"1:y"
+`), outputChan)
+	assert.NoError(t, err)
+	close(outputChan)
+
+	var keys []string
+	for k := range outputChan {
+		keys = append(keys, k)
+	}
+	assert.Equal(t, []string{"1:x1:y", "3:x:11:y", "1:x3:1:y"}, keys)
+}
+
+func Test_ReadKeysFromCsvIntoChannel_MissingCompositeColumn(t *testing.T) {
+	err := ReadKeysFromCsvIntoChannel(context.Background(), Options{Key: []string{"key", "missing"}}, strings.NewReader(dummyFile), make(chan string))
+	assert.EqualError(t, err, "key (missing) does not exist in header")
+}
+
+func Test_ReadKeysFromCsvIntoChannel_Normalizers(t *testing.T) {
+	outputChan := make(chan string, 8)
+
+	err := ReadKeysFromCsvIntoChannel(context.Background(), Options{
+		Key:         []string{"key"},
+		Normalizers: []Normalizer{strings.TrimSpace, strings.ToLower},
+	}, strings.NewReader(`key,col1
+ abc,1
+ABC,2
+abc ,3
+`), outputChan)
+	assert.NoError(t, err)
+	close(outputChan)
+
+	var keys []string
+	for k := range outputChan {
+		keys = append(keys, k)
+	}
+	assert.Equal(t, []string{"abc", "abc", "abc"}, keys)
+}
+
+func Test_CompositeKey(t *testing.T) {
+	assert.Equal(t, "a", CompositeKey([]string{"a"}))
+	assert.Equal(t, "0:0:", CompositeKey([]string{"", ""}))
+	assert.NotEqual(t, CompositeKey([]string{"a:b", "c"}), CompositeKey([]string{"a", "b:c"}))
+	assert.NotEqual(t, CompositeKey([]string{"1:a", ""}), CompositeKey([]string{"", "1:a"}))
+}
+
+func Test_SplitCompositeKey(t *testing.T) {
+	for _, values := range [][]string{{"a"}, {"a:b"}, {"", ""}, {"a:b", "c"}, {"1:a", "", "x,y"}} {
+		split, err := SplitCompositeKey(CompositeKey(values), len(values))
+		assert.NoError(t, err, values)
+		assert.Equal(t, values, split)
+	}
+
+	for _, key := range []string{"a", "1:ab", "x:a1:b", "3:ab", "1:a"} {
+		_, err := SplitCompositeKey(key, 2)
+		assert.Error(t, err, key)
+	}
+}
+
 func Benchmark_ReadKeysFromCsvIntoChannel_1(b *testing.B) {
 	benchmarkReadKeysFromCsvIntoChannel(1, b)
 }
@@ -119,7 +198,7 @@ func benchmarkReadKeysFromCsvIntoChannel(buf int, b *testing.B) {
 			}
 		}()
 
-		_ = ReadKeysFromCsvIntoChannel("key", strings.NewReader(getinputFile1000()), outputChan)
+		_ = ReadKeysFromCsvIntoChannel(context.Background(), Options{Key: []string{"key"}}, strings.NewReader(getinputFile1000()), outputChan)
 		close(outputChan)
 	}
 }
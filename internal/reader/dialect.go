@@ -0,0 +1,221 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// sniffSize is the no. of bytes at the start of a file the dialect is sniffed from
+const sniffSize = 4 * 1024
+
+// sniffDelimiters are the delimiters a sniff picks from, the first of them when none fits better
+var sniffDelimiters = []rune{',', ';', '\t', '|'}
+
+// CsvDialect is how the fields of a csv file are written, the zero value is RFC 4180 csv
+type CsvDialect struct {
+	// Delimiter separates the fields, ',' when 0
+	Delimiter rune
+	// Comment starts a line that is skipped, none when 0
+	Comment rune
+	// LazyQuotes allows quotes in unquoted fields and unescaped quotes in quoted fields
+	LazyQuotes bool
+	// TrimLeadingSpace skips the spaces at the start of each field
+	TrimLeadingSpace bool
+	// FieldsPerRecord is the no. of fields each row must have, that of the header when 0 and any when negative
+	FieldsPerRecord int
+	// Sniff finds the delimiter, and whether the fields start with a space, from the start of the file.
+	// Delimiter is then ignored
+	Sniff bool
+}
+
+// ParseCsvDelimiter parses a delimiter given as the character itself, as tab or \t, or as auto for it to be sniffed
+func ParseCsvDelimiter(value string) (delimiter rune, sniff bool, err error) {
+	switch strings.ToLower(value) {
+	case "auto":
+		return 0, true, nil
+	case "tab", `\t`:
+		return '\t', false, nil
+	case "":
+		return 0, false, nil
+	}
+
+	delimiter, err = parseCsvRune(value)
+	if err != nil {
+		return 0, false, err
+	}
+	return delimiter, false, nil
+}
+
+// ParseCsvComment parses a comment character, none when empty
+func ParseCsvComment(value string) (rune, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return parseCsvRune(value)
+}
+
+func parseCsvRune(value string) (rune, error) {
+	r, size := utf8.DecodeRuneInString(value)
+	if size != len(value) {
+		return 0, errors.Errorf("expected a single character, got: %s", value)
+	}
+	if !validCsvRune(r) {
+		return 0, errors.Errorf("invalid character: %q", r)
+	}
+	return r, nil
+}
+
+// validCsvRune is whether the rune can be used as a delimiter or comment, as checked by encoding/csv
+func validCsvRune(r rune) bool {
+	return r != 0 && r != '"' && r != '\r' && r != '\n' && utf8.ValidRune(r) && r != utf8.RuneError
+}
+
+// validate checks that the delimiter and comment can be used, and used together
+func (d CsvDialect) validate() error {
+	if d.Delimiter != 0 && !validCsvRune(d.Delimiter) {
+		return errors.Errorf("invalid csv delimiter: %q", d.Delimiter)
+	}
+	if d.Comment != 0 && !validCsvRune(d.Comment) {
+		return errors.Errorf("invalid csv comment: %q", d.Comment)
+	}
+	if d.Comment != 0 && d.Comment == d.delimiter() {
+		return errors.Errorf("csv comment cannot be the delimiter: %q", d.Comment)
+	}
+	return nil
+}
+
+func (d CsvDialect) delimiter() rune {
+	if d.Delimiter == 0 {
+		return ','
+	}
+	return d.Delimiter
+}
+
+// sniffFrom sniffs the dialect from the start of the reader when Sniff is set.
+// The csv is then read from the reader returned, which still has the start of it
+func (d CsvDialect) sniffFrom(reader io.Reader) (CsvDialect, io.Reader, error) {
+	if !d.Sniff {
+		return d, reader, nil
+	}
+
+	buffered := bufio.NewReaderSize(reader, sniffSize)
+	sample, err := buffered.Peek(sniffSize)
+	if err != nil && err != io.EOF {
+		return d, nil, errors.Wrap(err, "while sniffing csv dialect")
+	}
+
+	return d.sniff(sample, len(sample) == sniffSize), buffered, nil
+}
+
+// newCsvReader creates a reader of the csv in the dialect, which is sniffed already if needed
+func newCsvReader(dialect CsvDialect, reader io.Reader) (*csv.Reader, error) {
+	if err := dialect.validate(); err != nil {
+		return nil, err
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma = dialect.delimiter()
+	csvReader.Comment = dialect.Comment
+	csvReader.LazyQuotes = dialect.LazyQuotes
+	csvReader.TrimLeadingSpace = dialect.TrimLeadingSpace
+	csvReader.FieldsPerRecord = dialect.FieldsPerRecord
+
+	return csvReader, nil
+}
+
+// SniffCsvDialect finds the dialect of the csv from a sample of its start, see CsvDialect.Sniff
+func SniffCsvDialect(sample []byte) CsvDialect {
+	return CsvDialect{Sniff: true}.sniff(sample, false)
+}
+
+// sniff sets the delimiter that is found the same no. of times on the most lines of the sample, and whether
+// every delimiter is followed by a space. A truncated sample has its last line, which may be cut short, left out
+func (d CsvDialect) sniff(sample []byte, truncated bool) CsvDialect {
+	lines := bytes.Split(sample, []byte("\n"))
+	if truncated && len(lines) > 1 {
+		lines = lines[:len(lines)-1]
+	}
+
+	best, bestLines, bestCount := sniffDelimiters[0], 0, 0
+	for _, delimiter := range sniffDelimiters {
+		// the no. of lines with each no. of delimiters
+		linesByCount := make(map[int]int)
+		for _, line := range lines {
+			if d.skipped(line) {
+				continue
+			}
+			if count := countDelimiters(line, delimiter); count > 0 {
+				linesByCount[count]++
+			}
+		}
+
+		for count, n := range linesByCount {
+			if n > bestLines || (n == bestLines && count > bestCount) {
+				best, bestLines, bestCount = delimiter, n, count
+			}
+		}
+	}
+
+	d.Delimiter = best
+	d.TrimLeadingSpace = d.TrimLeadingSpace || (bestLines > 0 && spacedDelimiters(lines, best, d))
+	return d
+}
+
+// skipped is whether the line is blank or a comment
+func (d CsvDialect) skipped(line []byte) bool {
+	line = bytes.TrimRightFunc(line, unicode.IsSpace)
+	if len(line) == 0 {
+		return true
+	}
+
+	r, _ := utf8.DecodeRune(line)
+	return d.Comment != 0 && r == d.Comment
+}
+
+// countDelimiters counts the delimiters in the line that are not quoted
+func countDelimiters(line []byte, delimiter rune) int {
+	count := 0
+	quoted := false
+	for _, r := range string(line) {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == delimiter && !quoted:
+			count++
+		}
+	}
+	return count
+}
+
+// spacedDelimiters is whether every delimiter that is not quoted is followed by a space
+func spacedDelimiters(lines [][]byte, delimiter rune, d CsvDialect) bool {
+	for _, line := range lines {
+		if d.skipped(line) {
+			continue
+		}
+
+		quoted := false
+		afterDelimiter := false
+		for _, r := range string(line) {
+			if afterDelimiter && r != ' ' {
+				return false
+			}
+			afterDelimiter = false
+
+			switch {
+			case r == '"':
+				quoted = !quoted
+			case r == delimiter && !quoted:
+				afterDelimiter = true
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package reader
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readCsvKeys(t *testing.T, dialect CsvDialect, content string) ([]string, error) {
+	t.Helper()
+
+	outputChan := make(chan string, 16)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(outputChan)
+		errs <- ReadKeysFromCsvIntoChannel(context.Background(), Options{Key: []string{"key"}, Csv: dialect}, strings.NewReader(content), outputChan)
+	}()
+
+	var keys []string
+	for k := range outputChan {
+		keys = append(keys, k)
+	}
+	return keys, <-errs
+}
+
+func Test_ReadKeysFromCsvIntoChannel_Dialect(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		dialect  CsvDialect
+		content  string
+		expected []string
+	}{
+		{"pipe", CsvDialect{Delimiter: '|'}, "id|key\n1|a\n2|b,c\n", []string{"a", "b,c"}},
+		{"semicolon", CsvDialect{Delimiter: ';'}, "id;key\n1;1,5\n2;2,5\n", []string{"1,5", "2,5"}},
+		{"tab", CsvDialect{Delimiter: '\t'}, "id\tkey\n1\ta b\n", []string{"a b"}},
+		{"comment", CsvDialect{Comment: '#'}, "# exported\nid,key\n1,a\n#2,b\n3,c\n", []string{"a", "c"}},
+		{"lazy quotes", CsvDialect{LazyQuotes: true}, "id,key\n1,a \"quoted\" word\n", []string{`a "quoted" word`}},
+		{"trim leading space", CsvDialect{TrimLeadingSpace: true}, "id, key\n1,  a\n", []string{"a"}},
+		{"any no. of fields", CsvDialect{FieldsPerRecord: -1}, "id,key\n1,a,extra\n2,b\n", []string{"a", "b"}},
+		{"sniffed", CsvDialect{Sniff: true, Delimiter: ','}, "id;key\n1;a\n2;b\n", []string{"a", "b"}},
+	} {
+		keys, err := readCsvKeys(t, tc.dialect, tc.content)
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.expected, keys, tc.name)
+	}
+}
+
+func Test_ReadKeysFromCsvIntoChannel_DialectErrors(t *testing.T) {
+	// the whole line is one column without the delimiter
+	_, err := readCsvKeys(t, CsvDialect{}, "id;key\n1;a\n")
+	assert.Error(t, err)
+
+	_, err = readCsvKeys(t, CsvDialect{}, "id,key\n1,a \"quoted\" word\n")
+	assert.Error(t, err)
+
+	_, err = readCsvKeys(t, CsvDialect{}, "id,key\n1,a,extra\n")
+	assert.Error(t, err)
+
+	_, err = readCsvKeys(t, CsvDialect{FieldsPerRecord: 3}, "id,key\n1,a\n")
+	assert.Error(t, err)
+
+	_, err = readCsvKeys(t, CsvDialect{Delimiter: '"'}, "id,key\n1,a\n")
+	assert.Error(t, err)
+
+	_, err = readCsvKeys(t, CsvDialect{Delimiter: ';', Comment: ';'}, "id,key\n1,a\n")
+	assert.Error(t, err)
+}
+
+func Test_SniffCsvDialect(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		sample   string
+		expected CsvDialect
+	}{
+		{"comma", "id,key,name\n1,a,b\n2,c,d\n", CsvDialect{Delimiter: ',', Sniff: true}},
+		{"semicolon with decimal commas", "id;amount\n1;1,5\n2;2,25\n3;3\n", CsvDialect{Delimiter: ';', Sniff: true}},
+		{"pipe", "id|key\n1|a\n", CsvDialect{Delimiter: '|', Sniff: true}},
+		{"tab", "id\tkey\n1\ta,b\n", CsvDialect{Delimiter: '\t', Sniff: true}},
+		{"quoted delimiters", "id;key\n1;\"a,b,c\"\n2;\"d,e\"\n", CsvDialect{Delimiter: ';', Sniff: true}},
+		{"spaced", "id; key\n1; a\n", CsvDialect{Delimiter: ';', TrimLeadingSpace: true, Sniff: true}},
+		{"single column", "key\na\nb\n", CsvDialect{Delimiter: ',', Sniff: true}},
+		{"empty", "", CsvDialect{Delimiter: ',', Sniff: true}},
+	} {
+		assert.Equal(t, tc.expected, SniffCsvDialect([]byte(tc.sample)), tc.name)
+	}
+}
+
+func Test_CsvDialect_SniffTruncated(t *testing.T) {
+	// a long file is only sniffed from its start, its last line there may be cut short
+	content := "id|key\n" + strings.Repeat("1|a\n", sniffSize/4) + "2|b\n"
+	keys, err := readCsvKeys(t, CsvDialect{Sniff: true}, content)
+	assert.NoError(t, err)
+	assert.Len(t, keys, sniffSize/4+1)
+
+	assert.Equal(t, '|', CsvDialect{}.sniff([]byte("id|key\n1|a\n2,"), true).Delimiter)
+}
+
+func Test_CsvDialect_SniffComments(t *testing.T) {
+	dialect := CsvDialect{Comment: '#'}.sniff([]byte("# a, b, c, d, e\nid;key\n1;a\n"), false)
+	assert.Equal(t, ';', dialect.Delimiter)
+	assert.False(t, dialect.TrimLeadingSpace)
+}
+
+func Test_ParseCsvDelimiter(t *testing.T) {
+	for value, expected := range map[string]rune{",": ',', ";": ';', "|": '|', "tab": '\t', `\t`: '\t', "\t": '\t', "": 0, "§": '§'} {
+		delimiter, sniff, err := ParseCsvDelimiter(value)
+		assert.NoError(t, err, value)
+		assert.False(t, sniff, value)
+		assert.Equal(t, expected, delimiter, value)
+	}
+
+	_, sniff, err := ParseCsvDelimiter("AUTO")
+	assert.NoError(t, err)
+	assert.True(t, sniff)
+
+	for _, value := range []string{";;", `"`, "\n", "ab"} {
+		_, _, err := ParseCsvDelimiter(value)
+		assert.Error(t, err, value)
+	}
+
+	comment, err := ParseCsvComment("#")
+	assert.NoError(t, err)
+	assert.Equal(t, '#', comment)
+
+	comment, err = ParseCsvComment("")
+	assert.NoError(t, err)
+	assert.Equal(t, rune(0), comment)
+
+	_, err = ParseCsvComment("//")
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package reader
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/rickyshrestha/set-intersection-exercise/internal/filter"
+)
+
+// rowFilter matches the rows of a file against Options.Filter, before their keys are read.
+// Each reader finds the values of the fields of the filter in a row, as they are in the file, and writes them into values
+type rowFilter struct {
+	filter *filter.Filter
+	values []string
+}
+
+func newRowFilter(opts Options) *rowFilter {
+	f := &rowFilter{filter: opts.Filter}
+	if f.filter != nil {
+		f.values = make([]string, len(f.filter.Fields()))
+	}
+	return f
+}
+
+// match is whether the row whose values were written matches the filter, every row matches when there is no filter
+func (f *rowFilter) match() bool {
+	return f.filter == nil || f.filter.Match(f.values)
+}
+
+// filterFields returns the fields of the filter, none when there is no filter
+func filterFields(opts Options) []string {
+	if opts.Filter == nil {
+		return nil
+	}
+	return opts.Filter.Fields()
+}
+
+// parseFilterColumns parses each field of the filter as a column of a csv file, see parseColumn
+func parseFilterColumns(opts Options, bareIndex bool) ([]column, error) {
+	fields := filterFields(opts)
+	columns := make([]column, len(fields))
+	for i, spec := range fields {
+		var err error
+		if columns[i], err = parseColumn(spec, opts, bareIndex); err != nil {
+			return nil, errors.Wrapf(err, "invalid filter field (%s)", spec)
+		}
+	}
+	return columns, nil
+}
+
+// parseFilterPaths splits each field of the filter into the fields along its path, see parseFieldPaths
+func parseFilterPaths(opts Options) ([][]column, error) {
+	return parsePaths(filterFields(opts), "filter field", opts)
+}
@@ -0,0 +1,246 @@
+package reader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickyshrestha/set-intersection-exercise/internal/filter"
+)
+
+const dummyFilterCsv = "id,status,country,age\n1,active,US,30\n2,inactive,US,40\n3,active,CA,17\n4,active,NZ,25\n5,Active,US,50\n"
+
+func parseFilter(t *testing.T, expression string) *filter.Filter {
+	t.Helper()
+
+	f, err := filter.Parse(expression)
+	assert.NoError(t, err)
+	return f
+}
+
+func Test_ReadKeysFromCsvIntoChannel_Filter(t *testing.T) {
+	for expression, expected := range map[string][]string{
+		"status = active":                             {"1", "3", "4"},
+		"status = active and age >= 18":               {"1", "4"},
+		"country in (US, CA) and not status = active": {"2", "5"},
+		"status ~ '(?i)^active' or age > 35":          {"1", "2", "3", "4", "5"},
+		"country not in (US, CA)":                     {"4"},
+		"id > 3":                                      {"4", "5"},
+		"status = unknown":                            nil,
+	} {
+		keys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, Options{Key: []string{"id"}, Filter: parseFilter(t, expression)}, dummyFilterCsv)
+		assert.NoError(t, err, expression)
+		assert.Equal(t, expected, keys, expression)
+	}
+}
+
+func Test_ReadKeysFromCsvIntoChannel_FilterNotANumber(t *testing.T) {
+	// an age that is not a number is neither at least nor under 18
+	content := "id,age\n1,30\n2,abc\n3,\n4,9\n"
+	for expression, expected := range map[string][]string{
+		"age >= 18":     {"1"},
+		"age < 18":      {"4"},
+		"not age >= 18": {"2", "3", "4"},
+	} {
+		keys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, Options{Key: []string{"id"}, Filter: parseFilter(t, expression)}, content)
+		assert.NoError(t, err, expression)
+		assert.Equal(t, expected, keys, expression)
+	}
+}
+
+func Test_ReadKeysFromCsvIntoChannel_FilterBeforeNormalizing(t *testing.T) {
+	// the filter sees the values as they are in the file, the keys are normalized after
+	opts := Options{Key: []string{"status"}, Normalizers: []Normalizer{strings.ToUpper}, Filter: parseFilter(t, "status = Active or id = 2")}
+
+	keys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, dummyFilterCsv)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"INACTIVE", "ACTIVE"}, keys)
+}
+
+func Test_ReadKeysFromCsvIntoChannel_FilterColumnIndex(t *testing.T) {
+	content := "1,active\n2,inactive\n3,active\n"
+
+	keys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, Options{Key: []string{"1"}, NoHeader: true, Filter: parseFilter(t, "#2 = active")}, content)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "3"}, keys)
+
+	keys, err = readJSONKeys(t, ReadKeysFromCsvIntoChannel, Options{Key: []string{"#0"}, NoHeader: true, ZeroBased: true, Filter: parseFilter(t, "1 != active")}, content)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, keys)
+
+	_, err = readJSONKeys(t, ReadKeysFromCsvIntoChannel, Options{Key: []string{"1"}, NoHeader: true, Filter: parseFilter(t, "status = active")}, content)
+	assert.EqualError(t, err, "filter field (status) must be a column index when there is no header")
+}
+
+func Test_ReadKeysFromCsvIntoChannel_FilterMissingColumn(t *testing.T) {
+	_, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, Options{Key: []string{"id"}, Filter: parseFilter(t, "region = eu")}, dummyFilterCsv)
+	assert.EqualError(t, err, "filter field (region) does not exist in header")
+
+	_, err = readJSONKeys(t, ReadKeysFromCsvIntoChannel, Options{Key: []string{"id"}, Filter: parseFilter(t, "#9 = eu")}, dummyFilterCsv)
+	assert.EqualError(t, err, "filter field (#9) does not exist, the header only has 4 columns")
+}
+
+func Test_ReadKeysFromCsvIntoChannel_FilterMalformedRow(t *testing.T) {
+	// a row without a field of the filter is malformed, even when it has the key
+	content := "id,status\n1,active\n2\n3,active\n"
+	opts := Options{Key: []string{"id"}, Csv: CsvDialect{FieldsPerRecord: -1}, Filter: parseFilter(t, "status = active")}
+
+	_, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, content)
+	assert.Error(t, err)
+
+	var rejects []Reject
+	opts.Malformed = MalformedRows{Skip: true}
+	opts.OnReject = func(reject Reject) error {
+		rejects = append(rejects, reject)
+		return nil
+	}
+
+	keys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, content)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "3"}, keys)
+	if assert.Len(t, rejects, 1) {
+		assert.Equal(t, 3, rejects[0].Line)
+		assert.Equal(t, "filter field (status) is not in row 3, it only has 1 columns", rejects[0].Reason)
+	}
+}
+
+func Test_ReadKeysFromCsvIntoChannel_FilterSkipsRowsWithoutKey(t *testing.T) {
+	// rows that do not match are left out before their key is read, so they are not malformed
+	opts := Options{Key: []string{"id"}, Csv: CsvDialect{FieldsPerRecord: -1}, Filter: parseFilter(t, "status = active")}
+
+	keys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, "status,id\nactive,1\ninactive\nactive,3\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "3"}, keys)
+}
+
+func Test_ReadKeysFromCsvIntoChannel_FilterMalformedPercent(t *testing.T) {
+	// the percent of malformed rows is of the rows that match, 1 of 2 here, not 1 of 5
+	content := "status,id\nactive,1\ninactive,2\ninactive,3\ninactive,4\nactive\n"
+	opts := Options{Key: []string{"id"}, Csv: CsvDialect{FieldsPerRecord: -1}, Filter: parseFilter(t, "status = active")}
+
+	opts.Malformed = MalformedRows{Skip: true, MaxPercent: 50}
+	keys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, content)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, keys)
+
+	opts.Malformed = MalformedRows{Skip: true, MaxPercent: 40}
+	_, err = readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, content)
+	assert.EqualError(t, err, "1 of 2 rows are malformed, more than 40%")
+}
+
+func Test_ReadKeysFromJSONLinesIntoChannel_FilterMalformedPercent(t *testing.T) {
+	content := "{\"id\": 1, \"status\": \"active\"}\n{\"id\": 2}\n{\"id\": 3}\n{\"id\": 4}\n{\"status\": \"active\"}\n"
+	opts := Options{Key: []string{"id"}, Filter: parseFilter(t, "status = active"), Malformed: MalformedRows{Skip: true, MaxPercent: 40}}
+
+	_, err := readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, opts, content)
+	assert.EqualError(t, err, "1 of 2 rows are malformed, more than 40%")
+}
+
+func Test_ReadKeysFromJSONLinesIntoChannel_Filter(t *testing.T) {
+	for expression, expected := range map[string][]string{
+		"user.region = eu":         {"a"},
+		"amount >= 2":              {"b", "3"},
+		"user.region = ''":         {"3"},
+		"missing = ''":             {"a", "b", "3"},
+		"user.region in (eu, us)":  {"a", "b"},
+		"not user.id ~ '^[a-z]+$'": {"3"},
+	} {
+		keys, err := readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{Key: []string{"user.id"}, Filter: parseFilter(t, expression)}, dummyJSONLines)
+		assert.NoError(t, err, expression)
+		assert.Equal(t, expected, keys, expression)
+	}
+}
+
+func Test_ReadKeysFromJSONLinesIntoChannel_FilterSkipsLinesWithoutKey(t *testing.T) {
+	content := "{\"id\": 1, \"status\": \"active\"}\n{\"status\": \"inactive\"}\n{\"id\": 3, \"status\": \"active\"}\n"
+
+	keys, err := readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{Key: []string{"id"}, Filter: parseFilter(t, "status = active")}, content)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "3"}, keys)
+}
+
+func Test_ReadKeysFromJSONArrayIntoChannel_Filter(t *testing.T) {
+	keys, err := readJSONKeys(t, ReadKeysFromJSONArrayIntoChannel, Options{Key: []string{"user.id"}, Filter: parseFilter(t, "user.region != eu and amount < 3")}, dummyJSONArray)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, keys)
+
+	_, err = readJSONKeys(t, ReadKeysFromJSONArrayIntoChannel, Options{Key: []string{"user.id"}, Filter: parseFilter(t, "user..region = eu")}, dummyJSONArray)
+	assert.EqualError(t, err, "invalid filter field (user..region), field names cannot be empty")
+}
+
+func Test_ReadKeysFromParquetIntoChannel_Filter(t *testing.T) {
+	for expression, expected := range map[string][]string{
+		"age >= 22 and region != ''": {"u2", "u1"},
+		"id = u0":                    {"u0", "u0"},
+		"address.city = city1":       {"u1", "u1"},
+		"#2 = ''":                    {"u0"},
+		"region in (eu, ap)":         {"u0", "u2"},
+	} {
+		keys, err := readParquetKeys(t, Options{Key: []string{"id"}, Filter: parseFilter(t, expression)}, "testdata/users.parquet")
+		assert.NoError(t, err, expression)
+		assert.Equal(t, expected, keys, expression)
+	}
+
+	_, err := readParquetKeys(t, Options{Key: []string{"id"}, Filter: parseFilter(t, "status = active")}, "testdata/users.parquet")
+	assert.EqualError(t, err, "filter field (status) does not exist in schema")
+}
+
+func Test_ReadKeysFromParquetIntoChannel_FilterRowGroups(t *testing.T) {
+	keys, err := readParquetKeys(t, Options{Key: []string{"id"}, Filter: parseFilter(t, "age < 25 or age >= 118")}, "testdata/users_row_groups.parquet")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u0", "u1", "u2", "u3", "u4", "u47", "u48"}, keys)
+}
+
+// cancelingReader cancels the context once it is first read from
+type cancelingReader struct {
+	io.Reader
+	cancel context.CancelFunc
+}
+
+func (r cancelingReader) Read(p []byte) (int, error) {
+	r.cancel()
+	return r.Reader.Read(p)
+}
+
+func Test_ReadKeys_FilterDropsEveryRowCanceled(t *testing.T) {
+	var csvContent, jsonLines, jsonArray strings.Builder
+	csvContent.WriteString("id,status\n")
+	jsonArray.WriteString("[")
+	for i := 0; i < 10*contextCheckRows; i++ {
+		fmt.Fprintf(&csvContent, "%v,inactive\n", i)
+		fmt.Fprintf(&jsonLines, "{\"id\": %v, \"status\": \"inactive\"}\n", i)
+		if i > 0 {
+			jsonArray.WriteString(",")
+		}
+		fmt.Fprintf(&jsonArray, "{\"id\": %v, \"status\": \"inactive\"}", i)
+	}
+	jsonArray.WriteString("]")
+
+	// no key is ever sent, the reading still stops once the context is done
+	opts := Options{Key: []string{"id"}, Filter: parseFilter(t, "status = active")}
+	for name, test := range map[string]struct {
+		read    ReadKeysFunc
+		content string
+	}{
+		"csv":   {ReadKeysFromCsvIntoChannel, csvContent.String()},
+		"jsonl": {ReadKeysFromJSONLinesIntoChannel, jsonLines.String()},
+		"json":  {ReadKeysFromJSONArrayIntoChannel, jsonArray.String()},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		err := test.read(ctx, opts, cancelingReader{strings.NewReader(test.content), cancel}, make(chan string))
+		assert.Equal(t, context.Canceled, err, name)
+	}
+
+	file, err := os.Open("testdata/users_row_groups.parquet")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = ReadKeysFromParquetIntoChannel(ctx, Options{Key: []string{"id"}, Filter: parseFilter(t, "id = none")}, cancelingReader{file, cancel}, make(chan string))
+	assert.Equal(t, context.Canceled, err)
+}
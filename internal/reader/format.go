@@ -0,0 +1,88 @@
+package reader
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Format is the format of an input file
+type Format string
+
+// supported formats
+const (
+	// FormatAuto picks the format from the file extension
+	FormatAuto      Format = "auto"
+	FormatCsv       Format = "csv"
+	FormatJSONLines Format = "jsonl"
+	FormatJSON      Format = "json"
+	FormatParquet   Format = "parquet"
+)
+
+// ReadKeysFunc reads the keys from the reader into the channel.
+// It stops with the error of the context once the context is done
+type ReadKeysFunc func(ctx context.Context, opts Options, reader io.Reader, keysOuput chan<- string) error
+
+// sendKey pushes the key into the channel, unless the context is done first
+func sendKey(ctx context.Context, keysOuput chan<- string, key string) error {
+	select {
+	case keysOuput <- key:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// contextCheckRows is the no. of rows read between checks of the context, so that reading stops once it is done
+// even when no key is sent, eg. when the filter drops every row
+const contextCheckRows = 1024
+
+// checkContext returns the error of the context once it is done, it is only checked every contextCheckRows rows
+func checkContext(ctx context.Context, rows int) error {
+	if rows%contextCheckRows != 0 {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// ParseFormat parses the name of a format
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case FormatAuto, FormatCsv, FormatJSONLines, FormatJSON, FormatParquet:
+		return format, nil
+	case "ndjson":
+		return FormatJSONLines, nil
+	case "":
+		return FormatAuto, nil
+	}
+
+	return "", errors.Errorf("unknown format: %s", name)
+}
+
+// FormatFromPath finds the format from the file extension, files with an unknown extension are taken to be csv.
+// A compression extension is skipped, eg. users.jsonl.gz is jsonl
+func FormatFromPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(trimCompressionExt(path))) {
+	case ".jsonl", ".ndjson":
+		return FormatJSONLines
+	case ".json":
+		return FormatJSON
+	case ".parquet":
+		return FormatParquet
+	default:
+		return FormatCsv
+	}
+}
+
+// ForFormat returns the function to read keys from files in the format, one at a time, see BatchedForFormat.
+// For FormatAuto the format is picked using the path
+func ForFormat(format Format, path string) (ReadKeysFunc, error) {
+	read, err := BatchedForFormat(format, path)
+	if err != nil {
+		return nil, err
+	}
+	return Unbatched(read), nil
+}
@@ -0,0 +1,79 @@
+package reader
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseFormat(t *testing.T) {
+	for name, expected := range map[string]Format{
+		"":        FormatAuto,
+		"auto":    FormatAuto,
+		"CSV":     FormatCsv,
+		"jsonl":   FormatJSONLines,
+		"ndjson":  FormatJSONLines,
+		"json":    FormatJSON,
+		"Parquet": FormatParquet,
+	} {
+		format, err := ParseFormat(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, format, name)
+	}
+
+	_, err := ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func Test_FormatFromPath(t *testing.T) {
+	for path, expected := range map[string]Format{
+		"a.csv":         FormatCsv,
+		"a.txt":         FormatCsv,
+		"a":             FormatCsv,
+		"dir.json/a":    FormatCsv,
+		"a.jsonl":       FormatJSONLines,
+		"a.NDJSON":      FormatJSONLines,
+		"/data/a.json":  FormatJSON,
+		"./a.users.csv": FormatCsv,
+		"a.parquet":     FormatParquet,
+		"a.jsonl.gz":    FormatJSONLines,
+		"a.json.zst":    FormatJSON,
+		"a.gz":          FormatCsv,
+	} {
+		assert.Equal(t, expected, FormatFromPath(path), path)
+	}
+}
+
+func Test_ForFormat(t *testing.T) {
+	csvContent, jsonLines, jsonArray := "id\na\nb\n", "{\"id\": \"a\"}\n{\"id\": \"b\"}\n", `[{"id": "a"}, {"id": "b"}]`
+	parquetContent, err := ioutil.ReadFile("testdata/users.parquet")
+	assert.NoError(t, err)
+
+	// the reader picked reads keys from the content of the format, and fails on the others
+	for _, tc := range []struct {
+		format   Format
+		path     string
+		content  string
+		expected []string
+	}{
+		{FormatAuto, "a.csv", csvContent, []string{"a", "b"}},
+		{FormatAuto, "a.jsonl", jsonLines, []string{"a", "b"}},
+		{FormatAuto, "a.json", jsonArray, []string{"a", "b"}},
+		{FormatCsv, "a.json", csvContent, []string{"a", "b"}},
+		{FormatJSONLines, "a.csv", jsonLines, []string{"a", "b"}},
+		{FormatJSON, "a", jsonArray, []string{"a", "b"}},
+		{FormatAuto, "a.PARQUET", string(parquetContent), []string{"u0", "u1", "u2", "u0", "u1"}},
+		{FormatParquet, "a", string(parquetContent), []string{"u0", "u1", "u2", "u0", "u1"}},
+	} {
+		read, err := ForFormat(tc.format, tc.path)
+		assert.NoError(t, err)
+
+		keys, err := readJSONKeys(t, read, Options{Key: []string{"id"}}, tc.content)
+		assert.NoError(t, err, "%s %s", tc.format, tc.path)
+		assert.Equal(t, tc.expected, keys, "%s %s", tc.format, tc.path)
+	}
+
+	_, err = ForFormat(Format("xml"), "a.xml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,317 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ReadKeysFromJSONLinesIntoChannel reads JSON Lines content, one object per line, to find the key for each object
+// and push into the passed in channel. Each key column is a dotted path to a field, eg. user.id.
+// Returns when end of file is reached or when error
+func ReadKeysFromJSONLinesIntoChannel(ctx context.Context, opts Options, reader io.Reader, keysOuput chan<- string) error {
+	return Unbatched(ReadKeyBatchesFromJSONLinesIntoChannel)(ctx, opts, reader, keysOuput)
+}
+
+// ReadKeyBatchesFromJSONLinesIntoChannel is ReadKeysFromJSONLinesIntoChannel sending batches of keys
+func ReadKeyBatchesFromJSONLinesIntoChannel(ctx context.Context, opts Options, reader io.Reader, batchesOutput chan<- []string) error {
+	return readBatches(ctx, opts, batchesOutput, func(emit func(key string) error) error {
+		return readJSONLines(ctx, opts, reader, emit)
+	})
+}
+
+// readJSONLines calls emit with the key of each object that matches the filter. Malformed lines, that are not json or do not have the key,
+// are skipped as set by Options.Malformed
+func readJSONLines(ctx context.Context, opts Options, reader io.Reader, emit func(key string) error) error {
+	if reader == nil {
+		return errors.New("json lines source is nil")
+	}
+
+	paths, err := parseFieldPaths(opts)
+	if err != nil {
+		return err
+	}
+	filterPaths, err := parseFilterPaths(opts)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(reader)
+	// allow for long lines
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	skipper := newRowSkipper(opts)
+	rows := newRowFilter(opts)
+	keys := newKeyWriter(opts, emit)
+	values := make([]string, len(paths))
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		if err := checkContext(ctx, line); err != nil {
+			return err
+		}
+
+		content := bytes.TrimSpace(scanner.Bytes())
+		if len(content) == 0 {
+			continue
+		}
+
+		record, err := decodeJSONLine(content, line)
+		if err == nil && !rows.matchJSON(record, filterPaths) {
+			continue
+		}
+		skipper.rows++
+		if err == nil {
+			err = errors.Wrapf(extractFields(record, paths, opts.Normalizers, values), "on line %v", line)
+		}
+		if err != nil {
+			if err := skipper.skip(line, scanner.Bytes(), err); err != nil {
+				return errors.Wrap(err, "malformed line")
+			}
+			continue
+		}
+
+		if err := keys.write(values); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "while reading from reader")
+	}
+
+	return skipper.done()
+}
+
+// decodeJSONLine decodes the object on the line
+func decodeJSONLine(content []byte, line int) (interface{}, error) {
+	var record interface{}
+	if err := decodeJSON(bytes.NewReader(content), &record); err != nil {
+		return nil, errors.Wrapf(err, "invalid json on line %v", line)
+	}
+	return record, nil
+}
+
+// ReadKeysFromJSONArrayIntoChannel reads a JSON array of objects to find the key for each object
+// and push into the passed in channel. The objects are decoded one at a time so the whole array is never in memory.
+// Each key column is a dotted path to a field, eg. user.id.
+// Returns when end of file is reached or when error
+func ReadKeysFromJSONArrayIntoChannel(ctx context.Context, opts Options, reader io.Reader, keysOuput chan<- string) error {
+	return Unbatched(ReadKeyBatchesFromJSONArrayIntoChannel)(ctx, opts, reader, keysOuput)
+}
+
+// ReadKeyBatchesFromJSONArrayIntoChannel is ReadKeysFromJSONArrayIntoChannel sending batches of keys
+func ReadKeyBatchesFromJSONArrayIntoChannel(ctx context.Context, opts Options, reader io.Reader, batchesOutput chan<- []string) error {
+	return readBatches(ctx, opts, batchesOutput, func(emit func(key string) error) error {
+		return readJSONArray(ctx, opts, reader, emit)
+	})
+}
+
+// readJSONArray calls emit with the key of each object that matches the filter. Malformed objects, that do not have the key,
+// are skipped as set by Options.Malformed, an array that is not valid json always fails
+func readJSONArray(ctx context.Context, opts Options, reader io.Reader, emit func(key string) error) error {
+	if reader == nil {
+		return errors.New("json source is nil")
+	}
+
+	paths, err := parseFieldPaths(opts)
+	if err != nil {
+		return err
+	}
+	filterPaths, err := parseFilterPaths(opts)
+	if err != nil {
+		return err
+	}
+
+	// the line and bytes of each object are found from where it is in the file, for the objects that are rejected
+	lines := newLineOffsets(reader)
+	decoder := json.NewDecoder(lines)
+	decoder.UseNumber()
+
+	token, err := decoder.Token()
+	if err == io.EOF {
+		// empty file
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "while reading from reader")
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.Errorf("expected json array, found: %v", token)
+	}
+
+	skipper := newRowSkipper(opts)
+	rows := newRowFilter(opts)
+	keys := newKeyWriter(opts, emit)
+	values := make([]string, len(paths))
+
+	for index := 0; decoder.More(); index++ {
+		if err := checkContext(ctx, index+1); err != nil {
+			return err
+		}
+
+		start := decoder.InputOffset()
+		var record interface{}
+		if err := decoder.Decode(&record); err != nil {
+			return errors.Wrapf(err, "invalid json at index %v", index)
+		}
+
+		// asked for every object, so that only the newlines and bytes read ahead by the decoder are kept
+		line, raw := lines.value(start, decoder.InputOffset())
+
+		if !rows.matchJSON(record, filterPaths) {
+			continue
+		}
+		skipper.rows++
+
+		if err := extractFields(record, paths, opts.Normalizers, values); err != nil {
+			if err := skipper.skip(line, raw, errors.Wrapf(err, "at index %v", index)); err != nil {
+				return errors.Wrap(err, "malformed object")
+			}
+			continue
+		}
+
+		if err := keys.write(values); err != nil {
+			return err
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return errors.Wrap(err, "while reading end of json array")
+	}
+
+	return skipper.done()
+}
+
+func decodeJSON(reader io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// parseFieldPaths splits each key column into the fields along its path, each field by name or by index, see column.
+// A dot that is part of a field name can be escaped as \.
+func parseFieldPaths(opts Options) ([][]column, error) {
+	if len(opts.Key) == 0 {
+		return nil, errors.New("key columns are empty")
+	}
+	return parsePaths(opts.Key, "key", opts)
+}
+
+// parsePaths splits each of the specs into the fields along its path, kind is what the specs are for errors
+func parsePaths(specs []string, kind string, opts Options) ([][]column, error) {
+	paths := make([][]column, 0, len(specs))
+	for _, key := range specs {
+		var fields []string
+		var field strings.Builder
+
+		for i := 0; i < len(key); i++ {
+			switch {
+			case key[i] == '\\' && i+1 < len(key) && key[i+1] == '.':
+				field.WriteByte('.')
+				i++
+			case key[i] == '.':
+				fields = append(fields, field.String())
+				field.Reset()
+			default:
+				field.WriteByte(key[i])
+			}
+		}
+		fields = append(fields, field.String())
+
+		path := make([]column, len(fields))
+		for i, f := range fields {
+			if f == "" {
+				return nil, errors.Errorf("invalid %s (%s), field names cannot be empty", kind, key)
+			}
+
+			var err error
+			if path[i], err = parseColumn(f, opts, false); err != nil {
+				return nil, errors.Wrapf(err, "invalid %s (%s)", kind, key)
+			}
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// matchJSON is whether the object matches the filter. A field that the object does not have is empty
+func (f *rowFilter) matchJSON(record interface{}, paths [][]column) bool {
+	for i, path := range paths {
+		value, err := extractField(record, path)
+		if err != nil {
+			value = ""
+		}
+		f.values[i] = value
+	}
+	return f.match()
+}
+
+// extractFields finds the value of each path in the record and writes it into values after normalizing
+func extractFields(record interface{}, paths [][]column, normalizers []Normalizer, values []string) error {
+	for i, path := range paths {
+		value, err := extractField(record, path)
+		if err != nil {
+			return err
+		}
+		values[i] = normalize(value, normalizers)
+	}
+	return nil
+}
+
+// extractField walks the path down nested objects, and arrays for the fields given by index, and returns the value as a string.
+// Numbers are kept as they are written, null is an empty string and objects or arrays are compact json
+func extractField(record interface{}, path []column) (string, error) {
+	current := record
+	for _, field := range path {
+		if field.byIndex() {
+			array, ok := current.([]interface{})
+			if !ok {
+				return "", errors.Errorf("key (%s) does not exist, the parent of %s is not an array", pathString(path), field)
+			}
+			if field.index >= len(array) {
+				return "", errors.Errorf("key (%s) does not exist, the array only has %v values", pathString(path), len(array))
+			}
+			current = array[field.index]
+			continue
+		}
+
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return "", errors.Errorf("key (%s) does not exist, the parent of %s is not an object", pathString(path), field)
+		}
+
+		current, ok = object[field.name]
+		if !ok {
+			return "", errors.Errorf("key (%s) does not exist", pathString(path))
+		}
+	}
+
+	switch value := current.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		if value {
+			return "true", nil
+		}
+		return "false", nil
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to encode key (%s)", pathString(path))
+		}
+		return string(encoded), nil
+	}
+}
@@ -0,0 +1,146 @@
+package reader
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const dummyJSONLines = `{"user": {"id": "a", "region": "eu"}, "amount": 1}
+{"user": {"id": "b", "region": "us"}, "amount": 2.50}
+
+{"user": {"id": 3, "region": null}, "amount": 3}
+`
+
+const dummyJSONArray = `[
+	{"user": {"id": "a", "region": "eu"}, "amount": 1},
+	{"user": {"id": "b", "region": "us"}, "amount": 2.50},
+	{"user": {"id": 3, "region": null}, "amount": 3}
+]`
+
+func readJSONKeys(t *testing.T, read ReadKeysFunc, opts Options, content string) ([]string, error) {
+	t.Helper()
+
+	outputChan := make(chan string, 16)
+	err := read(context.Background(), opts, strings.NewReader(content), outputChan)
+	close(outputChan)
+
+	var keys []string
+	for k := range outputChan {
+		keys = append(keys, k)
+	}
+	return keys, err
+}
+
+func Test_ReadKeysFromJSONLinesIntoChannel(t *testing.T) {
+	keys, err := readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{Key: []string{"user.id"}}, dummyJSONLines)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "3"}, keys)
+}
+
+func Test_ReadKeysFromJSONLinesIntoChannel_NumbersAsWritten(t *testing.T) {
+	keys, err := readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{Key: []string{"amount"}}, dummyJSONLines)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2.50", "3"}, keys)
+}
+
+func Test_ReadKeysFromJSONLinesIntoChannel_CompositeKey(t *testing.T) {
+	keys, err := readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{
+		Key:         []string{"user.id", "user.region"},
+		Normalizers: []Normalizer{strings.ToUpper},
+	}, dummyJSONLines)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1:A2:EU", "1:B2:US", "1:30:"}, keys)
+}
+
+func Test_ReadKeysFromJSONLinesIntoChannel_NestedValue(t *testing.T) {
+	keys, err := readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{Key: []string{"user"}}, `{"user": {"id": 1, "tags": ["x", true]}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"id":1,"tags":["x",true]}`}, keys)
+}
+
+func Test_ReadKeysFromJSONLinesIntoChannel_EscapedDot(t *testing.T) {
+	keys, err := readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{Key: []string{`user\.id`}}, `{"user.id": "a", "user": {"id": "b"}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, keys)
+}
+
+func Test_ReadKeysFromJSONLinesIntoChannel_Empty(t *testing.T) {
+	keys, err := readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{Key: []string{"id"}}, "")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func Test_ReadKeysFromJSONLinesIntoChannel_Errors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		key     string
+		content string
+		err     string
+	}{
+		"missing field":  {"user.name", dummyJSONLines, "on line 1: key (user.name) does not exist"},
+		"not an object":  {"amount.value", dummyJSONLines, "on line 1: key (amount.value) does not exist, the parent of value is not an object"},
+		"invalid json":   {"id", "{\"id\": \"a\"}\n{\"id\": ", "invalid json on line 2"},
+		"empty field":    {"user..id", dummyJSONLines, "invalid key (user..id), field names cannot be empty"},
+		"record not obj": {"id", "[1, 2]", "on line 1: key (id) does not exist, the parent of id is not an object"},
+	} {
+		_, err := readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{Key: []string{tc.key}}, tc.content)
+		if assert.Error(t, err, name) {
+			assert.Contains(t, err.Error(), tc.err, name)
+		}
+	}
+}
+
+func Test_ReadKeysFromJSONIntoChannel_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := ReadKeysFromJSONLinesIntoChannel(ctx, Options{Key: []string{"user.id"}}, strings.NewReader(dummyJSONLines), make(chan string))
+	assert.Equal(t, context.Canceled, err)
+
+	err = ReadKeysFromJSONArrayIntoChannel(ctx, Options{Key: []string{"user.id"}}, strings.NewReader(dummyJSONArray), make(chan string))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func Test_ReadKeysFromJSONLinesIntoChannel_Nil(t *testing.T) {
+	err := ReadKeysFromJSONLinesIntoChannel(context.Background(), Options{Key: []string{"id"}}, nil, make(chan string))
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromJSONArrayIntoChannel(t *testing.T) {
+	keys, err := readJSONKeys(t, ReadKeysFromJSONArrayIntoChannel, Options{Key: []string{"user.id", "user.region"}}, dummyJSONArray)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1:a2:eu", "1:b2:us", "1:30:"}, keys)
+}
+
+func Test_ReadKeysFromJSONArrayIntoChannel_Empty(t *testing.T) {
+	for _, content := range []string{"", "[]", " [ ] "} {
+		keys, err := readJSONKeys(t, ReadKeysFromJSONArrayIntoChannel, Options{Key: []string{"id"}}, content)
+		assert.NoError(t, err, content)
+		assert.Empty(t, keys, content)
+	}
+}
+
+func Test_ReadKeysFromJSONArrayIntoChannel_Errors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		key     string
+		content string
+		err     string
+	}{
+		"not an array":  {"id", `{"id": 1}`, "expected json array, found: {"},
+		"missing field": {"user.name", dummyJSONArray, "at index 0: key (user.name) does not exist"},
+		"unterminated":  {"id", `[{"id": 1}, {"id": 2}`, "invalid json at index 2"},
+		"invalid json":  {"id", `[{"id": 1}, {"id": }]`, "invalid json at index 1"},
+	} {
+		_, err := readJSONKeys(t, ReadKeysFromJSONArrayIntoChannel, Options{Key: []string{tc.key}}, tc.content)
+		if assert.Error(t, err, name) {
+			assert.Contains(t, err.Error(), tc.err, name)
+		}
+	}
+}
+
+func Test_ReadKeysFromJSONArrayIntoChannel_Nil(t *testing.T) {
+	err := ReadKeysFromJSONArrayIntoChannel(context.Background(), Options{Key: []string{"id"}}, nil, make(chan string))
+	assert.Error(t, err)
+}
@@ -0,0 +1,245 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MalformedFail and MalformedSkip are the values of ParseMalformedRows to fail on the first malformed row,
+// or to skip every one of them
+const (
+	MalformedFail = "fail"
+	MalformedSkip = "skip"
+)
+
+// MalformedRows is what is done with the rows of a csv or JSON Lines file, or the objects of a JSON array, that cannot be
+// parsed or do not have the key. The zero value fails on the first of them. A malformed header, a JSON array that is not
+// valid json, or a file that cannot be read, always fails
+type MalformedRows struct {
+	// Skip skips the malformed rows instead of failing
+	Skip bool
+	// MaxRows is the most rows that are skipped before failing, 0 for no limit
+	MaxRows int
+	// MaxPercent is the most percent of the rows of a file that are skipped, 0 for no limit.
+	// It is checked once the whole file is read
+	MaxPercent float64
+}
+
+// ParseMalformedRows parses fail, skip, a no. of rows such as 100 or a percent of the rows such as 0.5% to skip up to
+func ParseMalformedRows(value string) (MalformedRows, error) {
+	switch strings.ToLower(value) {
+	case MalformedFail, "":
+		return MalformedRows{}, nil
+	case MalformedSkip:
+		return MalformedRows{Skip: true}, nil
+	}
+
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || !(percent > 0 && percent <= 100) {
+			return MalformedRows{}, errors.Errorf("invalid percent of malformed rows, expected more than 0%% and up to 100%%: %s", value)
+		}
+		return MalformedRows{Skip: true, MaxPercent: percent}, nil
+	}
+
+	rows, err := strconv.Atoi(value)
+	if err != nil {
+		return MalformedRows{}, errors.Errorf("expected fail, skip, a no. of rows or a percent of rows, got: %s", value)
+	}
+	if rows <= 0 {
+		return MalformedRows{}, errors.Errorf("invalid no. of malformed rows, expected more than 0: %s", value)
+	}
+	return MalformedRows{Skip: true, MaxRows: rows}, nil
+}
+
+// Reject is a malformed row that is skipped
+type Reject struct {
+	// Line is the line of the file the row starts on, from 1
+	Line int
+	// Raw is the row as it is in the file, without its line ending
+	Raw []byte
+	// Reason is why the row is malformed
+	Reason string
+}
+
+// RejectFunc is called with each malformed row that is skipped, see Options.OnReject
+type RejectFunc func(reject Reject) error
+
+// rowSkipper applies the MalformedRows of the options to the rows of a file
+type rowSkipper struct {
+	policy   MalformedRows
+	onReject RejectFunc
+	// rows is the no. of rows read, malformed or not, leaving out the rows that do not match the filter
+	rows    int
+	skipped int
+}
+
+func newRowSkipper(opts Options) *rowSkipper {
+	return &rowSkipper{
+		policy:   opts.Malformed,
+		onReject: opts.OnReject,
+	}
+}
+
+// skip is called with a malformed row, it returns the error to fail with when the row cannot be skipped
+func (s *rowSkipper) skip(line int, raw []byte, reason error) error {
+	if !s.policy.Skip {
+		return reason
+	}
+
+	s.skipped++
+	if s.policy.MaxRows > 0 && s.skipped > s.policy.MaxRows {
+		return errors.Wrapf(reason, "more than %v malformed rows", s.policy.MaxRows)
+	}
+
+	if s.onReject == nil {
+		return nil
+	}
+
+	reject := Reject{
+		Line:   line,
+		Raw:    append([]byte(nil), bytes.TrimRight(raw, "\r\n")...),
+		Reason: reason.Error(),
+	}
+	return errors.Wrap(s.onReject(reject), "unable to reject row")
+}
+
+// done checks that no more than MaxPercent of the rows are skipped, once every row is read
+func (s *rowSkipper) done() error {
+	if s.policy.MaxPercent <= 0 || s.rows == 0 {
+		return nil
+	}
+
+	if float64(s.skipped)*100 > s.policy.MaxPercent*float64(s.rows) {
+		return errors.Errorf("%v of %v rows are malformed, more than %v%%", s.skipped, s.rows, s.policy.MaxPercent)
+	}
+	return nil
+}
+
+// rawLines hands the reader it wraps to a csv.Reader one line at a time. The csv.Reader then never reads past the end
+// of the record it is reading, so that the lines of the last record, as they are in the file, are known
+type rawLines struct {
+	reader  *bufio.Reader
+	comment rune
+	// pending is the rest of the line not yet handed out
+	pending []byte
+	err     error
+	// raw has the lines handed out since the last record, starting on line start
+	raw   []byte
+	start int
+	lines int
+}
+
+func newRawLines(reader io.Reader, dialect CsvDialect) *rawLines {
+	return &rawLines{
+		reader:  bufio.NewReader(reader),
+		comment: dialect.Comment,
+	}
+}
+
+func (r *rawLines) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		line, err := r.reader.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull {
+			// the error is returned once the line before it is handed out
+			r.err = err
+		}
+		if len(line) == 0 {
+			return 0, r.err
+		}
+		r.pending = line
+	}
+
+	n := copy(p, r.pending)
+	r.lines += bytes.Count(r.pending[:n], []byte("\n"))
+	r.raw = append(r.raw, r.pending[:n]...)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// record returns the line the last record starts on and its lines, leaving out the blank and comment lines
+// the csv.Reader skipped before it. The lines are only valid until the next record is read
+func (r *rawLines) record() (int, []byte) {
+	raw, line := r.raw, r.start+1
+	for len(raw) > 0 {
+		end := bytes.IndexByte(raw, '\n')
+		if end < 0 {
+			break
+		}
+
+		current := raw[:end+1]
+		blank := len(bytes.TrimRight(current, "\r\n")) == 0
+		comment := r.comment != 0 && bytes.HasPrefix(current, []byte(string(r.comment)))
+		if !blank && !comment {
+			break
+		}
+		raw = raw[end+1:]
+		line++
+	}
+	return line, raw
+}
+
+// next starts the next record
+func (r *rawLines) next() {
+	r.raw = r.raw[:0]
+	r.start = r.lines
+}
+
+// lineOffsets counts the lines of the reader it wraps as it is read, to find the line of an offset into what is read.
+// Only the newlines past the last offset asked for are kept, and the bytes read from the last value on, see value
+type lineOffsets struct {
+	reader io.Reader
+	read   int64
+	// newlines are the offsets of the newlines read past the last offset asked for
+	newlines []int64
+	line     int
+	// raw has the bytes read from offset rawStart on
+	raw      []byte
+	rawStart int64
+}
+
+func newLineOffsets(reader io.Reader) *lineOffsets {
+	return &lineOffsets{reader: reader, line: 1}
+}
+
+func (l *lineOffsets) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			l.newlines = append(l.newlines, l.read+int64(i))
+		}
+	}
+	l.raw = append(l.raw, p[:n]...)
+	l.read += int64(n)
+	return n, err
+}
+
+// lineAt returns the line, from 1, of the byte at offset. The offsets asked for cannot go back
+func (l *lineOffsets) lineAt(offset int64) int {
+	passed := 0
+	for passed < len(l.newlines) && l.newlines[passed] < offset {
+		passed++
+	}
+	l.line += passed
+	l.newlines = append(l.newlines[:0], l.newlines[passed:]...)
+	return l.line
+}
+
+// value returns the bytes of the JSON value read from offset start up to end, the offsets of the decoder before
+// and after it was decoded, leaving out the comma and spaces before it, along with the line it starts on.
+// The bytes before end are then dropped, they are only valid until the next value
+func (l *lineOffsets) value(start, end int64) (int, []byte) {
+	raw := bytes.TrimLeft(l.raw[start-l.rawStart:end-l.rawStart], ", \t\r\n")
+	l.raw = l.raw[end-l.rawStart:]
+	l.rawStart = end
+	return l.lineAt(end - int64(len(raw))), raw
+}
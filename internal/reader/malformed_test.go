@@ -0,0 +1,251 @@
+package reader
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dummyMalformedCsv has a row with a bare quote on line 3, a row with too many fields on line 5 after a blank line,
+// and a quoted field over two lines on line 6
+const dummyMalformedCsv = "id,key\n" +
+	"1,a\n" +
+	"2,b\"c\n" +
+	"\n" +
+	"3,c,extra\n" +
+	"4,\"d\nd\"\n" +
+	"5,e\n"
+
+func Test_ParseMalformedRows(t *testing.T) {
+	for value, expected := range map[string]MalformedRows{
+		"":     {},
+		"fail": {},
+		"SKIP": {Skip: true},
+		"100":  {Skip: true, MaxRows: 100},
+		"0.5%": {Skip: true, MaxPercent: 0.5},
+		"100%": {Skip: true, MaxPercent: 100},
+	} {
+		policy, err := ParseMalformedRows(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, policy, value)
+	}
+
+	for _, value := range []string{"0", "-1", "0%", "101%", "x%", "some"} {
+		_, err := ParseMalformedRows(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func Test_ReadKeysFromCsvIntoChannel_MalformedRows(t *testing.T) {
+	var rejects []Reject
+	opts := Options{
+		Key:       []string{"key"},
+		Malformed: MalformedRows{Skip: true},
+		OnReject: func(reject Reject) error {
+			rejects = append(rejects, reject)
+			return nil
+		},
+	}
+
+	keys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, dummyMalformedCsv)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "d\nd", "e"}, keys)
+
+	if assert.Len(t, rejects, 2) {
+		assert.Equal(t, 3, rejects[0].Line)
+		assert.Equal(t, `2,b"c`, string(rejects[0].Raw))
+		assert.Contains(t, rejects[0].Reason, "bare \"")
+		assert.Equal(t, 5, rejects[1].Line)
+		assert.Equal(t, "3,c,extra", string(rejects[1].Raw))
+		assert.Contains(t, rejects[1].Reason, "wrong number of fields")
+	}
+
+	_, err = readJSONKeys(t, ReadKeysFromCsvIntoChannel, Options{Key: []string{"key"}}, dummyMalformedCsv)
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromCsvIntoChannel_MalformedRowsLimit(t *testing.T) {
+	for _, tc := range []struct {
+		policy MalformedRows
+		fails  bool
+	}{
+		{MalformedRows{Skip: true, MaxRows: 2}, false},
+		{MalformedRows{Skip: true, MaxRows: 1}, true},
+		// 2 of the 5 rows
+		{MalformedRows{Skip: true, MaxPercent: 40}, false},
+		{MalformedRows{Skip: true, MaxPercent: 39.9}, true},
+	} {
+		_, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, Options{Key: []string{"key"}, Malformed: tc.policy}, dummyMalformedCsv)
+		assert.Equal(t, tc.fails, err != nil, tc.policy)
+	}
+}
+
+func Test_ReadKeysFromCsvIntoChannel_MalformedShortRow(t *testing.T) {
+	var rejects []Reject
+	opts := Options{
+		Key:       []string{"#3"},
+		NoHeader:  true,
+		Csv:       CsvDialect{FieldsPerRecord: -1, Comment: '#'},
+		Malformed: MalformedRows{Skip: true},
+		OnReject: func(reject Reject) error {
+			rejects = append(rejects, reject)
+			return nil
+		},
+	}
+
+	keys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, "1,a,x\r\n# comment\r\n2,b\r\n3,c,z")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"x", "z"}, keys)
+	assert.Equal(t, []Reject{{Line: 3, Raw: []byte("2,b"), Reason: "key (#3) is not in row 2, it only has 2 columns"}}, rejects)
+}
+
+func Test_ReadKeysFromCsvIntoChannel_MalformedLongRow(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+
+	var rejects []Reject
+	opts := Options{
+		Key:       []string{"key"},
+		Malformed: MalformedRows{Skip: true},
+		OnReject: func(reject Reject) error {
+			rejects = append(rejects, reject)
+			return nil
+		},
+	}
+
+	keys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, "id,key\n1,"+long+"\"\n2,b\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, keys)
+	if assert.Len(t, rejects, 1) {
+		assert.Equal(t, "1,"+long+"\"", string(rejects[0].Raw))
+	}
+}
+
+func Test_ReadKeysFromCsvIntoChannel_MalformedHeader(t *testing.T) {
+	opts := Options{Key: []string{"key"}, Malformed: MalformedRows{Skip: true}}
+	_, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, "id,\"key\n1,a\n")
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromCsvIntoChannel_RejectError(t *testing.T) {
+	opts := Options{
+		Key:       []string{"key"},
+		Malformed: MalformedRows{Skip: true},
+		OnReject: func(reject Reject) error {
+			return assert.AnError
+		},
+	}
+
+	_, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, dummyMalformedCsv)
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromJSONLinesIntoChannel_MalformedRows(t *testing.T) {
+	content := `{"user": {"id": "a"}}
+{"user": {"id":
+{"user": {}}
+{"user": {"id": "b"}}
+`
+
+	var rejects []Reject
+	opts := Options{
+		Key:       []string{"user.id"},
+		Malformed: MalformedRows{Skip: true},
+		OnReject: func(reject Reject) error {
+			rejects = append(rejects, reject)
+			return nil
+		},
+	}
+
+	keys, err := readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, opts, content)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
+	if assert.Len(t, rejects, 2) {
+		assert.Equal(t, 2, rejects[0].Line)
+		assert.Equal(t, `{"user": {"id":`, string(rejects[0].Raw))
+		assert.Equal(t, 3, rejects[1].Line)
+		assert.Contains(t, rejects[1].Reason, "does not exist")
+	}
+
+	opts.Malformed = MalformedRows{Skip: true, MaxPercent: 25}
+	_, err = readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, opts, content)
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromJSONArrayIntoChannel_MalformedRows(t *testing.T) {
+	content := `[
+	{"user": {"id": "a"}},
+	{"user": {}},
+	{
+		"user": {"name": "c"}
+	}, {"user": {"id": "b"}}
+]`
+
+	_, err := readJSONKeys(t, ReadKeysFromJSONArrayIntoChannel, Options{Key: []string{"user.id"}}, content)
+	assert.Error(t, err)
+
+	var rejects []Reject
+	opts := Options{
+		Key:       []string{"user.id"},
+		Malformed: MalformedRows{Skip: true},
+		OnReject: func(reject Reject) error {
+			rejects = append(rejects, reject)
+			return nil
+		},
+	}
+
+	keys, err := readJSONKeys(t, ReadKeysFromJSONArrayIntoChannel, opts, content)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
+	if assert.Len(t, rejects, 2) {
+		assert.Equal(t, 3, rejects[0].Line)
+		assert.Equal(t, `{"user": {}}`, string(rejects[0].Raw))
+		assert.Contains(t, rejects[0].Reason, "at index 1")
+		assert.Equal(t, 4, rejects[1].Line)
+		assert.Equal(t, "{\n\t\t\"user\": {\"name\": \"c\"}\n\t}", string(rejects[1].Raw))
+	}
+
+	opts.Malformed = MalformedRows{Skip: true, MaxRows: 1}
+	_, err = readJSONKeys(t, ReadKeysFromJSONArrayIntoChannel, opts, content)
+	assert.Error(t, err)
+
+	opts.Malformed = MalformedRows{Skip: true, MaxPercent: 25}
+	_, err = readJSONKeys(t, ReadKeysFromJSONArrayIntoChannel, opts, content)
+	assert.Error(t, err)
+
+	// an array that is not valid json cannot be skipped past
+	opts.Malformed = MalformedRows{Skip: true}
+	_, err = readJSONKeys(t, ReadKeysFromJSONArrayIntoChannel, opts, `[{"user": {"id": "a"}}, {"user": ]`)
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromJSONArrayIntoChannel_MalformedRowsReadByByte(t *testing.T) {
+	// the objects are split across every read of the decoder
+	content := "[{\"user\": {\"id\": 1.50}},\n {\"user\": {}} ,\r\n{\"user\":\n{\"name\": \"c\"}},{\"user\": {\"id\": \"b\"}}]"
+
+	var rejects []Reject
+	keys := make(chan string, 16)
+	err := ReadKeysFromJSONArrayIntoChannel(context.Background(), Options{
+		Key:       []string{"user.id"},
+		Malformed: MalformedRows{Skip: true},
+		OnReject: func(reject Reject) error {
+			rejects = append(rejects, reject)
+			return nil
+		},
+	}, iotest.OneByteReader(strings.NewReader(content)), keys)
+	close(keys)
+	assert.NoError(t, err)
+
+	var read []string
+	for key := range keys {
+		read = append(read, key)
+	}
+	// numbers are kept as they are written
+	assert.Equal(t, []string{"1.50", "b"}, read)
+	assert.Equal(t, []Reject{
+		{Line: 2, Raw: []byte(`{"user": {}}`), Reason: rejects[0].Reason},
+		{Line: 3, Raw: []byte("{\"user\":\n{\"name\": \"c\"}}"), Reason: rejects[1].Reason},
+	}, rejects)
+}
@@ -0,0 +1,115 @@
+package reader
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalizer transforms a key value before it is compared, eg. so that " abc" and "ABC" are the same key
+type Normalizer func(value string) string
+
+// names of the normalizers that can be passed to ParseNormalizer
+const (
+	NormalizeTrim               = "trim"
+	NormalizeLower              = "lower"
+	NormalizeUpper              = "upper"
+	NormalizeFold               = "fold"
+	NormalizeNFC                = "nfc"
+	NormalizeNFKC               = "nfkc"
+	NormalizeCollapseWhitespace = "collapse-whitespace"
+	NormalizeStripLeadingZeros  = "strip-leading-zeros"
+)
+
+// ParseNormalizer returns the normalizer for its name, or a regex replacement given as s/pattern/replacement/.
+// Any character can be used in place of / to separate the pattern and replacement, eg. s|a/b|c|
+func ParseNormalizer(spec string) (Normalizer, error) {
+	switch spec {
+	case NormalizeTrim:
+		return strings.TrimSpace, nil
+	case NormalizeLower:
+		return strings.ToLower, nil
+	case NormalizeUpper:
+		return strings.ToUpper, nil
+	case NormalizeFold:
+		return FoldCase, nil
+	case NormalizeNFC:
+		return norm.NFC.String, nil
+	case NormalizeNFKC:
+		return norm.NFKC.String, nil
+	case NormalizeCollapseWhitespace:
+		return CollapseWhitespace, nil
+	case NormalizeStripLeadingZeros:
+		return StripLeadingZeros, nil
+	}
+
+	if len(spec) > 1 && spec[0] == 's' && isDelimiter(rune(spec[1])) {
+		return parseReplace(spec)
+	}
+
+	return nil, errors.Errorf("unknown normalizer: %s", spec)
+}
+
+// FoldCase folds the case of the value so that values differing only in case are the same, eg. "Straße" and "STRASSE"
+func FoldCase(value string) string {
+	// a caser cannot be shared between goroutines
+	return cases.Fold().String(value)
+}
+
+// CollapseWhitespace replaces each run of whitespace with a single space and trims both ends
+func CollapseWhitespace(value string) string {
+	return strings.Join(strings.FieldsFunc(value, unicode.IsSpace), " ")
+}
+
+// StripLeadingZeros removes the zeros at the start of the value, leaving a single zero if it is all zeros.
+// A leading sign is kept, eg. "-007" becomes "-7"
+func StripLeadingZeros(value string) string {
+	sign := ""
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		sign, value = value[:1], value[1:]
+	}
+
+	stripped := strings.TrimLeft(value, "0")
+	if stripped == "" && value != "" {
+		stripped = "0"
+	}
+	return sign + stripped
+}
+
+// Replace replaces all matches of the pattern in the value, the replacement can refer to groups as in regexp.Expand
+func Replace(pattern *regexp.Regexp, replacement string) Normalizer {
+	return func(value string) string {
+		return pattern.ReplaceAllString(value, replacement)
+	}
+}
+
+func parseReplace(spec string) (Normalizer, error) {
+	delimiter := spec[1:2]
+	parts := strings.Split(spec[2:], delimiter)
+	if len(parts) != 3 || parts[2] != "" {
+		return nil, errors.Errorf("invalid replacement, expected s%[1]spattern%[1]sreplacement%[1]s: %[2]s", delimiter, spec)
+	}
+
+	pattern, err := regexp.Compile(parts[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pattern in replacement: %s", spec)
+	}
+
+	return Replace(pattern, parts[1]), nil
+}
+
+func isDelimiter(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r) && r != '\\'
+}
+
+// normalize applies the normalizers in order
+func normalize(value string, normalizers []Normalizer) string {
+	for _, n := range normalizers {
+		value = n(value)
+	}
+	return value
+}
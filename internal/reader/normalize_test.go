@@ -0,0 +1,73 @@
+package reader
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseNormalizer(t *testing.T) {
+	for _, tc := range []struct {
+		spec, input, expected string
+	}{
+		{NormalizeTrim, " \tabc \n", "abc"},
+		{NormalizeLower, "AbC", "abc"},
+		{NormalizeUpper, "AbC", "ABC"},
+		{NormalizeFold, "Straße", "strasse"},
+		{NormalizeFold, "ΣΑΣ", "σασ"},
+		// e followed by a combining acute accent
+		{NormalizeNFC, "e\u0301", "\u00e9"},
+		// the fi ligature is only decomposed by compatibility normalization
+		{NormalizeNFC, "\ufb01", "\ufb01"},
+		{NormalizeNFKC, "\ufb01", "fi"},
+		{NormalizeNFKC, "ｱｲ", "アイ"},
+		{NormalizeCollapseWhitespace, "  a \t b\n\nc ", "a b c"},
+		{NormalizeCollapseWhitespace, " a  b", "a b"},
+		{NormalizeStripLeadingZeros, "000123", "123"},
+		{NormalizeStripLeadingZeros, "000", "0"},
+		{NormalizeStripLeadingZeros, "-007", "-7"},
+		{NormalizeStripLeadingZeros, "", ""},
+		{NormalizeStripLeadingZeros, "a00", "a00"},
+		{"s/-//", "123-456-789", "123456789"},
+		{"s|a/b|c|", "xa/by", "xcy"},
+		{"s/^(\\w+)@(\\w+)$/${2}:${1}/", "user@host", "host:user"},
+	} {
+		normalizer, err := ParseNormalizer(tc.spec)
+		assert.NoError(t, err, tc.spec)
+		assert.Equal(t, tc.expected, normalizer(tc.input), tc.spec)
+	}
+}
+
+func Test_ParseNormalizer_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"unknown",
+		"s",
+		"strip",
+		"s/a/",
+		"s/a/b",
+		"s/a/b/c",
+		"s/(/b/",
+	} {
+		_, err := ParseNormalizer(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func Test_Replace(t *testing.T) {
+	n := Replace(regexp.MustCompile(`\s+`), "_")
+	assert.Equal(t, "a_b_c", n("a b \tc"))
+}
+
+func Test_normalize(t *testing.T) {
+	trim, err := ParseNormalizer(NormalizeTrim)
+	assert.NoError(t, err)
+	zeros, err := ParseNormalizer(NormalizeStripLeadingZeros)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "12", normalize(" 0012 ", []Normalizer{trim, zeros}))
+	// order matters
+	assert.Equal(t, "0012", normalize(" 0012 ", []Normalizer{zeros, trim}))
+	assert.Equal(t, " a ", normalize(" a ", nil))
+}
@@ -0,0 +1,96 @@
+package reader
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// the policies of NullKeys.Policy
+const (
+	// NullCount counts the null keys as any other key
+	NullCount = "count"
+	// NullExclude leaves the null keys out, they are passed to Options.OnExclude instead of being read
+	NullExclude = "exclude"
+	// NullSeparate leaves the null keys out as NullExclude does, they are then counted by their value apart from the other keys
+	NullSeparate = "separate"
+)
+
+// DefaultNullValues are the values that are null besides the empty and whitespace only ones, when NullKeys.Values is not set
+var DefaultNullValues = []string{"NULL", `\N`, "NA"}
+
+// NullKeys is what is done with the keys that are null. A key is null when any of its columns is empty, only whitespace
+// or one of the null values, once normalized. The null values are normalized the same way, so NULL is still null when lower cased
+type NullKeys struct {
+	// Policy is one of NullCount, NullExclude or NullSeparate, NullCount when empty
+	Policy string
+	// Values are the values that are null besides the empty and whitespace only ones, DefaultNullValues when nil
+	Values []string
+}
+
+// ExcludeFunc is called with each null key that is left out, see Options.OnExclude
+type ExcludeFunc func(key string) error
+
+// ParseNullPolicy parses the policy of NullKeys, one of count, exclude or separate
+func ParseNullPolicy(value string) (string, error) {
+	switch policy := strings.ToLower(value); policy {
+	case NullCount, NullExclude, NullSeparate:
+		return policy, nil
+	case "":
+		return NullCount, nil
+	}
+	return "", errors.Errorf("unknown null key policy, expected one of %s, %s or %s: %s", NullCount, NullExclude, NullSeparate, value)
+}
+
+// keyWriter joins the values of each key and emits it, unless the key is null and null keys are left out
+type keyWriter struct {
+	emit      func(key string) error
+	exclude   bool
+	nulls     map[string]bool
+	onExclude ExcludeFunc
+}
+
+func newKeyWriter(opts Options, emit func(key string) error) *keyWriter {
+	w := &keyWriter{
+		emit:      emit,
+		exclude:   opts.Nulls.Policy != "" && opts.Nulls.Policy != NullCount,
+		onExclude: opts.OnExclude,
+	}
+	if !w.exclude {
+		return w
+	}
+
+	values := opts.Nulls.Values
+	if values == nil {
+		values = DefaultNullValues
+	}
+
+	w.nulls = make(map[string]bool, len(values))
+	for _, v := range values {
+		w.nulls[strings.TrimSpace(normalize(v, opts.Normalizers))] = true
+	}
+	return w
+}
+
+// write emits the key made up of the normalized values
+func (w *keyWriter) write(values []string) error {
+	key := CompositeKey(values)
+	if !w.exclude || !w.null(values) {
+		return w.emit(key)
+	}
+
+	if w.onExclude == nil {
+		return nil
+	}
+	return errors.Wrap(w.onExclude(key), "unable to exclude key")
+}
+
+func (w *keyWriter) null(values []string) bool {
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || w.nulls[v] {
+			return true
+		}
+	}
+	return false
+}
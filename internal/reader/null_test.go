@@ -0,0 +1,119 @@
+package reader
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const dummyNullCsv = "id,key\n1,a\n2,\n3,  \n4,NULL\n5,\\N\n6,NA\n7,null\n8,b\n"
+
+func Test_ParseNullPolicy(t *testing.T) {
+	for value, expected := range map[string]string{
+		"":         NullCount,
+		"count":    NullCount,
+		"Exclude":  NullExclude,
+		"separate": NullSeparate,
+	} {
+		policy, err := ParseNullPolicy(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, policy, value)
+	}
+
+	_, err := ParseNullPolicy("drop")
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromCsvIntoChannel_NullKeys(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		opts     Options
+		expected []string
+		excluded []string
+	}{
+		{
+			name:     "count",
+			opts:     Options{Key: []string{"key"}},
+			expected: []string{"a", "", "  ", "NULL", `\N`, "NA", "null", "b"},
+		},
+		{
+			name:     "exclude",
+			opts:     Options{Key: []string{"key"}, Nulls: NullKeys{Policy: NullExclude}},
+			expected: []string{"a", "null", "b"},
+			excluded: []string{"", "  ", "NULL", `\N`, "NA"},
+		},
+		{
+			name:     "separate",
+			opts:     Options{Key: []string{"key"}, Nulls: NullKeys{Policy: NullSeparate, Values: []string{"null"}}},
+			expected: []string{"a", "NULL", `\N`, "NA", "b"},
+			excluded: []string{"", "  ", "null"},
+		},
+		{
+			name:     "normalized",
+			opts:     Options{Key: []string{"key"}, Nulls: NullKeys{Policy: NullExclude, Values: []string{"NULL"}}, Normalizers: []Normalizer{strings.ToLower}},
+			expected: []string{"a", `\n`, "na", "b"},
+			excluded: []string{"", "  ", "null", "null"},
+		},
+		{
+			name:     "no values",
+			opts:     Options{Key: []string{"key"}, Nulls: NullKeys{Policy: NullExclude, Values: []string{}}},
+			expected: []string{"a", "NULL", `\N`, "NA", "null", "b"},
+			excluded: []string{"", "  "},
+		},
+	} {
+		var excluded []string
+		tc.opts.OnExclude = func(key string) error {
+			excluded = append(excluded, key)
+			return nil
+		}
+
+		keys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, tc.opts, dummyNullCsv)
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.expected, keys, tc.name)
+		assert.Equal(t, tc.excluded, excluded, tc.name)
+	}
+}
+
+func Test_ReadKeysFromCsvIntoChannel_NullCompositeKey(t *testing.T) {
+	var excluded []string
+	opts := Options{
+		Key:   []string{"id", "key"},
+		Nulls: NullKeys{Policy: NullExclude},
+		OnExclude: func(key string) error {
+			excluded = append(excluded, key)
+			return nil
+		},
+	}
+
+	keys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, "id,key\n1,a\n,b\n3,NA\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{CompositeKey([]string{"1", "a"})}, keys)
+	assert.Equal(t, []string{CompositeKey([]string{"", "b"}), CompositeKey([]string{"3", "NA"})}, excluded)
+}
+
+func Test_ReadKeysFromCsvIntoChannel_ExcludeError(t *testing.T) {
+	opts := Options{
+		Key:   []string{"key"},
+		Nulls: NullKeys{Policy: NullExclude},
+		OnExclude: func(key string) error {
+			return assert.AnError
+		},
+	}
+
+	_, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, dummyNullCsv)
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromJSONLinesIntoChannel_NullKeys(t *testing.T) {
+	// a json null is an empty value
+	keys, err := readJSONKeys(t, ReadKeysFromJSONLinesIntoChannel, Options{Key: []string{"user.region"}, Nulls: NullKeys{Policy: NullExclude}}, dummyJSONLines)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eu", "us"}, keys)
+}
+
+func Test_ReadKeysFromParquetIntoChannel_NullKeys(t *testing.T) {
+	keys, err := readParquetKeys(t, Options{Key: []string{"id"}, Nulls: NullKeys{Policy: NullExclude, Values: []string{"u1"}}}, "testdata/users.parquet")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u0", "u2", "u0"}, keys)
+}
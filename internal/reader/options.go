@@ -0,0 +1,34 @@
+package reader
+
+import "github.com/rickyshrestha/set-intersection-exercise/internal/filter"
+
+// Options are the options for reading keys from a file
+type Options struct {
+	// Key has the columns that make up the key, each by name or by index as #n, eg. #1 for the first column
+	Key []string
+	// ZeroBased counts the columns given by index from 0 instead of from 1
+	ZeroBased bool
+	// NoHeader is set when the first row of a csv file is not a header, the key columns are then given by index,
+	// with or without the #
+	NoHeader bool
+	// Normalizers are applied in order to each key column value before it is compared
+	Normalizers []Normalizer
+	// BatchSize is the no. of keys sent at a time by a ReadKeyBatchesFunc, DefaultBatchSize when 0
+	BatchSize int
+	// Csv is the dialect of csv files
+	Csv CsvDialect
+	// Malformed is what is done with the rows of csv and JSON Lines files, and the objects of JSON arrays,
+	// that cannot be parsed or do not have the key
+	Malformed MalformedRows
+	// OnReject, if set, is called with each malformed row that is skipped
+	OnReject RejectFunc
+	// Nulls is what is done with the keys that are null, they are counted as any other key when not set
+	Nulls NullKeys
+	// OnExclude, if set, is called with each null key that is left out
+	OnExclude ExcludeFunc
+	// Filter, if set, picks the rows that keys are read from. Its fields are given as the key columns are,
+	// and compared with the values as they are in the file, before they are normalized
+	Filter *filter.Filter
+	// TempDir is where a parquet file read from a stream is copied to, the OS temp dir when empty
+	TempDir string
+}
@@ -0,0 +1,288 @@
+package reader
+
+//go:generate go run testdata/gen_parquet.go
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tav/golly/log"
+	"github.com/xitongsys/parquet-go/common"
+	parquetreader "github.com/xitongsys/parquet-go/reader"
+	parquetschema "github.com/xitongsys/parquet-go/schema"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// ReadKeysFromParquetIntoChannel reads a parquet file to find the key for each row and push into the passed in channel.
+// Only the key columns, and the fields of the filter, are read, one row group at a time. Each key column is a dotted path to a column, eg. user.id.
+// Dates, timestamps and decimals are read as text, see parquetFormats.
+// Parquet needs random access so a reader that is not a file is first copied to a temporary file.
+// Returns when end of file is reached or when error
+func ReadKeysFromParquetIntoChannel(ctx context.Context, opts Options, reader io.Reader, keysOuput chan<- string) error {
+	return Unbatched(ReadKeyBatchesFromParquetIntoChannel)(ctx, opts, reader, keysOuput)
+}
+
+// ReadKeyBatchesFromParquetIntoChannel is ReadKeysFromParquetIntoChannel sending batches of keys
+func ReadKeyBatchesFromParquetIntoChannel(ctx context.Context, opts Options, reader io.Reader, batchesOutput chan<- []string) error {
+	return readBatches(ctx, opts, batchesOutput, func(emit func(key string) error) error {
+		return readParquet(ctx, opts, reader, emit)
+	})
+}
+
+// readParquet calls emit with the key of each row that matches the filter
+func readParquet(ctx context.Context, opts Options, reader io.Reader, emit func(key string) error) error {
+	if reader == nil {
+		return errors.New("parquet source is nil")
+	}
+
+	paths, err := parseFieldPaths(opts)
+	if err != nil {
+		return err
+	}
+	filterPaths, err := parseFilterPaths(opts)
+	if err != nil {
+		return err
+	}
+
+	file, err := openParquetFile(reader, opts.TempDir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Errorf("unable to close parquet file: %s", file.Name())
+		}
+	}()
+
+	columnReader, err := parquetreader.NewParquetColumnReader(file, 1)
+	if err != nil {
+		return errors.Wrap(err, "unable to read parquet footer")
+	}
+	defer columnReader.ReadStop()
+
+	columns, err := parquetColumns(columnReader, "key", opts.Key, paths)
+	if err != nil {
+		return err
+	}
+	filterColumns, err := parquetColumns(columnReader, "filter field", filterFields(opts), filterPaths)
+	if err != nil {
+		return err
+	}
+
+	// the fields of the filter are read along with the key columns, each column only once as reading it again reads the values after
+	names := make([]string, len(columns))
+	for i, spec := range opts.Key {
+		names[i] = fmt.Sprintf("key (%s)", spec)
+	}
+	filterIndices := make([]int, len(filterColumns))
+	for i, column := range filterColumns {
+		filterIndices[i] = indexOf(columns, column)
+		if filterIndices[i] < 0 {
+			filterIndices[i] = len(columns)
+			columns = append(columns, column)
+			names = append(names, fmt.Sprintf("filter field (%s)", filterFields(opts)[i]))
+		}
+	}
+
+	formats, err := parquetFormats(columnReader.SchemaHandler, columns, names)
+	if err != nil {
+		return err
+	}
+
+	filterRows := newRowFilter(opts)
+	keys := newKeyWriter(opts, emit)
+	values := make([]string, len(paths))
+	columnValues := make([][]interface{}, len(columns))
+	read := 0
+
+	for rowGroup, meta := range columnReader.Footer.GetRowGroups() {
+		rows := meta.GetNumRows()
+		if rows == 0 {
+			continue
+		}
+
+		// the columns of a row group are read in full, so the context is checked before each
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		for i, column := range columns {
+			columnValues[i], _, _, err = columnReader.ReadColumnByPath(column, rows)
+			if err != nil {
+				return errors.Wrapf(err, "while reading %s in row group %v", names[i], rowGroup)
+			}
+
+			if int64(len(columnValues[i])) != rows {
+				return errors.Errorf("%s is a repeated column, found %v values for %v rows", names[i], len(columnValues[i]), rows)
+			}
+		}
+
+		for row := int64(0); row < rows; row++ {
+			read++
+			if err := checkContext(ctx, read); err != nil {
+				return err
+			}
+
+			for i, idx := range filterIndices {
+				filterRows.values[i] = formats[idx](columnValues[idx][row])
+			}
+			if !filterRows.match() {
+				continue
+			}
+
+			for i := range values {
+				values[i] = normalize(formats[i](columnValues[i][row]), opts.Normalizers)
+			}
+			if err := keys.write(values); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// parquetColumns finds the path of each column in the schema, specs are the columns as they were given and kind is
+// what they are for errors, eg. key. A column given by index is one of the top level columns, in the order of the schema
+func parquetColumns(columnReader *parquetreader.ParquetReader, kind string, specs []string, paths [][]column) ([]string, error) {
+	schema := columnReader.SchemaHandler
+	valueColumns := make(map[string]bool, len(schema.ValueColumns))
+	for _, column := range schema.ValueColumns {
+		valueColumns[column] = true
+	}
+
+	root := schema.GetRootExName()
+	topLevel := parquetTopLevelColumns(schema)
+	columns := make([]string, len(paths))
+
+	for i, path := range paths {
+		names := []string{root}
+		for j, field := range path {
+			if !field.byIndex() {
+				names = append(names, field.name)
+				continue
+			}
+
+			if j > 0 {
+				return nil, errors.Errorf("%s (%s) can only give a top level column by index", kind, specs[i])
+			}
+			if field.index >= len(topLevel) {
+				return nil, errors.Errorf("%s (%s) does not exist, the schema only has %v columns", kind, specs[i], len(topLevel))
+			}
+			names = append(names, topLevel[field.index])
+		}
+		columns[i] = strings.Join(names, common.PAR_GO_PATH_DELIMITER)
+
+		inPath, err := columnReader.SchemaHandler.ConvertToInPathStr(columns[i])
+		if err != nil {
+			return nil, errors.Errorf("%s (%s) does not exist in schema", kind, specs[i])
+		}
+
+		// groups such as structs and lists do not have values of their own
+		if !valueColumns[inPath] {
+			return nil, errors.Errorf("%s (%s) is not a column with values", kind, specs[i])
+		}
+	}
+
+	return columns, nil
+}
+
+// parquetTopLevelColumns returns the names of the columns at the top level of the schema, in order.
+// A group such as a struct is a single column
+func parquetTopLevelColumns(schema *parquetschema.SchemaHandler) []string {
+	var names []string
+	seen := make(map[string]bool)
+
+	for _, inPath := range schema.ValueColumns {
+		fields := strings.Split(schema.InPathToExPath[inPath], common.PAR_GO_PATH_DELIMITER)
+		if len(fields) < 2 || seen[fields[1]] {
+			continue
+		}
+		seen[fields[1]] = true
+		names = append(names, fields[1])
+	}
+	return names
+}
+
+// parquetFile is a read only source.ParquetFile on a local file
+type parquetFile struct {
+	*os.File
+	// temporary is true when the file was copied from a reader and has to be removed on close
+	temporary bool
+}
+
+// openParquetFile opens the reader as a parquet file, copying it to a temporary file in dir when it is not a file already
+func openParquetFile(reader io.Reader, dir string) (*parquetFile, error) {
+	if file, ok := reader.(*os.File); ok {
+		// open a handle of our own so closing it does not affect the caller
+		return openParquetPath(file.Name())
+	}
+
+	temp, err := ioutil.TempFile(dir, "parquet-*")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create temporary file for parquet")
+	}
+
+	pf := &parquetFile{File: temp, temporary: true}
+	if _, err := io.Copy(temp, reader); err != nil {
+		_ = pf.Close()
+		return nil, errors.Wrap(err, "while copying parquet to temporary file")
+	}
+
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		_ = pf.Close()
+		return nil, errors.Wrap(err, "while copying parquet to temporary file")
+	}
+
+	return pf, nil
+}
+
+func openParquetPath(path string) (*parquetFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open parquet file: %s", path)
+	}
+	return &parquetFile{File: file}, nil
+}
+
+// Open opens another handle on the same file, the reader opens one for each column it reads
+func (f *parquetFile) Open(name string) (source.ParquetFile, error) {
+	if name == "" {
+		name = f.Name()
+	}
+	return openParquetPath(name)
+}
+
+// Create is not supported as the file is only read
+func (f *parquetFile) Create(name string) (source.ParquetFile, error) {
+	return nil, errors.Errorf("parquet file is read only: %s", name)
+}
+
+// Write is not supported as the file is only read
+func (f *parquetFile) Write(p []byte) (int, error) {
+	return 0, errors.Errorf("parquet file is read only: %s", f.Name())
+}
+
+func (f *parquetFile) Close() error {
+	err := f.File.Close()
+	if f.temporary {
+		if removeErr := os.Remove(f.Name()); removeErr != nil && err == nil {
+			err = removeErr
+		}
+	}
+	return err
+}
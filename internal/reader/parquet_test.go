@@ -0,0 +1,196 @@
+package reader
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the fixtures are generated by testdata/gen_parquet.go
+
+func readParquetKeys(t *testing.T, opts Options, path string) ([]string, error) {
+	t.Helper()
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	outputChan := make(chan string, 256)
+	err = ReadKeysFromParquetIntoChannel(context.Background(), opts, file, outputChan)
+	close(outputChan)
+
+	var keys []string
+	for k := range outputChan {
+		keys = append(keys, k)
+	}
+	return keys, err
+}
+
+func Test_ReadKeysFromParquetIntoChannel(t *testing.T) {
+	keys, err := readParquetKeys(t, Options{Key: []string{"id"}}, "testdata/users.parquet")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u0", "u1", "u2", "u0", "u1"}, keys)
+}
+
+func Test_ReadKeysFromParquetIntoChannel_NonStringColumn(t *testing.T) {
+	keys, err := readParquetKeys(t, Options{Key: []string{"age"}}, "testdata/users.parquet")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"20", "21", "22", "23", "24"}, keys)
+}
+
+func Test_ReadKeysFromParquetIntoChannel_CompositeKeyWithNulls(t *testing.T) {
+	keys, err := readParquetKeys(t, Options{
+		Key:         []string{"id", "region"},
+		Normalizers: []Normalizer{StripLeadingZeros},
+	}, "testdata/users.parquet")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2:u02:eu", "2:u12:us", "2:u22:ap", "2:u00:", "2:u12:us"}, keys)
+}
+
+func Test_ReadKeysFromParquetIntoChannel_NestedColumn(t *testing.T) {
+	keys, err := readParquetKeys(t, Options{Key: []string{"address.city"}}, "testdata/users.parquet")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"city0", "city1", "city2", "city0", "city1"}, keys)
+}
+
+func Test_ReadKeysFromParquetIntoChannel_RowGroups(t *testing.T) {
+	keys, err := readParquetKeys(t, Options{Key: []string{"age", "address.city"}}, "testdata/users_row_groups.parquet")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 100)
+	assert.Equal(t, CompositeKey([]string{"20", "city0"}), keys[0])
+	// first row of the last row group
+	assert.Equal(t, CompositeKey([]string{"110", "city0"}), keys[90])
+	assert.Equal(t, CompositeKey([]string{"119", "city0"}), keys[99])
+}
+
+func Test_ReadKeysFromParquetIntoChannel_Empty(t *testing.T) {
+	keys, err := readParquetKeys(t, Options{Key: []string{"id"}}, "testdata/empty.parquet")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func Test_ReadKeysFromParquetIntoChannel_FromReader(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/users.parquet")
+	assert.NoError(t, err)
+
+	outputChan := make(chan string, 8)
+	err = ReadKeysFromParquetIntoChannel(context.Background(), Options{Key: []string{"id"}}, bytes.NewReader(content), outputChan)
+	assert.NoError(t, err)
+	close(outputChan)
+
+	var keys []string
+	for k := range outputChan {
+		keys = append(keys, k)
+	}
+	assert.Equal(t, []string{"u0", "u1", "u2", "u0", "u1"}, keys)
+}
+
+func Test_ReadKeysFromParquetIntoChannel_LogicalTypes(t *testing.T) {
+	for key, expected := range map[string][]string{
+		"date":    {"2021-03-04", "1969-12-31"},
+		"millis":  {"2021-03-04T05:06:07.123Z", "1969-12-31T23:59:59.5Z"},
+		"micros":  {"2021-03-04T05:06:07.123456Z", "1970-01-01T00:00:00Z"},
+		"nanos":   {"2021-03-04T05:06:07.123456789Z", "1969-12-31T23:59:59.5Z"},
+		"local":   {"2021-03-04T05:06:07.123", "1970-01-01T00:00:00"},
+		"legacy":  {"2021-03-04T05:06:07.123456789Z", "1969-12-31T23:59:59.5Z"},
+		"price":   {"12.50", "-0.07"},
+		"amount":  {"-0.005", "1.000"},
+		"balance": {"123456789012345678901.23", "-1.00"},
+		"rate":    {"-0.0015", "1.0000"},
+		"count":   {"4294967295", "7"},
+	} {
+		keys, err := readParquetKeys(t, Options{Key: []string{key}}, "testdata/types.parquet")
+		assert.NoError(t, err, key)
+		assert.Equal(t, expected, keys, key)
+	}
+
+	_, err := readParquetKeys(t, Options{Key: []string{"time"}}, "testdata/types.parquet")
+	assert.EqualError(t, err, "key (time) cannot be read: TIME_MILLIS columns are not supported")
+
+	_, err = readParquetKeys(t, Options{Key: []string{"id"}, Filter: parseFilter(t, "time = 1")}, "testdata/types.parquet")
+	assert.EqualError(t, err, "filter field (time) cannot be read: TIME_MILLIS columns are not supported")
+}
+
+func Test_ReadKeysFromParquetIntoChannel_LogicalTypesMatchCsv(t *testing.T) {
+	// the same rows written to a csv file as other tools write them
+	content := "id,date,millis,price\n" +
+		"t0,2021-03-04,2021-03-04T05:06:07.123Z,12.50\n" +
+		"t1,1969-12-31,1969-12-31T23:59:59.5Z,-0.07\n"
+	opts := Options{Key: []string{"id", "date", "millis", "price"}}
+
+	csvKeys, err := readJSONKeys(t, ReadKeysFromCsvIntoChannel, opts, content)
+	assert.NoError(t, err)
+
+	parquetKeys, err := readParquetKeys(t, opts, "testdata/types.parquet")
+	assert.NoError(t, err)
+	assert.Equal(t, csvKeys, parquetKeys)
+
+	// the filter sees the same text
+	keys, err := readParquetKeys(t, Options{Key: []string{"id"}, Filter: parseFilter(t, "date >= 2021-01-01 and price = 12.50")}, "testdata/types.parquet")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"t0"}, keys)
+}
+
+func Test_openParquetFile_TempDir(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/users.parquet")
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	file, err := openParquetFile(bytes.NewReader(content), dir)
+	assert.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(file.Name()))
+
+	// the copy is removed once closed
+	assert.NoError(t, file.Close())
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+
+	outputChan := make(chan string, 8)
+	err = ReadKeysFromParquetIntoChannel(context.Background(), Options{Key: []string{"id"}, TempDir: "./non-existent-dir"}, bytes.NewReader(content), outputChan)
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromParquetIntoChannel_Errors(t *testing.T) {
+	for key, expected := range map[string]string{
+		"missing":  "key (missing) does not exist in schema",
+		"address":  "key (address) is not a column with values",
+		"tags":     "key (tags) is not a column with values",
+		"id..name": "invalid key (id..name), field names cannot be empty",
+	} {
+		_, err := readParquetKeys(t, Options{Key: []string{key}}, "testdata/users.parquet")
+		assert.EqualError(t, err, expected, key)
+	}
+}
+
+func Test_ReadKeysFromParquetIntoChannel_RepeatedColumn(t *testing.T) {
+	_, err := readParquetKeys(t, Options{Key: []string{"tags.list.element"}}, "testdata/users.parquet")
+	assert.EqualError(t, err, "key (tags.list.element) is a repeated column, found 10 values for 5 rows")
+}
+
+func Test_ReadKeysFromParquetIntoChannel_NotParquet(t *testing.T) {
+	_, err := readParquetKeys(t, Options{Key: []string{"id"}}, "testdata/gen_parquet.go")
+	assert.Error(t, err)
+}
+
+func Test_ReadKeysFromParquetIntoChannel_Canceled(t *testing.T) {
+	file, err := os.Open("testdata/users.parquet")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = ReadKeysFromParquetIntoChannel(ctx, Options{Key: []string{"id"}}, file, make(chan string))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func Test_ReadKeysFromParquetIntoChannel_Nil(t *testing.T) {
+	err := ReadKeysFromParquetIntoChannel(context.Background(), Options{Key: []string{"id"}}, nil, make(chan string))
+	assert.Error(t, err)
+}
@@ -0,0 +1,204 @@
+package reader
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xitongsys/parquet-go/parquet"
+	parquetschema "github.com/xitongsys/parquet-go/schema"
+)
+
+// parquetFormat formats a value read from a column as text, so that a key read from a parquet file is the same
+// as the one read from a csv or JSON file. Null is an empty string
+type parquetFormat func(value interface{}) string
+
+// parquetFormats finds how to format the values of each column from its logical type, or its converted type for older files.
+// Dates are written as 2006-01-02, timestamps as RFC 3339 in UTC, or without the zone when they are not adjusted to UTC,
+// decimals with their scale, eg. 12.50, and UUIDs as 8-4-4-4-12 hex. names are the columns for errors, eg. key (id)
+func parquetFormats(schema *parquetschema.SchemaHandler, columns, names []string) ([]parquetFormat, error) {
+	formats := make([]parquetFormat, len(columns))
+	for i, column := range columns {
+		inPath, err := schema.ConvertToInPathStr(column)
+		if err != nil {
+			return nil, errors.Errorf("%s does not exist in schema", names[i])
+		}
+
+		if formats[i], err = parquetColumnFormat(schema.SchemaElements[schema.MapIndex[inPath]]); err != nil {
+			return nil, errors.Wrapf(err, "%s cannot be read", names[i])
+		}
+	}
+	return formats, nil
+}
+
+func parquetColumnFormat(element *parquet.SchemaElement) (parquetFormat, error) {
+	logical := element.GetLogicalType()
+	if logical == nil {
+		logical = &parquet.LogicalType{}
+	}
+
+	if element.IsSetConvertedType() {
+		switch element.GetConvertedType() {
+		case parquet.ConvertedType_DATE:
+			return parquetDate, nil
+		case parquet.ConvertedType_TIMESTAMP_MILLIS:
+			return parquetTimestamp(time.Millisecond, true), nil
+		case parquet.ConvertedType_TIMESTAMP_MICROS:
+			return parquetTimestamp(time.Microsecond, true), nil
+		case parquet.ConvertedType_DECIMAL:
+			return parquetDecimal(int(element.GetScale())), nil
+		case parquet.ConvertedType_UINT_8, parquet.ConvertedType_UINT_16, parquet.ConvertedType_UINT_32, parquet.ConvertedType_UINT_64:
+			return parquetUnsigned, nil
+		case parquet.ConvertedType_TIME_MILLIS, parquet.ConvertedType_TIME_MICROS, parquet.ConvertedType_INTERVAL:
+			return nil, errors.Errorf("%s columns are not supported", element.GetConvertedType())
+		}
+	}
+
+	switch {
+	case logical.DATE != nil:
+		return parquetDate, nil
+	case logical.TIMESTAMP != nil:
+		unit := logical.TIMESTAMP.GetUnit()
+		switch {
+		case unit.IsSetMILLIS():
+			return parquetTimestamp(time.Millisecond, logical.TIMESTAMP.IsAdjustedToUTC), nil
+		case unit.IsSetMICROS():
+			return parquetTimestamp(time.Microsecond, logical.TIMESTAMP.IsAdjustedToUTC), nil
+		default:
+			return parquetTimestamp(time.Nanosecond, logical.TIMESTAMP.IsAdjustedToUTC), nil
+		}
+	case logical.DECIMAL != nil:
+		return parquetDecimal(int(logical.DECIMAL.Scale)), nil
+	case logical.INTEGER != nil && !logical.INTEGER.IsSigned:
+		return parquetUnsigned, nil
+	case logical.UUID != nil:
+		return parquetUUID, nil
+	case logical.TIME != nil:
+		return nil, errors.New("TIME columns are not supported")
+	}
+
+	if element.GetType() == parquet.Type_INT96 {
+		return parquetInt96, nil
+	}
+	return parquetValue, nil
+}
+
+// parquetValue formats a value of a column that has no logical type, as it is
+func parquetValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parquetDate formats the no. of days since the epoch
+func parquetDate(value interface{}) string {
+	days, ok := value.(int32)
+	if !ok {
+		return parquetValue(value)
+	}
+	return time.Unix(int64(days)*24*60*60, 0).UTC().Format("2006-01-02")
+}
+
+// parquetTimestamp formats the no. of units since the epoch
+func parquetTimestamp(unit time.Duration, utc bool) parquetFormat {
+	perSecond := int64(time.Second / unit)
+	return func(value interface{}) string {
+		v, ok := value.(int64)
+		if !ok {
+			return parquetValue(value)
+		}
+		return formatTimestamp(time.Unix(v/perSecond, v%perSecond*int64(unit)), utc)
+	}
+}
+
+// julianDayOfEpoch is the julian day of 1970-01-01
+const julianDayOfEpoch = 2440588
+
+// parquetInt96 formats the legacy timestamps of 12 little endian bytes, the nanoseconds of the day followed by the julian day.
+// types.INT96ToTime is not used as it drops the nanoseconds
+func parquetInt96(value interface{}) string {
+	v, ok := value.(string)
+	if !ok || len(v) != 12 {
+		return parquetValue(value)
+	}
+
+	nanos := binary.LittleEndian.Uint64([]byte(v[:8]))
+	days := int64(int32(binary.LittleEndian.Uint32([]byte(v[8:]))))
+	return formatTimestamp(time.Unix((days-julianDayOfEpoch)*24*60*60, int64(nanos)), true)
+}
+
+func formatTimestamp(t time.Time, utc bool) string {
+	if utc {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return t.UTC().Format("2006-01-02T15:04:05.999999999")
+}
+
+// parquetDecimal formats an unscaled decimal, an int32, an int64 or the big endian two's complement bytes of one
+func parquetDecimal(scale int) parquetFormat {
+	return func(value interface{}) string {
+		unscaled := new(big.Int)
+		switch v := value.(type) {
+		case int32:
+			unscaled.SetInt64(int64(v))
+		case int64:
+			unscaled.SetInt64(v)
+		case string:
+			unscaled.SetBytes([]byte(v))
+			if len(v) > 0 && v[0]&0x80 != 0 {
+				unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(v)*8)))
+			}
+		default:
+			return parquetValue(value)
+		}
+		return formatDecimal(unscaled, scale)
+	}
+}
+
+func formatDecimal(unscaled *big.Int, scale int) string {
+	digits := new(big.Int).Abs(unscaled).String()
+	if scale > 0 {
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+
+	if unscaled.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// parquetUnsigned formats an unsigned integer, which is read as a signed one of the same size
+func parquetUnsigned(value interface{}) string {
+	switch v := value.(type) {
+	case int32:
+		return strconv.FormatUint(uint64(uint32(v)), 10)
+	case int64:
+		return strconv.FormatUint(uint64(v), 10)
+	default:
+		return parquetValue(value)
+	}
+}
+
+// parquetUUID formats the 16 bytes of a UUID
+func parquetUUID(value interface{}) string {
+	v, ok := value.(string)
+	if !ok || len(v) != 16 {
+		return parquetValue(value)
+	}
+
+	h := hex.EncodeToString([]byte(v))
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
@@ -0,0 +1,187 @@
+//go:build ignore
+// +build ignore
+
+// gen_parquet generates the parquet fixtures used by the reader tests, run with go generate from internal/reader
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type address struct {
+	City string `parquet:"name=city, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type user struct {
+	ID      string   `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Region  *string  `parquet:"name=region, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Age     int32    `parquet:"name=age, type=INT32"`
+	Address address  `parquet:"name=address"`
+	Tags    []string `parquet:"name=tags, type=MAP, convertedtype=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+}
+
+// typed has a column of each logical type that is read as text
+type typed struct {
+	ID      string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Date    int32  `parquet:"name=date, type=INT32, convertedtype=DATE"`
+	Millis  int64  `parquet:"name=millis, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Micros  int64  `parquet:"name=micros, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Nanos   int64  `parquet:"name=nanos, type=INT64, logicaltype=TIMESTAMP, logicaltype.isadjustedtoutc=true, logicaltype.unit=NANOS"`
+	Local   int64  `parquet:"name=local, type=INT64, logicaltype=TIMESTAMP, logicaltype.isadjustedtoutc=false, logicaltype.unit=MILLIS"`
+	Legacy  string `parquet:"name=legacy, type=INT96"`
+	Price   int32  `parquet:"name=price, type=INT32, convertedtype=DECIMAL, scale=2, precision=9"`
+	Amount  int64  `parquet:"name=amount, type=INT64, convertedtype=DECIMAL, scale=3, precision=18"`
+	Balance string `parquet:"name=balance, type=BYTE_ARRAY, convertedtype=DECIMAL, scale=2, precision=30"`
+	Rate    string `parquet:"name=rate, type=FIXED_LEN_BYTE_ARRAY, convertedtype=DECIMAL, scale=4, precision=20, length=9"`
+	Count   int32  `parquet:"name=count, type=INT32, convertedtype=UINT_32"`
+	Time    int32  `parquet:"name=time, type=INT32, convertedtype=TIME_MILLIS"`
+}
+
+type file struct {
+	*os.File
+}
+
+func (f file) Open(name string) (source.ParquetFile, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (f file) Create(name string) (source.ParquetFile, error) {
+	created, err := os.Create(name)
+	return file{created}, err
+}
+
+func main() {
+	write("testdata/users.parquet", new(user), 0, users(5))
+	// small row groups so that the file has more than one
+	write("testdata/users_row_groups.parquet", new(user), 30, users(100))
+	write("testdata/empty.parquet", new(user), 0, nil)
+	write("testdata/types.parquet", new(typed), 0, typedRows())
+}
+
+func typedRows() []interface{} {
+	at := time.Date(2021, 3, 4, 5, 6, 7, 123456789, time.UTC)
+	before := time.Date(1969, 12, 31, 23, 59, 59, 500000000, time.UTC)
+
+	return []interface{}{
+		typed{
+			ID:      "t0",
+			Date:    int32(at.Unix() / (24 * 60 * 60)),
+			Millis:  at.UnixNano() / int64(time.Millisecond),
+			Micros:  at.UnixNano() / int64(time.Microsecond),
+			Nanos:   at.UnixNano(),
+			Local:   at.UnixNano() / int64(time.Millisecond),
+			Legacy:  int96(at),
+			Price:   1250,
+			Amount:  -5,
+			Balance: twosComplement("12345678901234567890123", 0),
+			Rate:    twosComplement("-15", 9),
+			Count:   -1,
+		},
+		typed{
+			ID:      "t1",
+			Date:    -1,
+			Millis:  before.UnixNano() / int64(time.Millisecond),
+			Micros:  0,
+			Nanos:   before.UnixNano(),
+			Local:   0,
+			Legacy:  int96(before),
+			Price:   -7,
+			Amount:  1000,
+			Balance: twosComplement("-100", 0),
+			Rate:    twosComplement("10000", 9),
+			Count:   7,
+		},
+	}
+}
+
+// int96 is the legacy timestamp of the time, types.TimeToINT96 is not used as it drops the nanoseconds
+func int96(t time.Time) string {
+	const julianDayOfEpoch, nanosPerDay = 2440588, int64(24 * time.Hour)
+	nanos := t.UnixNano()
+	days := nanos / nanosPerDay
+	if nanos%nanosPerDay < 0 {
+		days--
+	}
+
+	b := make([]byte, 12)
+	binary.LittleEndian.PutUint64(b, uint64(nanos-days*nanosPerDay))
+	binary.LittleEndian.PutUint32(b[8:], uint32(days+julianDayOfEpoch))
+	return string(b)
+}
+
+// twosComplement is the big endian two's complement of the decimal, in at least length bytes
+func twosComplement(decimal string, length int) string {
+	v, _ := new(big.Int).SetString(decimal, 10)
+	size := len(v.Bytes()) + 1
+	if size < length {
+		size = length
+	}
+	if v.Sign() < 0 {
+		v.Add(v, new(big.Int).Lsh(big.NewInt(1), uint(size*8)))
+	}
+
+	b := v.Bytes()
+	return string(append(make([]byte, size-len(b)), b...))
+}
+
+func users(n int) []interface{} {
+	regions := []string{"eu", "us", "ap"}
+
+	res := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		u := user{
+			ID:      fmt.Sprintf("u%v", i%(n/2+1)),
+			Age:     int32(20 + i),
+			Address: address{City: fmt.Sprintf("city%v", i%3)},
+			Tags:    []string{"a", "b"},
+		}
+		if i%4 != 3 {
+			region := regions[i%len(regions)]
+			u.Region = &region
+		}
+		res = append(res, u)
+	}
+	return res
+}
+
+// write writes the rows to a new file at path with the schema of the struct, starting a new row group after every rowGroupRows rows
+func write(path string, schema interface{}, rowGroupRows int, rows []interface{}) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pw, err := writer.NewParquetWriter(file{f}, schema, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	for i, row := range rows {
+		if err := pw.Write(row); err != nil {
+			log.Fatal(err)
+		}
+
+		if rowGroupRows > 0 && (i+1)%rowGroupRows == 0 {
+			if err := pw.Flush(true); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	if err := pw.WriteStop(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
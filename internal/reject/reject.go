@@ -0,0 +1,78 @@
+package reject
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/rickyshrestha/set-intersection-exercise/internal/reader"
+)
+
+// Writer writes the malformed rows skipped while reading the files as csv, with the columns file, line, reason and row.
+// Row is the row as it is in the file. The rows of many files can be written at once
+type Writer struct {
+	mu     sync.Mutex
+	writer *csv.Writer
+	file   *os.File
+	row    []string
+}
+
+// New creates a writer of the rejected rows to w
+func New(w io.Writer) (*Writer, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"file", "line", "reason", "row"}); err != nil {
+		return nil, errors.Wrap(err, "while writing header")
+	}
+
+	return &Writer{writer: writer}, nil
+}
+
+// Create creates a writer of the rejected rows to the file at path
+func Create(path string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create file: %s", path)
+	}
+
+	w, err := New(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	w.file = file
+
+	return w, nil
+}
+
+// Write writes a row rejected from the file at path
+func (w *Writer) Write(path string, reject reader.Reject) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.row = append(w.row[:0], path, strconv.Itoa(reject.Line), reject.Reason, string(reject.Raw))
+	if err := w.writer.Write(w.row); err != nil {
+		return errors.Wrap(err, "while writing rejected row")
+	}
+	return nil
+}
+
+// Close flushes whatever is buffered and closes the file, if any
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.writer.Flush()
+	err := errors.Wrap(w.writer.Error(), "while flushing rejected rows")
+
+	if w.file != nil {
+		if closeErr := w.file.Close(); closeErr != nil && err == nil {
+			err = errors.Wrapf(closeErr, "unable to close file: %s", w.file.Name())
+		}
+	}
+
+	return err
+}
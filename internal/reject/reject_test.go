@@ -0,0 +1,46 @@
+package reject
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rickyshrestha/set-intersection-exercise/internal/reader"
+)
+
+func Test_New(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := New(&buf)
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.Write("first.csv", reader.Reject{Line: 3, Raw: []byte(`2,b"c`), Reason: "bare quote"}))
+	assert.NoError(t, w.Write("second.csv", reader.Reject{Line: 10, Raw: []byte("4,\"d\nd"), Reason: "wrong number of fields"}))
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, `file,line,reason,row
+first.csv,3,bare quote,"2,b""c"
+second.csv,10,wrong number of fields,"4,""d
+d"
+`, buf.String())
+}
+
+func Test_Create(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rejects.csv")
+	w, err := Create(path)
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.Write("first.csv", reader.Reject{Line: 2, Raw: []byte("x"), Reason: "short"}))
+	assert.NoError(t, w.Close())
+
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "file,line,reason,row\nfirst.csv,2,short,x\n", string(content))
+}
+
+func Test_Create_MissingDir(t *testing.T) {
+	_, err := Create(filepath.Join(t.TempDir(), "missing", "rejects.csv"))
+	assert.Error(t, err)
+}
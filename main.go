@@ -1,31 +1,84 @@
 package main
 
 import (
+	"context"
+	"encoding/csv"
 	"fmt"
+	"math"
+	"math/big"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/pterm/pterm"
 	"github.com/tav/golly/log"
+	"github.com/tav/golly/process"
 	"github.com/urfave/cli"
 
 	"github.com/rickyshrestha/set-intersection-exercise/internal/app"
 	"github.com/rickyshrestha/set-intersection-exercise/internal/counter"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/emitter"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/filter"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/output"
 	"github.com/rickyshrestha/set-intersection-exercise/internal/reader"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/reject"
 )
 
 const (
-	flagFirstFile  = "first-file"
-	flagSecondFile = "second-file"
-	flagKey        = "key"
-	flagBufferSize = "buffer-size"
+	flagFirstFile    = "first-file"
+	flagSecondFile   = "second-file"
+	flagFile         = "file"
+	flagFirstSketch  = "first-sketch"
+	flagSecondSketch = "second-sketch"
+	flagSketch       = "sketch"
+	flagKey          = "key"
+	flagFirstKey     = "first-key"
+	flagSecondKey    = "second-key"
+	flagBufferSize   = "buffer-size"
+	flagBatchSize    = "batch-size"
+	flagMemoryLimit  = "memory-limit"
+	flagTempDir      = "temp-dir"
+	flagEmit         = "emit"
+	flagNormalize    = "normalize"
+	flagFormat       = "format"
+	flagFirstFormat  = "first-format"
+	flagSecondFormat = "second-format"
+	flagCompression  = "compression"
+	flagDelimiter    = "csv-delimiter"
+	flagComment      = "csv-comment"
+	flagLazyQuotes   = "csv-lazy-quotes"
+	flagTrimSpace    = "csv-trim-leading-space"
+	flagFieldCount   = "csv-fields-per-record"
+	flagNoHeader     = "no-header"
+	flagZeroBased    = "zero-based"
+	flagMalformed    = "malformed-rows"
+	flagRejectFile   = "reject-file"
+	flagNullKeys     = "null-keys"
+	flagNullValues   = "null-values"
+	flagFilter       = "filter"
+	flagOutput       = "output"
+	flagTimeout      = "timeout"
+	flagApproximate  = "approximate"
+	flagPrecision    = "hll-precision"
+	flagSampleSize   = "minhash-size"
+	flagTopKeys      = "top-keys"
+	flagShards       = "shards"
+	flagCPUProfile   = "cpuprofile"
+	flagMemProfile   = "memprofile"
+	flagTrace        = "trace"
+
+	// emitToStdout is the value of the emit flag for writing the keys to stdout
+	emitToStdout = "-"
 )
 
 func main() {
 	app := &cli.App{
 		Name:    "set-intersection-exercise",
-		Usage:   "Given two input files in CSV format and a key, the program outputs the total no. of keys and distinct no. of keys in each file. It also provides the total overlap and distinct overlap between the two files.",
+		Usage:   "Given two or more input files in CSV format and a key, the program outputs the total no. of keys and distinct no. of keys in each file. It also provides the total overlap and distinct overlap of the keys common to all files, and between every pair of files.",
 		Version: "0.0.1",
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -38,27 +91,227 @@ func main() {
 				EnvVar: "SECOND_FILE",
 				Usage:  "path to the second of the two files to compare",
 			},
+			cli.StringSliceFlag{
+				Name:   flagFile,
+				EnvVar: "FILES",
+				Usage:  "path to a file to compare, can be repeated to compare more than two files",
+			},
+			cli.StringFlag{
+				Name:   flagFirstSketch,
+				EnvVar: "FIRST_SKETCH",
+				Usage:  "path to a sketch made by sketch build to compare in place of the first file",
+			},
+			cli.StringFlag{
+				Name:   flagSecondSketch,
+				EnvVar: "SECOND_SKETCH",
+				Usage:  "path to a sketch made by sketch build to compare in place of the second file",
+			},
+			cli.StringSliceFlag{
+				Name:   flagSketch,
+				EnvVar: "SKETCHES",
+				Usage:  "path to a sketch made by sketch build to compare like a file, can be repeated",
+			},
 			cli.StringFlag{
 				Name:   flagKey,
 				EnvVar: "KEY",
-				Usage:  "column in the csv file to be used as the key for comparison",
+				Usage:  "column in the csv file to be used as the key for comparison, or a comma separated list of columns that together make up the key. A column is given by name, or by index as #n",
+			},
+			cli.StringFlag{
+				Name:   flagFirstKey,
+				EnvVar: "FIRST_KEY",
+				Usage:  "key of the first file when it is named differently from the other files, defaults to key",
+			},
+			cli.StringFlag{
+				Name:   flagSecondKey,
+				EnvVar: "SECOND_KEY",
+				Usage:  "key of the second file when it is named differently from the other files, defaults to key",
+			},
+			cli.StringFlag{
+				Name:   flagFormat,
+				EnvVar: "FORMAT",
+				Usage:  "format of the files, one of: auto, csv, jsonl, json, parquet. auto picks the format from the file extension",
+				Value:  string(reader.FormatAuto),
+			},
+			cli.StringFlag{
+				Name:   flagFirstFormat,
+				EnvVar: "FIRST_FORMAT",
+				Usage:  "format of the first file when different from the other files, defaults to format",
+			},
+			cli.StringFlag{
+				Name:   flagSecondFormat,
+				EnvVar: "SECOND_FORMAT",
+				Usage:  "format of the second file when different from the other files, defaults to format",
+			},
+			cli.StringFlag{
+				Name:   flagCompression,
+				EnvVar: "COMPRESSION",
+				Usage:  "compression of the files, one of: auto, none, gzip, zstd, bzip2, xz. auto finds the compression from the start of the file, then the file extension",
+				Value:  string(reader.CompressionAuto),
+			},
+			cli.StringFlag{
+				Name:   flagDelimiter,
+				EnvVar: "CSV_DELIMITER",
+				Usage:  "delimiter of the fields of csv files, eg. ; or | or tab. auto sniffs it from the start of each file",
+				Value:  ",",
+			},
+			cli.StringFlag{
+				Name:   flagComment,
+				EnvVar: "CSV_COMMENT",
+				Usage:  "character starting the lines of csv files that are skipped, eg. #",
+			},
+			cli.BoolFlag{
+				Name:   flagLazyQuotes,
+				EnvVar: "CSV_LAZY_QUOTES",
+				Usage:  "allow quotes in unquoted fields and unescaped quotes in quoted fields of csv files",
+			},
+			cli.BoolFlag{
+				Name:   flagTrimSpace,
+				EnvVar: "CSV_TRIM_LEADING_SPACE",
+				Usage:  "skip the spaces at the start of the fields of csv files",
+			},
+			cli.IntFlag{
+				Name:   flagFieldCount,
+				EnvVar: "CSV_FIELDS_PER_RECORD",
+				Usage:  "no. of fields each row of csv files must have, 0 for that of the header and -1 for any",
+			},
+			cli.BoolFlag{
+				Name:   flagNoHeader,
+				EnvVar: "NO_HEADER",
+				Usage:  "the first row of csv files is not a header, the key columns are then given by index, eg. --key=2 or --key=#2",
+			},
+			cli.BoolFlag{
+				Name:   flagZeroBased,
+				EnvVar: "ZERO_BASED",
+				Usage:  "count key columns given by index, eg. #1, from 0 instead of from 1",
+			},
+			cli.StringFlag{
+				Name:   flagMalformed,
+				EnvVar: "MALFORMED_ROWS",
+				Usage: "what to do with the rows of csv and json lines files, and the objects of json arrays, that cannot be parsed or do not have the key. " +
+					"One of: fail, skip, a no. of rows to skip up to, eg. 100, or a percent of the rows of each file, eg. 0.5%",
+				Value: reader.MalformedFail,
+			},
+			cli.StringFlag{
+				Name:   flagRejectFile,
+				EnvVar: "REJECT_FILE",
+				Usage:  "path to a csv file to write the malformed rows that are skipped to, with their file, line and reason",
+			},
+			cli.StringFlag{
+				Name:   flagNullKeys,
+				EnvVar: "NULL_KEYS",
+				Usage: "what to do with null keys, with a column that is empty, only whitespace or one of the null values. " +
+					"One of: count, to count them as any other key, exclude, to leave them out, or separate, to leave them out and count them by value",
+				Value: reader.NullCount,
+			},
+			cli.StringFlag{
+				Name:   flagNullValues,
+				EnvVar: "NULL_VALUES",
+				Usage:  "comma separated list of the values that are null besides the empty ones, when null keys are left out",
+				Value:  strings.Join(reader.DefaultNullValues, ","),
+			},
+			cli.StringFlag{
+				Name:   flagFilter,
+				EnvVar: "FILTER",
+				Usage: "expression picking the rows of each file to read keys from, eg. \"status = active and age >= 18\". " +
+					"Fields are given as the key columns are and compared with =, !=, <, <=, >, >=, in (...) or ~ and !~ for a regular expression, " +
+					"joined with and, or and not",
+			},
+			cli.StringSliceFlag{
+				Name:   flagNormalize,
+				EnvVar: "NORMALIZE",
+				Usage: "normalizer applied to the key values before comparing, can be repeated to apply more than one in order. " +
+					"One of: trim, lower, upper, fold, nfc, nfkc, collapse-whitespace, strip-leading-zeros or s/pattern/replacement/ for a regex replacement",
 			},
 			cli.IntFlag{
 				Name:   flagBufferSize,
 				EnvVar: "BUFFER_SIZE",
-				Usage:  "buffer size for no. of records to load from file to process",
-				Value:  64,
+				Usage:  "buffer size for no. of records to load from file to process, rounded up to a whole no. of batches",
+				Value:  4 * reader.DefaultBatchSize,
+			},
+			cli.IntFlag{
+				Name:   flagBatchSize,
+				EnvVar: "BATCH_SIZE",
+				Usage:  "no. of records sent from the reader of a file to be counted at a time, larger batches take less time passing keys around",
+				Value:  reader.DefaultBatchSize,
+			},
+			cli.StringFlag{
+				Name:   flagMemoryLimit,
+				EnvVar: "MEMORY_LIMIT",
+				Usage:  "memory budget for key counts (eg. 512MB, 4GB) after which keys are spilled to sorted runs on disk, 0 for no limit",
+				Value:  "0",
+			},
+			cli.StringFlag{
+				Name:   flagTempDir,
+				EnvVar: "TEMP_DIR",
+				Usage:  "directory for the sorted runs written when over the memory limit, and for the copies of compressed parquet files, defaults to the OS temp dir",
+			},
+			cli.DurationFlag{
+				Name:   flagTimeout,
+				EnvVar: "TIMEOUT",
+				Usage:  "time after which the run is stopped (eg. 30s, 10m), 0 for no limit",
+			},
+			cli.StringFlag{
+				Name:   flagOutput,
+				EnvVar: "OUTPUT",
+				Usage:  "format of the result written to stdout, one of: table, json, yaml, csv, kv",
+				Value:  string(output.FormatTable),
+			},
+			cli.BoolFlag{
+				Name:   flagApproximate,
+				EnvVar: "APPROXIMATE",
+				Usage:  "estimate the counts using HyperLogLog and MinHash sketches of a fixed size instead of counting every distinct key, each estimate is shown with its error",
+			},
+			cli.IntFlag{
+				Name:   flagPrecision,
+				EnvVar: "HLL_PRECISION",
+				Usage:  fmt.Sprintf("precision of the HyperLogLog sketches when approximating, from %v to %v. Higher is more accurate and takes 2^precision bytes per file", counter.MinPrecision, counter.MaxPrecision),
+				Value:  counter.DefaultPrecision,
+			},
+			cli.IntFlag{
+				Name:   flagSampleSize,
+				EnvVar: "MINHASH_SIZE",
+				Usage:  "no. of key hashes the MinHash sketches keep when approximating, the overlaps are estimated from them. Higher is more accurate",
+				Value:  counter.DefaultSampleSize,
+			},
+			cli.IntFlag{
+				Name:   flagTopKeys,
+				EnvVar: "TOP_KEYS",
+				Usage:  "show the given no. of most repeated keys of each file and keys adding the most to the total overlap, along with a histogram of how many times keys are repeated",
+			},
+			cli.IntFlag{
+				Name:   flagShards,
+				EnvVar: "SHARDS",
+				Usage:  "no. of shards to split the keys across by their hash, each counted and compared in parallel. Only used when the keys are held in memory, ie. without --memory-limit, sketches or --approximate",
+				Value:  1,
+			},
+			cli.StringFlag{
+				Name:   flagEmit,
+				EnvVar: "EMIT",
+				Usage:  "directory to write the keys common to all files (common.csv) and the keys only in each file (only_n.csv) to, or - for stdout",
+			},
+			cli.StringFlag{
+				Name:  flagCPUProfile,
+				Usage: "write a cpu profile of the run to the file, for go tool pprof",
+			},
+			cli.StringFlag{
+				Name:  flagMemProfile,
+				Usage: "write a memory profile taken at the end of the run to the file, for go tool pprof",
+			},
+			cli.StringFlag{
+				Name:  flagTrace,
+				Usage: "write an execution trace of the run to the file, for go tool trace",
 			},
 		},
 		Action: run,
 	}
+	app.Commands = []cli.Command{sketchCommand(app.Flags)}
 
 	if err := app.Run(os.Args); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func run(context *cli.Context) error {
+func run(context *cli.Context) (err error) {
 	startedAt := time.Now()
 
 	cfg, err := parseAppConfig(context)
@@ -66,14 +319,114 @@ func run(context *cli.Context) error {
 		return errors.Wrap(err, "invalid application configs")
 	}
 
-	counterApp := app.NewApp(reader.ReadKeysFromCsvIntoChannel)
+	outputFormat, err := output.ParseFormat(context.String(flagOutput))
+	if err != nil {
+		return errors.Wrapf(err, "invalid output format (%s)", flagOutput)
+	}
+
+	emit := context.String(flagEmit)
+	if emit == emitToStdout && outputFormat != output.FormatTable {
+		return errors.Errorf("keys cannot be emitted to stdout (%s) along with the %s output (%s)", flagEmit, outputFormat, flagOutput)
+	}
+
+	if outputFormat != output.FormatTable {
+		// keep the result on stdout apart from the progress
+		pterm.SetDefaultOutput(os.Stderr)
+	}
 
-	result, err := counterApp.Start(cfg)
+	var keyEmitter *emitter.Emitter
+	if emit != "" {
+		if cfg.Approximate != nil {
+			return errors.Errorf("keys cannot be emitted (%s) when approximating (%s)", flagEmit, flagApproximate)
+		}
+
+		keyColumns, err := emitKeyColumns(cfg)
+		if err != nil {
+			return err
+		}
+		keyEmitter, err = newEmitter(emit, len(cfg.Sources), keyColumns)
+		if err != nil {
+			return errors.Wrap(err, "unable to emit keys")
+		}
+		// closed before the result is shown when the run succeeds, so that keys that could not be written fail it
+		defer func() {
+			if keyEmitter == nil {
+				return
+			}
+			if closeErr := keyEmitter.Close(); closeErr != nil && err == nil {
+				err = errors.Wrap(closeErr, "unable to emit keys")
+			}
+		}()
+		cfg.KeyVisitor = keyEmitter.Visit
+	}
+
+	var rejects *reject.Writer
+	if path := context.String(flagRejectFile); path != "" {
+		rejects, err = reject.Create(path)
+		if err != nil {
+			return errors.Wrap(err, "unable to write rejected rows")
+		}
+		// closed before the result is shown when the run succeeds, so that rows that could not be written fail it
+		defer func() {
+			if rejects == nil {
+				return
+			}
+			if closeErr := rejects.Close(); closeErr != nil && err == nil {
+				err = errors.Wrap(closeErr, "unable to write rejected rows")
+			}
+		}()
+		cfg.OnReject = rejects.Write
+	}
+
+	profiles := profiler{
+		cpuProfile: context.String(flagCPUProfile),
+		memProfile: context.String(flagMemProfile),
+		traceFile:  context.String(flagTrace),
+	}
+	if err := profiles.start(); err != nil {
+		return errors.Wrap(err, "unable to start profiling")
+	}
+	defer profiles.stop()
+
+	ctx, cancel := newRunContext(context.Duration(flagTimeout))
+	defer cancel()
+
+	counterApp := app.NewBatchApp(reader.ReadKeyBatchesFromCsvIntoChannel)
+
+	result, err := counterApp.Start(ctx, cfg)
 	if err != nil {
 		return errors.Wrap(err, "while running application")
 	}
 
-	showResult(cfg.FirstSource, cfg.SecondSource, result)
+	if keyEmitter != nil {
+		closeErr := keyEmitter.Close()
+		keyEmitter = nil
+		if closeErr != nil {
+			return errors.Wrap(closeErr, "unable to emit keys")
+		}
+	}
+
+	if rejects != nil {
+		closeErr := rejects.Close()
+		rejects = nil
+		if closeErr != nil {
+			return errors.Wrap(closeErr, "unable to write rejected rows")
+		}
+	}
+
+	if outputFormat != output.FormatTable {
+		report := output.NewReport(reportInputs(cfg), result, time.Since(startedAt))
+		if err := output.Write(os.Stdout, outputFormat, report); err != nil {
+			return errors.Wrap(err, "unable to write result")
+		}
+	} else {
+		paths := make([]string, 0, len(cfg.Sources))
+		for _, source := range cfg.Sources {
+			paths = append(paths, source.Path)
+		}
+		showResult(paths, result)
+	}
+
 	pterm.DefaultSpinner.Success(fmt.Sprintf("Process completed. Elapsed: %s", time.Since(startedAt).String()))
 	return nil
 }
@@ -86,44 +439,598 @@ func parseAppConfig(context *cli.Context) (app.RuntimeParam, error) {
 		return config, errors.Errorf("invalid buffer size (%s): %v", flagBufferSize, config.BufferSize)
 	}
 
-	config.FirstSource = context.String(flagFirstFile)
-	if config.FirstSource == "" {
-		return config, errors.New("first source file is empty")
+	config.BatchSize = context.Int(flagBatchSize)
+	if config.BatchSize <= 0 {
+		return config, errors.Errorf("invalid batch size (%s): %v", flagBatchSize, config.BatchSize)
+	}
+
+	memoryLimit, err := parseByteSize(context.String(flagMemoryLimit))
+	if err != nil {
+		return config, errors.Wrapf(err, "invalid memory limit (%s)", flagMemoryLimit)
+	}
+	config.MemoryLimit = memoryLimit
+	config.TempDir = context.String(flagTempDir)
+
+	format, err := reader.ParseFormat(context.String(flagFormat))
+	if err != nil {
+		return config, errors.Wrapf(err, "invalid format (%s)", flagFormat)
+	}
+
+	compression, err := reader.ParseCompression(context.String(flagCompression))
+	if err != nil {
+		return config, errors.Wrapf(err, "invalid compression (%s)", flagCompression)
+	}
+
+	for _, flags := range []struct{ file, sketch, key, format string }{
+		{flagFirstFile, flagFirstSketch, flagFirstKey, flagFirstFormat},
+		{flagSecondFile, flagSecondSketch, flagSecondKey, flagSecondFormat},
+	} {
+		if path := context.String(flags.sketch); path != "" {
+			if context.String(flags.file) != "" {
+				return config, errors.Errorf("only one of %s and %s can be set", flags.file, flags.sketch)
+			}
+
+			source, err := openSketchSource(path)
+			if err != nil {
+				return config, errors.Wrapf(err, "invalid sketch (%s)", flags.sketch)
+			}
+			config.Sources = append(config.Sources, source)
+			continue
+		}
+
+		source := app.Source{Path: context.String(flags.file), Compression: compression}
+		if source.Path == "" {
+			continue
+		}
+
+		sourceFormat := format
+		if context.String(flags.format) != "" {
+			sourceFormat, err = reader.ParseFormat(context.String(flags.format))
+			if err != nil {
+				return config, errors.Wrapf(err, "invalid format (%s)", flags.format)
+			}
+		}
+
+		source.ReadKeyBatchesFromFile, err = reader.BatchedForFormat(sourceFormat, source.Path)
+		if err != nil {
+			return config, err
+		}
+
+		if context.String(flags.key) != "" {
+			key, err := parseKeyColumns(context.String(flags.key))
+			if err != nil {
+				return config, errors.Wrapf(err, "invalid key (%s)", flags.key)
+			}
+			source.Key = key
+		}
+
+		config.Sources = append(config.Sources, source)
+	}
+
+	for _, path := range context.StringSlice(flagFile) {
+		if path == "" {
+			return config, errors.Errorf("source file is empty (%s)", flagFile)
+		}
+		read, err := reader.BatchedForFormat(format, path)
+		if err != nil {
+			return config, err
+		}
+		config.Sources = append(config.Sources, app.Source{Path: path, ReadKeyBatchesFromFile: read, Compression: compression})
+	}
+
+	for _, path := range context.StringSlice(flagSketch) {
+		if path == "" {
+			return config, errors.Errorf("sketch file is empty (%s)", flagSketch)
+		}
+		source, err := openSketchSource(path)
+		if err != nil {
+			return config, errors.Wrapf(err, "invalid sketch (%s)", flagSketch)
+		}
+		config.Sources = append(config.Sources, source)
 	}
 
-	config.SecondSource = context.String(flagSecondFile)
-	if config.SecondSource == "" {
-		return config, errors.New("second source file is empty")
+	if len(config.Sources) < 2 {
+		return config, errors.Errorf("at least two source files are needed (%s, %s, %s or a sketch in place of one)", flagFirstFile, flagSecondFile, flagFile)
+	}
+
+	// key is only needed when it is not set for every file, sketches are of keys read already
+	needsKey := false
+	for _, source := range config.Sources {
+		needsKey = needsKey || (len(source.Key) == 0 && source.Sketch == nil)
+	}
+
+	if needsKey || context.String(flagKey) != "" {
+		key, err := parseKeyColumns(context.String(flagKey))
+		if err != nil {
+			return config, errors.Wrapf(err, "invalid key (%s)", flagKey)
+		}
+		config.Key = key
+	}
+
+	config.Approximate = parseApproximation(context)
+
+	config.TopKeys = context.Int(flagTopKeys)
+	if config.TopKeys < 0 {
+		return config, errors.Errorf("invalid no. of top keys (%s): %v", flagTopKeys, config.TopKeys)
+	}
+	if config.TopKeys > 0 && config.Approximate != nil {
+		return config, errors.Errorf("top keys (%s) cannot be found when approximating (%s)", flagTopKeys, flagApproximate)
 	}
 
-	config.Key = context.String(flagKey)
-	if config.Key == "" {
-		return config, errors.New("key cannot be empty")
+	config.Shards = context.Int(flagShards)
+	if config.Shards < 1 {
+		return config, errors.Errorf("invalid no. of shards (%s): %v", flagShards, config.Shards)
 	}
 
+	config.Csv, err = parseCsvDialect(context)
+	if err != nil {
+		return config, err
+	}
+	config.NoHeader = context.Bool(flagNoHeader)
+	config.ZeroBased = context.Bool(flagZeroBased)
+
+	config.Malformed, err = parseMalformedRows(context)
+	if err != nil {
+		return config, err
+	}
+
+	config.Nulls, err = parseNullKeys(context)
+	if err != nil {
+		return config, err
+	}
+
+	config.Filter, err = parseFilter(context)
+	if err != nil {
+		return config, err
+	}
+
+	config.Normalizers, err = parseNormalizers(context)
+	if err != nil {
+		return config, err
+	}
+	config.NormalizerNames = context.StringSlice(flagNormalize)
+
 	return config, nil
 }
 
-func showResult(firstFilePath, secondFilePath string, result counter.IntersectionResult) {
-	err := pterm.DefaultTable.WithHasHeader().WithData(pterm.TableData{
+// parseApproximation returns the approximation of the flags, nil when not approximating
+func parseApproximation(context *cli.Context) *counter.Approximation {
+	if !context.Bool(flagApproximate) {
+		return nil
+	}
+
+	return &counter.Approximation{
+		Precision:  context.Int(flagPrecision),
+		SampleSize: context.Int(flagSampleSize),
+	}
+}
+
+func parseNormalizers(context *cli.Context) ([]reader.Normalizer, error) {
+	var normalizers []reader.Normalizer
+	for _, spec := range context.StringSlice(flagNormalize) {
+		normalizer, err := reader.ParseNormalizer(spec)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid normalizer (%s)", flagNormalize)
+		}
+		normalizers = append(normalizers, normalizer)
+	}
+	return normalizers, nil
+}
+
+func parseCsvDialect(context *cli.Context) (reader.CsvDialect, error) {
+	dialect := reader.CsvDialect{
+		LazyQuotes:       context.Bool(flagLazyQuotes),
+		TrimLeadingSpace: context.Bool(flagTrimSpace),
+		FieldsPerRecord:  context.Int(flagFieldCount),
+	}
+
+	var err error
+	dialect.Delimiter, dialect.Sniff, err = reader.ParseCsvDelimiter(context.String(flagDelimiter))
+	if err != nil {
+		return dialect, errors.Wrapf(err, "invalid delimiter (%s)", flagDelimiter)
+	}
+
+	dialect.Comment, err = reader.ParseCsvComment(context.String(flagComment))
+	if err != nil {
+		return dialect, errors.Wrapf(err, "invalid comment (%s)", flagComment)
+	}
+
+	if dialect.Comment != 0 && dialect.Comment == dialect.Delimiter {
+		return dialect, errors.Errorf("comment (%s) cannot be the delimiter (%s)", flagComment, flagDelimiter)
+	}
+
+	return dialect, nil
+}
+
+func parseNullKeys(context *cli.Context) (reader.NullKeys, error) {
+	var nulls reader.NullKeys
+
+	var err error
+	nulls.Policy, err = reader.ParseNullPolicy(context.String(flagNullKeys))
+	if err != nil {
+		return nulls, errors.Wrapf(err, "invalid null keys (%s)", flagNullKeys)
+	}
+
+	// the values are read as a csv record so a value with a comma can be quoted, none when empty
+	nulls.Values = []string{}
+	if value := context.String(flagNullValues); value != "" {
+		nulls.Values, err = csv.NewReader(strings.NewReader(value)).Read()
+		if err != nil {
+			return nulls, errors.Wrapf(err, "invalid null values (%s)", flagNullValues)
+		}
+	}
+
+	return nulls, nil
+}
+
+// parseFilter returns the filter of the flags, nil when not filtering
+func parseFilter(context *cli.Context) (*filter.Filter, error) {
+	expression := context.String(flagFilter)
+	if expression == "" {
+		return nil, nil
+	}
+
+	// the error of Parse already has the expression
+	return filter.Parse(expression)
+}
+
+func parseMalformedRows(context *cli.Context) (reader.MalformedRows, error) {
+	malformed, err := reader.ParseMalformedRows(context.String(flagMalformed))
+	if err != nil {
+		return malformed, errors.Wrapf(err, "invalid malformed rows (%s)", flagMalformed)
+	}
+
+	if context.String(flagRejectFile) != "" && !malformed.Skip {
+		return malformed, errors.Errorf("malformed rows are only written to the reject file (%s) when they are skipped (%s)", flagRejectFile, flagMalformed)
+	}
+
+	return malformed, nil
+}
+
+// openSketchSource opens a sketch to compare in place of a file, its key is the one it was built with
+func openSketchSource(path string) (app.Source, error) {
+	sketch, err := counter.OpenSketch(path)
+	if err != nil {
+		return app.Source{}, err
+	}
+
+	return app.Source{Path: path, Key: sketch.Key, Sketch: sketch}, nil
+}
+
+// newRunContext returns a context that is done on Ctrl-C or SIGTERM, or once the timeout is up when it is set
+func newRunContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	// golly exits on the first signal, leave it to the context so that the readers stop and the sorted runs are removed.
+	// Only ever set here, once per run and before any goroutine of the run is started, golly reads it with no lock once a signal is in
+	process.DisableDefaultExit = true
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	// once the first signal is in, the next one gets the default handling of Go, so a second Ctrl-C exits straight away.
+	// The signals are also reset for golly, which is notified of every signal
+	go func() {
+		<-ctx.Done()
+		stop()
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+	}()
+
+	if timeout <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// reportInputs lists the path and key of each source for the report
+func reportInputs(cfg app.RuntimeParam) []output.Input {
+	inputs := make([]output.Input, 0, len(cfg.Sources))
+	for _, source := range cfg.Sources {
+		key := source.Key
+		if len(key) == 0 {
+			key = cfg.Key
+		}
+		inputs = append(inputs, output.Input{Path: source.Path, Key: key})
+	}
+	return inputs
+}
+
+func newEmitter(emit string, inputs, keyColumns int) (*emitter.Emitter, error) {
+	if emit != emitToStdout {
+		return emitter.NewDir(emit, inputs, keyColumns)
+	}
+
+	// keep the keys on stdout apart from the result
+	pterm.SetDefaultOutput(os.Stderr)
+	return emitter.New(os.Stdout, inputs, keyColumns)
+}
+
+// emitKeyColumns is the no. of columns that make up the key of every file, so that emitted keys are written a column each
+func emitKeyColumns(cfg app.RuntimeParam) (int, error) {
+	keyColumns := 0
+	for _, source := range cfg.Sources {
+		key := source.Key
+		if len(key) == 0 {
+			key = cfg.Key
+		}
+
+		if keyColumns != 0 && len(key) != keyColumns {
+			return 0, errors.Errorf("keys cannot be emitted (%s) when the keys of the files are not made up of the same no. of columns", flagEmit)
+		}
+		keyColumns = len(key)
+	}
+	return keyColumns, nil
+}
+
+// parseKeyColumns parses the comma separated list of key columns.
+// Columns are read as a csv record so a column with a comma in its name can be quoted
+func parseKeyColumns(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, errors.New("key cannot be empty")
+	}
+
+	columns, err := csv.NewReader(strings.NewReader(value)).Read()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse key columns: %s", value)
+	}
+
+	for _, column := range columns {
+		if column == "" {
+			return nil, errors.Errorf("key column cannot be empty: %s", value)
+		}
+	}
+
+	return columns, nil
+}
+
+// parseByteSize parses sizes such as 1024, 64KB, 512MB or 4GB into no. of bytes
+func parseByteSize(input string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(input))
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"KB", 1 << 10},
+		{"MB", 1 << 20},
+		{"GB", 1 << 30},
+		{"TB", 1 << 40},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid size: %s", value)
+	}
+
+	if size < 0 {
+		return 0, errors.Errorf("size cannot be negative: %v", size)
+	}
+
+	if size > math.MaxInt64/multiplier {
+		return 0, errors.Errorf("size is too large, it cannot be more than %v bytes: %s", int64(math.MaxInt64), input)
+	}
+
+	return size * multiplier, nil
+}
+
+func showResult(sources []string, result counter.IntersectionResult) {
+	files := pterm.TableData{
+		{
+			"File",
+			"Total keys",
+			"Distinct keys",
+			"Total keys only in this file",
+			"Distinct keys only in this file",
+		},
+	}
+	// the skipped rows and excluded keys are only shown when there are any
+	skipped, excluded := false, false
+	for _, file := range result.Files {
+		skipped = skipped || file.SkippedRows > 0
+		excluded = excluded || file.ExcludedKeyCount > 0
+	}
+	if skipped {
+		files[0] = append(files[0], "Skipped rows")
+	}
+	if excluded {
+		files[0] = append(files[0], "Excluded null keys")
+	}
+
+	for i, file := range result.Files {
+		row := []string{
+			sources[i],
+			fmt.Sprintf("%v", file.KeyCount),
+			formatCount(file.DistinctKeyCount, file.DistinctKeyCountError),
+			formatSaturatedCount(file.ExclusiveKeyCount, file.ExclusiveKeyCountError, file.ExclusiveKeyCountSaturated),
+			formatCount(file.DistinctExclusiveKeyCount, file.DistinctExclusiveKeyCountError),
+		}
+		if skipped {
+			row = append(row, fmt.Sprintf("%v", file.SkippedRows))
+		}
+		if excluded {
+			row = append(row, fmt.Sprintf("%v", file.ExcludedKeyCount))
+		}
+		files = append(files, row)
+	}
+	renderTable(files)
+
+	renderTable(pterm.TableData{
 		{
-			"Total keys in first table",
-			"Distinct keys in first table",
-			"Total keys in second table",
-			"Distinct keys in second table",
 			"Total Overlap",
 			"Distinct Overlap",
+			"Distinct Union",
 		},
 		{
-			fmt.Sprintf("%v", result.First.KeyCount),
-			fmt.Sprintf("%v", result.First.DistinctKeyCount),
-			fmt.Sprintf("%v", result.Second.KeyCount),
-			fmt.Sprintf("%v", result.Second.DistinctKeyCount),
-			fmt.Sprintf("%v", result.TotalOverlap),
-			fmt.Sprintf("%v", result.DistinctOverlap),
+			formatTotalOverlap(result.TotalOverlap, result.BigTotalOverlap, result.TotalOverlapError),
+			formatCount(result.DistinctOverlap, result.DistinctOverlapError),
+			formatCount(result.DistinctUnion, result.DistinctUnionError),
 		},
-	}).Render()
-	if err != nil {
+	})
+
+	pairs := pterm.TableData{
+		{
+			"First file",
+			"Second file",
+			"Total Overlap",
+			"Distinct Overlap",
+			"Only in first",
+			"Only in second",
+			"Distinct Union",
+			"Symmetric Difference",
+		},
+	}
+	for i := range result.Pairs {
+		for j := i + 1; j < len(result.Pairs); j++ {
+			overlap := result.Pairs[i][j]
+			pairs = append(pairs, []string{
+				sources[i],
+				sources[j],
+				formatTotalOverlap(overlap.TotalOverlap, overlap.BigTotalOverlap, overlap.TotalOverlapError),
+				formatCount(overlap.DistinctOverlap, overlap.DistinctOverlapError),
+				formatCount(overlap.DistinctDifference, overlap.DistinctDifferenceError),
+				formatCount(result.Pairs[j][i].DistinctDifference, result.Pairs[j][i].DistinctDifferenceError),
+				formatCount(overlap.DistinctUnion, overlap.DistinctUnionError),
+				formatCount(overlap.DistinctSymmetricDifference, overlap.DistinctSymmetricDifferenceError),
+			})
+		}
+	}
+	renderTable(pairs)
+
+	similarities := pterm.TableData{
+		{
+			"First file",
+			"Second file",
+			"Keys",
+			"Jaccard",
+			"First in second",
+			"Second in first",
+			"Overlap coefficient",
+			"Dice",
+		},
+	}
+	for i := range result.Pairs {
+		for j := i + 1; j < len(result.Pairs); j++ {
+			overlap := result.Pairs[i][j]
+			weighted := "weighted"
+			if overlap.MultisetOverlapSaturated {
+				// the multiset overlap is kept at the largest int, so the weighted similarity is less than the exact one
+				weighted = "weighted (saturated)"
+			}
+
+			for _, similarity := range []struct {
+				keys string
+				counter.Similarity
+			}{
+				{"distinct", overlap.DistinctSimilarity},
+				{weighted, overlap.WeightedSimilarity},
+			} {
+				similarities = append(similarities, []string{
+					sources[i],
+					sources[j],
+					similarity.keys,
+					formatRatio(similarity.Jaccard),
+					formatRatio(similarity.ContainmentOfFirst),
+					formatRatio(similarity.ContainmentOfSecond),
+					formatRatio(similarity.OverlapCoefficient),
+					formatRatio(similarity.Dice),
+				})
+			}
+		}
+	}
+	renderTable(similarities)
+
+	showFrequencies(sources, result)
+}
+
+// showFrequencies shows the histogram, top keys and null keys of each file and the keys adding the most to the total overlap,
+// when they were found
+func showFrequencies(sources []string, result counter.IntersectionResult) {
+	histograms := pterm.TableData{{"File", "Times found", "Distinct keys", "Total keys"}}
+	topKeys := pterm.TableData{{"File", "Most repeated key", "Times found"}}
+	nullKeys := pterm.TableData{{"File", "Null key", "Times found"}}
+
+	for i, file := range result.Files {
+		for _, bucket := range file.Histogram {
+			found := fmt.Sprintf("%v", bucket.Min)
+			if bucket.Max != bucket.Min {
+				found = fmt.Sprintf("%v-%v", bucket.Min, bucket.Max)
+			}
+			histograms = append(histograms, []string{sources[i], found, fmt.Sprintf("%v", bucket.DistinctKeys), fmt.Sprintf("%v", bucket.Keys)})
+		}
+
+		for _, key := range file.TopKeys {
+			topKeys = append(topKeys, []string{sources[i], key.Key, fmt.Sprintf("%v", key.Count)})
+		}
+		for _, key := range file.NullKeys {
+			nullKeys = append(nullKeys, []string{sources[i], strconv.Quote(key.Key), fmt.Sprintf("%v", key.Count)})
+		}
+	}
+
+	if len(histograms) > 1 {
+		renderTable(histograms)
+	}
+	if len(topKeys) > 1 {
+		renderTable(topKeys)
+	}
+	if len(nullKeys) > 1 {
+		renderTable(nullKeys)
+	}
+
+	if len(result.TopOverlapKeys) == 0 {
+		return
+	}
+
+	overlapKeys := pterm.TableData{{"Key adding most to total overlap", "Times found in each file", "Overlap"}}
+	for _, key := range result.TopOverlapKeys {
+		counts := make([]string, len(key.Counts))
+		for i, c := range key.Counts {
+			counts[i] = strconv.Itoa(c)
+		}
+		overlapKeys = append(overlapKeys, []string{key.Key, strings.Join(counts, " x "), fmt.Sprintf("%v", key.Overlap)})
+	}
+	renderTable(overlapKeys)
+}
+
+// formatCount shows a count along with its error when it was estimated
+func formatCount(count, errorBound int) string {
+	if errorBound == 0 {
+		return fmt.Sprintf("%v", count)
+	}
+	return fmt.Sprintf("%v ± %v", count, errorBound)
+}
+
+// formatSaturatedCount is formatCount showing a count kept at the largest int as at least that
+func formatSaturatedCount(count, errorBound int, saturated bool) string {
+	if saturated {
+		return "≥ " + formatCount(count, errorBound)
+	}
+	return formatCount(count, errorBound)
+}
+
+// formatTotalOverlap is formatCount showing the exact total overlap when it is too large for an int
+func formatTotalOverlap(count int, bigCount *big.Int, errorBound int) string {
+	if bigCount != nil {
+		return bigCount.String()
+	}
+	return formatCount(count, errorBound)
+}
+
+// formatRatio shows a ratio from 0 to 1 to four decimal places
+func formatRatio(ratio float64) string {
+	return strconv.FormatFloat(ratio, 'f', 4, 64)
+}
+
+func renderTable(data pterm.TableData) {
+	if err := pterm.DefaultTable.WithHasHeader().WithData(data).Render(); err != nil {
 		log.Error(err.Error())
 	}
 }
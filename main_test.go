@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseByteSize(t *testing.T) {
+	for value, expected := range map[string]int64{
+		"0":                   0,
+		"1024":                1024,
+		"100B":                100,
+		"64KB":                64 << 10,
+		"512mb":               512 << 20,
+		" 4 GB ":              4 << 30,
+		"2TB":                 2 << 40,
+		"8388607TB":           8388607 << 40,
+		"9223372036854775807": math.MaxInt64,
+	} {
+		size, err := parseByteSize(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, size, value)
+	}
+
+	for _, value := range []string{"", "abc", "1.5GB", "-1", "-1KB", "4G", "99999999999GB", "8388608TB", "9223372036854775808"} {
+		_, err := parseByteSize(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+
+	"github.com/pkg/errors"
+	"github.com/tav/golly/log"
+)
+
+// profiler writes the profiles asked for on the command line, a path left empty skips that profile
+type profiler struct {
+	cpuProfile string
+	memProfile string
+	traceFile  string
+
+	cpuFile  *os.File
+	traceOut *os.File
+}
+
+// start starts the cpu profile and the execution trace
+func (p *profiler) start() error {
+	if p.cpuProfile != "" {
+		file, err := os.Create(p.cpuProfile)
+		if err != nil {
+			return errors.Wrapf(err, "unable to create cpu profile: %s", p.cpuProfile)
+		}
+
+		if err := pprof.StartCPUProfile(file); err != nil {
+			_ = file.Close()
+			return errors.Wrap(err, "unable to start cpu profile")
+		}
+		p.cpuFile = file
+	}
+
+	if p.traceFile != "" {
+		file, err := os.Create(p.traceFile)
+		if err != nil {
+			p.stopCPUProfile()
+			return errors.Wrapf(err, "unable to create trace: %s", p.traceFile)
+		}
+
+		if err := trace.Start(file); err != nil {
+			_ = file.Close()
+			p.stopCPUProfile()
+			return errors.Wrap(err, "unable to start trace")
+		}
+		p.traceOut = file
+	}
+
+	return nil
+}
+
+// stop stops the cpu profile and the trace, then writes the heap profile
+func (p *profiler) stop() {
+	p.stopCPUProfile()
+
+	if p.traceOut != nil {
+		trace.Stop()
+		closeProfile(p.traceOut)
+		p.traceOut = nil
+	}
+
+	if p.memProfile != "" {
+		file, err := os.Create(p.memProfile)
+		if err != nil {
+			log.Errorf("unable to create memory profile: %s", p.memProfile)
+			return
+		}
+		defer closeProfile(file)
+
+		// up to date statistics of what is still in use
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(file); err != nil {
+			log.Errorf("unable to write memory profile: %s", err)
+		}
+	}
+}
+
+func (p *profiler) stopCPUProfile() {
+	if p.cpuFile != nil {
+		pprof.StopCPUProfile()
+		closeProfile(p.cpuFile)
+		p.cpuFile = nil
+	}
+}
+
+func closeProfile(file *os.File) {
+	if err := file.Close(); err != nil {
+		log.Errorf("unable to close profile: %s", file.Name())
+	}
+}
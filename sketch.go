@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pterm/pterm"
+	"github.com/tav/golly/log"
+	"github.com/urfave/cli"
+
+	"github.com/rickyshrestha/set-intersection-exercise/internal/app"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/reader"
+	"github.com/rickyshrestha/set-intersection-exercise/internal/reject"
+)
+
+// sketchCommand is the sketch command, its flags are taken from those of the app
+func sketchCommand(appFlags []cli.Flag) cli.Command {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:  flagFile,
+			Usage: "path to the file to sketch",
+		},
+	}
+
+	for _, flag := range appFlags {
+		switch flag.GetName() {
+		case flagKey, flagFormat, flagCompression, flagNormalize, flagBufferSize, flagBatchSize, flagMemoryLimit, flagTempDir,
+			flagTimeout, flagApproximate, flagPrecision, flagSampleSize,
+			flagDelimiter, flagComment, flagLazyQuotes, flagTrimSpace, flagFieldCount, flagNoHeader, flagZeroBased, flagMalformed, flagRejectFile,
+			flagNullKeys, flagNullValues, flagFilter:
+			flags = append(flags, flag)
+		}
+	}
+
+	return cli.Command{
+		Name:  "sketch",
+		Usage: "work with sketches of the keys of a file",
+		Subcommands: []cli.Command{
+			{
+				Name: "build",
+				Usage: "read the keys of a file once and write their counts, or HyperLogLog and MinHash sketches with --approximate, to a sketch file. " +
+					"The sketch is compared in place of the file with --first-sketch, --second-sketch or --sketch",
+				ArgsUsage: "<sketch file>",
+				Flags:     flags,
+				Action:    buildSketch,
+			},
+		},
+	}
+}
+
+func buildSketch(context *cli.Context) (err error) {
+	startedAt := time.Now()
+
+	path := context.Args().First()
+	if path == "" || context.NArg() > 1 {
+		return errors.New("the path of the sketch file to write is needed, and only that")
+	}
+
+	param, err := parseSketchConfig(context)
+	if err != nil {
+		return errors.Wrap(err, "invalid sketch configs")
+	}
+
+	// the sketch is written next to where it goes and only moved there once complete
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "unable to create sketch file")
+	}
+	defer func() {
+		if err := os.Remove(file.Name()); err != nil && !os.IsNotExist(err) {
+			log.Errorf("unable to remove incomplete sketch: %s", file.Name())
+		}
+	}()
+
+	var rejects *reject.Writer
+	if path := context.String(flagRejectFile); path != "" {
+		rejects, err = reject.Create(path)
+		if err != nil {
+			return errors.Wrap(err, "unable to write rejected rows")
+		}
+		// closed before the sketch is written when it is built, so that rows that could not be written fail it
+		defer func() {
+			if rejects == nil {
+				return
+			}
+			if closeErr := rejects.Close(); closeErr != nil && err == nil {
+				err = errors.Wrap(closeErr, "unable to write rejected rows")
+			}
+		}()
+		param.OnReject = rejects.Write
+	}
+
+	ctx, cancel := newRunContext(context.Duration(flagTimeout))
+	defer cancel()
+
+	counterApp := app.NewBatchApp(reader.ReadKeyBatchesFromCsvIntoChannel)
+
+	param.Output = file
+	if err := counterApp.BuildSketch(ctx, param); err != nil {
+		_ = file.Close()
+		return errors.Wrap(err, "while building sketch")
+	}
+
+	if rejects != nil {
+		closeErr := rejects.Close()
+		rejects = nil
+		if closeErr != nil {
+			_ = file.Close()
+			return errors.Wrap(closeErr, "unable to write rejected rows")
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.Wrapf(err, "unable to write sketch: %s", path)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return errors.Wrapf(err, "unable to write sketch: %s", path)
+	}
+
+	pterm.DefaultSpinner.Success(fmt.Sprintf("Sketch written to %s. Elapsed: %s", path, time.Since(startedAt).String()))
+	return nil
+}
+
+func parseSketchConfig(context *cli.Context) (app.SketchParam, error) {
+	config := app.SketchParam{}
+	config.BufferSize = context.Int(flagBufferSize)
+
+	if config.BufferSize <= 0 {
+		return config, errors.Errorf("invalid buffer size (%s): %v", flagBufferSize, config.BufferSize)
+	}
+
+	config.BatchSize = context.Int(flagBatchSize)
+	if config.BatchSize <= 0 {
+		return config, errors.Errorf("invalid batch size (%s): %v", flagBatchSize, config.BatchSize)
+	}
+
+	memoryLimit, err := parseByteSize(context.String(flagMemoryLimit))
+	if err != nil {
+		return config, errors.Wrapf(err, "invalid memory limit (%s)", flagMemoryLimit)
+	}
+	config.MemoryLimit = memoryLimit
+	config.TempDir = context.String(flagTempDir)
+
+	source := app.Source{Path: context.String(flagFile)}
+	if source.Path == "" {
+		return config, errors.Errorf("source file is empty (%s)", flagFile)
+	}
+
+	format, err := reader.ParseFormat(context.String(flagFormat))
+	if err != nil {
+		return config, errors.Wrapf(err, "invalid format (%s)", flagFormat)
+	}
+
+	source.ReadKeyBatchesFromFile, err = reader.BatchedForFormat(format, source.Path)
+	if err != nil {
+		return config, err
+	}
+
+	source.Compression, err = reader.ParseCompression(context.String(flagCompression))
+	if err != nil {
+		return config, errors.Wrapf(err, "invalid compression (%s)", flagCompression)
+	}
+	config.Source = source
+
+	config.Key, err = parseKeyColumns(context.String(flagKey))
+	if err != nil {
+		return config, errors.Wrapf(err, "invalid key (%s)", flagKey)
+	}
+
+	config.Approximate = parseApproximation(context)
+
+	config.Csv, err = parseCsvDialect(context)
+	if err != nil {
+		return config, err
+	}
+	config.NoHeader = context.Bool(flagNoHeader)
+	config.ZeroBased = context.Bool(flagZeroBased)
+
+	config.Malformed, err = parseMalformedRows(context)
+	if err != nil {
+		return config, err
+	}
+
+	config.Nulls, err = parseNullKeys(context)
+	if err != nil {
+		return config, err
+	}
+
+	config.Filter, err = parseFilter(context)
+	if err != nil {
+		return config, err
+	}
+
+	config.Normalizers, err = parseNormalizers(context)
+	if err != nil {
+		return config, err
+	}
+	config.NormalizerNames = context.StringSlice(flagNormalize)
+
+	return config, nil
+}